@@ -6,14 +6,19 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/konifar/kibelasync/client"
+	"github.com/konifar/kibelasync/kibela"
 	"golang.org/x/xerrors"
 )
 
 const cmdName = "kibelasync"
 
-// Run the kibelasync
-func Run(argv []string, outStream, errStream io.Writer) error {
+// Run the kibelasync. The inStream is used for the contents of notes and comments,
+// and for the answers of confirmations.
+func Run(argv []string, inStream io.Reader, outStream, errStream io.Writer) error {
 	log.SetOutput(errStream)
 	log.SetPrefix(fmt.Sprintf("[%s] ", cmdName))
 	nameAndVer := fmt.Sprintf("%s (v%s rev:%s)", cmdName, version, revision)
@@ -26,13 +31,34 @@ func Run(argv []string, outStream, errStream io.Writer) error {
 		formatCommands(fs.Output())
 	}
 
-	ver := fs.Bool("version", false, "display version")
+	var (
+		ver       = fs.Bool("version", false, "display version")
+		endpoint  = fs.String("endpoint", "", "endpoint URL of Kibela API (default: https://{team}.kibe.la/api/v1)")
+		timeout   = fs.Duration("timeout", 0, "timeout of each request")
+		rateLimit = fs.Int("rate-limit", 0, "max requests per second (default: 10)")
+		profile   = fs.String("profile", "", "profile in the config file (default: $KIBELA_PROFILE or default_profile)")
+		headers   headerFlag
+	)
+	fs.Var(&headers, "header", "custom header like `Key: Value` for each request (can be repeated)")
 	if err := fs.Parse(argv); err != nil {
 		return err
 	}
 	if *ver {
 		return printVersion(outStream)
 	}
+	var opts []client.Option
+	if *endpoint != "" {
+		opts = append(opts, client.WithEndpoint(*endpoint))
+	}
+	if *timeout > 0 {
+		opts = append(opts, client.WithTimeout(*timeout))
+	}
+	if *rateLimit > 0 {
+		opts = append(opts, client.WithRateLimit(time.Second, *rateLimit))
+	}
+	for _, h := range headers {
+		opts = append(opts, client.WithHeader(h[0], h[1]))
+	}
 
 	argv = fs.Args()
 	if len(argv) < 1 {
@@ -42,7 +68,64 @@ func Run(argv []string, outStream, errStream io.Writer) error {
 	if !ok {
 		return xerrors.Errorf("unknown subcommand: %s", argv[0])
 	}
-	return rnr.run(context.Background(), argv[1:], outStream, errStream)
+	p, err := kibela.LoadProfile(*profile)
+	if err != nil {
+		return err
+	}
+	ctx := context.WithValue(context.Background(), clientOptionsKey{}, opts)
+	ctx = context.WithValue(ctx, profileKey{}, p)
+	return rnr.run(ctx, argv[1:], inStream, outStream, errStream)
+}
+
+type clientOptionsKey struct{}
+
+type profileKey struct{}
+
+type profile struct {
+	*kibela.Profile
+}
+
+// profileFrom returns the profile selected by the global flags
+func profileFrom(ctx context.Context) profile {
+	p, _ := ctx.Value(profileKey{}).(*kibela.Profile)
+	if p == nil {
+		p = &kibela.Profile{}
+	}
+	return profile{p}
+}
+
+// dir returns the default sync directory
+func (p profile) dir() string {
+	if p.Dir != "" {
+		return p.Dir
+	}
+	return "notes"
+}
+
+// newTeams returns the Kibela clients of the teams in the config files. The
+// profile specified by the global flags is the default.
+func newTeams(ctx context.Context) (*kibela.Teams, error) {
+	opts, _ := ctx.Value(clientOptionsKey{}).([]client.Option)
+	return kibela.NewTeams(version, profileFrom(ctx).Profile, opts...)
+}
+
+type headerFlag [][2]string
+
+func (hf *headerFlag) String() string {
+	hs := make([]string, len(*hf))
+	for i, h := range *hf {
+		hs[i] = h[0] + ": " + h[1]
+	}
+	return strings.Join(hs, ", ")
+}
+
+func (hf *headerFlag) Set(v string) error {
+	stuff := strings.SplitN(v, ":", 2)
+	if len(stuff) != 2 || strings.TrimSpace(stuff[0]) == "" {
+		return xerrors.Errorf("invalid header (must be `Key: Value`): %s", v)
+	}
+	*hf = append(*hf, [2]string{strings.TrimSpace(stuff[0]), strings.TrimSpace(stuff[1])})
+	return nil
 }
 
 func printVersion(out io.Writer) error {
@@ -52,9 +135,14 @@ func printVersion(out io.Writer) error {
 
 var (
 	subCommands = []runner{
+		&cmdComment{},
+		&cmdDelete{},
+		&cmdDiff{},
 		&cmdPublish{},
 		&cmdPull{},
 		&cmdPush{},
+		&cmdStatus{},
+		&cmdSync{},
 	}
 	dispatch          = make(map[string]runner, len(subCommands))
 	maxSubcommandName int
@@ -81,5 +169,26 @@ func formatCommands(out io.Writer) {
 type runner interface {
 	name() string
 	description() string
-	run(context.Context, []string, io.Writer, io.Writer) error
+	run(context.Context, []string, io.Reader, io.Writer, io.Writer) error
+}
+
+// exitError is an error with the exit status. The error message is omitted when err is nil.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (ee *exitError) Error() string {
+	if ee.err == nil {
+		return ""
+	}
+	return ee.err.Error()
+}
+
+func (ee *exitError) Unwrap() error {
+	return ee.err
+}
+
+func (ee *exitError) ExitCode() int {
+	return ee.code
 }
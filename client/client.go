@@ -8,8 +8,12 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
-	"strings"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/konifar/kibelasync/internal/graphql"
 	"golang.org/x/xerrors"
 )
 
@@ -27,10 +31,24 @@ type Doer interface {
 type Client struct {
 	token, endpoint string
 	userAgent       string
+	headers         http.Header
 	cli             Doer
 	limiter         *rateLimitRoundTripper
+
+	maxRetries   int
+	retryTimeout time.Duration
+
+	// queries caches prepared queries by the original query text
+	queries sync.Map
 }
 
+// When the budget is exhausted, it recovers one per millisecond, so the 10,000 cost
+// for a request recovers in 10 seconds. So, retrying within 1 minute is enough usually.
+const (
+	defaultMaxRetries   = 5
+	defaultRetryTimeout = time.Minute
+)
+
 type budget struct {
 	Cost      int `json:"cost,string"`
 	Consumed  int `json:"consumed,string"`
@@ -38,68 +56,164 @@ type budget struct {
 }
 
 // New returns new http client
-func New(ver, team, token string) (*Client, error) {
-	cli := &Client{token: token}
-	cli.endpoint = fmt.Sprintf(endpointBase, team)
-	cli.limiter = newRateLimitRoundTripper()
-	cli.cli = &http.Client{Transport: cli.limiter}
+func New(ver, team, token string, opts ...Option) (*Client, error) {
+	o := &options{
+		endpoint:    fmt.Sprintf(endpointBase, team),
+		transport:   http.DefaultTransport,
+		reqInterval: reqInterval,
+		reqLimit:    reqLimit,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.reqInterval <= 0 || o.reqLimit <= 0 {
+		return nil, xerrors.Errorf("invalid rate limit: %d requests per %s", o.reqLimit, o.reqInterval)
+	}
+	cli := &Client{
+		token:        token,
+		endpoint:     o.endpoint,
+		headers:      o.headers,
+		maxRetries:   defaultMaxRetries,
+		retryTimeout: defaultRetryTimeout,
+	}
+	cli.limiter = newRateLimitRoundTripper(o.transport, o.reqInterval, o.reqLimit)
+	cli.cli = &http.Client{
+		Transport: cli.limiter,
+		Timeout:   o.timeout,
+	}
 	cli.userAgent = fmt.Sprintf(userAgentBase, ver)
 	return cli, nil
 }
 
-// Do GraphQL request
+// Do GraphQL request. When the request is rejected by the rate limit or the exhausted
+// budget, it waits for the time advised by the server and retries the request, if the
+// request is a query or an idempotent mutation.
 func (cli *Client) Do(ctx context.Context, pa *Payload) (json.RawMessage, error) {
-	pa.Query = strings.TrimSpace(pa.Query)
-	isQuery := !strings.HasPrefix(pa.Query, "mutation")
-	if isQuery {
-		// inject cost query (these fields are seems to be no cost now)
-		q := pa.Query
-		q = strings.TrimSuffix(q, "}")
-		q += `
-  budget {
-    cost
-    consumed
-    remaining
-  }
-}`
-		pa.Query = q
+	pq, err := cli.prepare(pa.Query)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to cli.Do: %w", err)
 	}
+	isQuery := pq.isQuery
+	pa.Query = pq.query
 
 	body := bytes.Buffer{}
 	if err := json.NewEncoder(&body).Encode(pa); err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cli.endpoint, &body)
+	retryable := isQuery || pa.Idempotent
+	deadline := time.Now().Add(cli.retryTimeout)
+	for attempt := 0; ; attempt++ {
+		data, wait, err := cli.do(ctx, body.Bytes(), isQuery)
+		if err == nil || !retryable || !isRateLimited(err) {
+			return data, err
+		}
+		if attempt >= cli.maxRetries {
+			return nil, xerrors.Errorf("gave up retrying after %d attempts: %w", attempt+1, err)
+		}
+		if wait <= 0 {
+			// exponential back-off from 1 second
+			wait = time.Second << uint(attempt)
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return nil, xerrors.Errorf("the budget will not recover within %s (advised to wait %s): %w",
+				cli.retryTimeout, wait, err)
+		}
+		log.Printf("rate limited. retry after %s: %s", wait, err)
+		if cli.limiter != nil {
+			// postpone other requests in flight too
+			cli.limiter.setRequestAfter(time.Now().Add(wait))
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+type preparedQuery struct {
+	query   string
+	isQuery bool
+}
+
+// budgetField selects the cost of the request and the remaining budget
+var budgetField = &graphql.Field{
+	Name: "budget",
+	SelectionSet: []*graphql.Field{
+		{Name: "cost"},
+		{Name: "consumed"},
+		{Name: "remaining"},
+	},
+}
+
+// prepare parses the query and adds the budget selection to the query operation, so
+// that the rate limiter can know the remaining budget.
+func (cli *Client) prepare(query string) (*preparedQuery, error) {
+	if pq, ok := cli.queries.Load(query); ok {
+		return pq.(*preparedQuery), nil
+	}
+	doc, err := graphql.Parse(query)
 	if err != nil {
-		return nil, err
+		return nil, xerrors.Errorf("invalid query: %w", err)
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cli.token))
+	op, err := doc.Operation("")
+	if err != nil {
+		return nil, xerrors.Errorf("invalid query: %w", err)
+	}
+	pq := &preparedQuery{query: query, isQuery: op.Type == graphql.Query}
+	if pq.isQuery {
+		hasBudget := false
+		for _, f := range op.SelectionSet {
+			if f.ResponseKey() == budgetField.Name {
+				hasBudget = true
+				break
+			}
+		}
+		if !hasBudget {
+			op.SelectionSet = append(op.SelectionSet, budgetField)
+			pq.query = doc.String()
+		}
+	}
+	cli.queries.Store(query, pq)
+	return pq, nil
+}
+
+// do sends the request once. When the request is rejected by the rate limit, it
+// returns the wait time advised by the server if any.
+func (cli *Client) do(ctx context.Context, body []byte, isQuery bool) (json.RawMessage, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cli.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	cli.setHeaders(req)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", cli.userAgent)
 
 	resp, err := cli.cli.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusTooManyRequests {
-		return nil, ErrorTooManyRequet
+		var wait time.Duration
+		if sec, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			wait = time.Duration(sec) * time.Second
+		}
+		return nil, wait, ErrorTooManyRequet
 	}
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
 		bs, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			return nil, xerrors.Errorf("API response with code: %d, %s", resp.StatusCode, err)
+			return nil, 0, xerrors.Errorf("API response with code: %d, %s", resp.StatusCode, err)
 		}
-		return nil, fmt.Errorf("API response with code: %d, response: %s", resp.StatusCode, string(bs))
+		return nil, 0, fmt.Errorf("API response with code: %d, response: %s", resp.StatusCode, string(bs))
 	}
 	var gResp response
 	if err := json.NewDecoder(resp.Body).Decode(&gResp); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	var resErr error
 	if len(gResp.Errors) > 0 {
-		resErr = gResp.Errors
+		return gResp.Data, gResp.Errors.waitTime(), gResp.Errors
 	}
 	if isQuery && cli.limiter != nil {
 		var res struct {
@@ -112,13 +226,61 @@ func (cli *Client) Do(ctx context.Context, pa *Payload) (json.RawMessage, error)
 			cli.limiter.announceRemainingCost(res.Budget.Remaining)
 		}
 	}
-	return gResp.Data, resErr
+	return gResp.Data, 0, nil
+}
+
+// setHeaders sets the token, the User-Agent and the custom headers to the request
+func (cli *Client) setHeaders(req *http.Request) {
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cli.token))
+	req.Header.Set("User-Agent", cli.userAgent)
+	for k, vs := range cli.headers {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+}
+
+// Get sends the GET request with the token for the path, like "/attachments/1", on
+// the origin of the endpoint. It is used for resources served outside of the API
+// such as attachments. The caller should close the body of the response.
+func (cli *Client) Get(ctx context.Context, path string) (*http.Response, error) {
+	u, err := url.Parse(cli.endpoint)
+	if err != nil || u.Host == "" {
+		return nil, xerrors.Errorf("failed to cli.Get: invalid endpoint: %q", cli.endpoint)
+	}
+	ref, err := url.Parse(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to cli.Get: %w", err)
+	}
+	u = u.ResolveReference(ref)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to cli.Get: %w", err)
+	}
+	cli.setHeaders(req)
+
+	resp, err := cli.cli.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to cli.Get: %w", err)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		resp.Body.Close()
+		return nil, ErrorTooManyRequet
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("response of %s with code: %d, response: %s", u, resp.StatusCode, string(bs))
+	}
+	return resp, nil
 }
 
 // Payload is GraphQL payload
 type Payload struct {
 	Query     string      `json:"query"`
 	Variables interface{} `json:"variables,omitempty"`
+	// Idempotent marks the mutation as safe to retry. Queries are always retried.
+	Idempotent bool `json:"-"`
 }
 
 type response struct {
@@ -128,5 +290,9 @@ type response struct {
 
 // Test for create test client for using testing only
 func Test(cli Doer) *Client {
-	return &Client{cli: cli}
+	return &Client{
+		cli:          cli,
+		maxRetries:   defaultMaxRetries,
+		retryTimeout: defaultRetryTimeout,
+	}
 }
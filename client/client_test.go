@@ -1,8 +1,17 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
 )
 
 func TestClient_unmarshalErrorResponse(t *testing.T) {
@@ -48,3 +57,194 @@ func TestClient_unmarshalErrorResponse(t *testing.T) {
 		t.Errorf("gResp.Errors something went wrong: %#v", gResp.Errors)
 	}
 }
+
+type sequenceDoer struct {
+	responses []*http.Response
+	requested int
+}
+
+func (sd *sequenceDoer) Do(req *http.Request) (*http.Response, error) {
+	resp := sd.responses[sd.requested%len(sd.responses)]
+	sd.requested++
+	return resp, nil
+}
+
+func newResponse(code int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: code,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+const rateLimitedResponse = `{
+  "errors": [{
+    "message": "request limit exceeded",
+    "extensions": {
+      "code": "REQUEST_LIMIT_EXCEEDED",
+      "waitMilliseconds": %d
+    }
+  }]
+}`
+
+func TestClient_Do_retry(t *testing.T) {
+	t.Run("query", func(t *testing.T) {
+		tooMany := newResponse(http.StatusTooManyRequests, "")
+		tooMany.Header.Set("Retry-After", "1")
+		sd := &sequenceDoer{responses: []*http.Response{
+			newResponse(http.StatusOK, fmt.Sprintf(rateLimitedResponse, 10)),
+			tooMany,
+			newResponse(http.StatusOK, `{"data": {"note": {"title": "hello"}}}`),
+		}}
+		cli := Test(sd)
+		cli.retryTimeout = 3 * time.Second
+		data, err := cli.Do(context.Background(), &Payload{Query: `{ note(id: "xxx") { title } }`})
+		if err != nil {
+			t.Errorf("error should be nil, but: %s", err)
+		}
+		if sd.requested != 3 {
+			t.Errorf("requested = %d, expect: 3", sd.requested)
+		}
+		if !strings.Contains(string(data), "hello") {
+			t.Errorf("unexpected data: %s", string(data))
+		}
+	})
+
+	t.Run("non idempotent mutation", func(t *testing.T) {
+		sd := &sequenceDoer{responses: []*http.Response{
+			newResponse(http.StatusOK, fmt.Sprintf(rateLimitedResponse, 10)),
+		}}
+		_, err := Test(sd).Do(context.Background(), &Payload{Query: `mutation { createNote { id } }`})
+		if err == nil {
+			t.Errorf("error should be occurred")
+		}
+		if sd.requested != 1 {
+			t.Errorf("requested = %d, expect: 1", sd.requested)
+		}
+	})
+
+	t.Run("budget will not recover", func(t *testing.T) {
+		sd := &sequenceDoer{responses: []*http.Response{
+			newResponse(http.StatusOK, fmt.Sprintf(rateLimitedResponse, 3600*1000)),
+		}}
+		_, err := Test(sd).Do(context.Background(), &Payload{Query: `{ note(id: "xxx") { title } }`})
+		if err == nil || !strings.Contains(err.Error(), "will not recover") {
+			t.Errorf("error should be occurred, but: %v", err)
+		}
+		var errs Errors
+		if !xerrors.As(err, &errs) || errs[0].Extensions.Code != RequestLimitExceeded {
+			t.Errorf("error should wrap the original errors, but: %#v", err)
+		}
+		if sd.requested != 1 {
+			t.Errorf("requested = %d, expect: 1", sd.requested)
+		}
+	})
+}
+
+func TestNew_options(t *testing.T) {
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		fmt.Fprint(w, `{"data": {"note": {"title": "hello"}}}`)
+	}))
+	defer ts.Close()
+
+	cli, err := New("0.0.1", "example", "secret",
+		WithEndpoint(ts.URL),
+		WithTimeout(time.Second),
+		WithHeader("X-Gateway-Key", "gateway"),
+		WithRateLimit(time.Second, 5),
+	)
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if _, err := cli.Do(context.Background(), &Payload{Query: `{ note(id: "xxx") { title } }`}); err != nil {
+		t.Errorf("error should be nil, but: %s", err)
+	}
+	if v := got.Get("Authorization"); v != "Bearer secret" {
+		t.Errorf("Authorization = %q, expect: %q", v, "Bearer secret")
+	}
+	if v := got.Get("X-Gateway-Key"); v != "gateway" {
+		t.Errorf("X-Gateway-Key = %q, expect: %q", v, "gateway")
+	}
+
+	if _, err := New("0.0.1", "example", "secret", WithRateLimit(time.Second, 0)); err == nil {
+		t.Errorf("invalid rate limit should be an error")
+	}
+}
+
+func TestClient_Get(t *testing.T) {
+	var (
+		gotPath string
+		gotAuth string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		if r.URL.Path != "/attachments/1" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "PNG")
+	}))
+	defer ts.Close()
+
+	cli, err := New("0.0.1", "example", "secret", WithEndpoint(ts.URL+"/api/v1"))
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	resp, err := cli.Get(context.Background(), "/attachments/1")
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "PNG" {
+		t.Errorf("body = %q, expect: %q", body, "PNG")
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("Authorization = %q, expect: %q", gotAuth, "Bearer secret")
+	}
+
+	if _, err := cli.Get(context.Background(), "/attachments/2"); err == nil {
+		t.Errorf("error should be occurred for 404")
+	}
+	if gotPath != "/attachments/2" {
+		t.Errorf("path = %q, expect: %q", gotPath, "/attachments/2")
+	}
+}
+
+func TestClient_prepare(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		isQuery bool
+		budget  int
+	}{
+		{"query", `query($id: ID!) { note(id: $id) { title } }`, true, 1},
+		{"shorthand", `{ groups { totalCount } }`, true, 1},
+		{"budget selected", `{ groups { totalCount } budget { remaining } }`, true, 1},
+		{"mutation", `mutation($input: CreateNoteInput!) { createNote(input: $input) { note { id } } }`, false, 0},
+	}
+	cli := Test(nil)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pq, err := cli.prepare(tc.input)
+			if err != nil {
+				t.Fatalf("error should be nil, but: %s", err)
+			}
+			if pq.isQuery != tc.isQuery {
+				t.Errorf("isQuery = %t, expect: %t", pq.isQuery, tc.isQuery)
+			}
+			if c := strings.Count(pq.query, "budget"); c != tc.budget {
+				t.Errorf("budget should be selected %d times, but %d times:\n%s", tc.budget, c, pq.query)
+			}
+			if cached, _ := cli.prepare(tc.input); cached != pq {
+				t.Errorf("prepared query should be cached")
+			}
+		})
+	}
+
+	if _, err := cli.prepare(`{ note(id: "x") { title }`); err == nil {
+		t.Errorf("error should be occurred for malformed queries")
+	}
+}
@@ -3,6 +3,9 @@ package client
 import (
 	"errors"
 	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
 )
 
 // ErrorTooManyRequet is an error representing too many request
@@ -35,6 +38,36 @@ func (e Errors) Error() string {
 	return strings.Join(errs, "\n")
 }
 
+// waitTime returns the longest wait time advised by the errors
+func (e Errors) waitTime() time.Duration {
+	var wait time.Duration
+	for _, er := range e {
+		w := time.Duration(er.Extensions.WaitMilliSecondes) * time.Millisecond
+		if w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+func (e Errors) rateLimited() bool {
+	for _, er := range e {
+		switch er.Extensions.Code {
+		case RequestLimitExceeded, TokenBudgetExhausted, TeamBudgetExhausted:
+			return true
+		}
+	}
+	return false
+}
+
+func isRateLimited(err error) bool {
+	if xerrors.Is(err, ErrorTooManyRequet) {
+		return true
+	}
+	var errs Errors
+	return xerrors.As(err, &errs) && errs.rateLimited()
+}
+
 // Error is error type for GraphQL request
 type Error struct {
 	Message    string          `json:"message"`
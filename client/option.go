@@ -0,0 +1,60 @@
+package client
+
+import (
+	"net/http"
+	"time"
+)
+
+type options struct {
+	endpoint    string
+	transport   http.RoundTripper
+	timeout     time.Duration
+	headers     http.Header
+	reqInterval time.Duration
+	reqLimit    int
+}
+
+// Option is an option for New
+type Option func(*options)
+
+// WithEndpoint specifies the endpoint URL of the API instead of https://{team}.kibe.la/api/v1.
+// It is useful for mock servers or gateways.
+func WithEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.endpoint = endpoint
+	}
+}
+
+// WithTransport specifies the http.RoundTripper used under the rate limiter.
+// http.DefaultTransport is used by default.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = rt
+	}
+}
+
+// WithTimeout specifies the time limit for each request
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithHeader adds the custom header to each request
+func WithHeader(key, value string) Option {
+	return func(o *options) {
+		if o.headers == nil {
+			o.headers = make(http.Header)
+		}
+		o.headers.Add(key, value)
+	}
+}
+
+// WithRateLimit specifies the rate limit as limit requests per interval.
+// The default is 10 requests per second, which is the limit of Kibela API.
+func WithRateLimit(interval time.Duration, limit int) Option {
+	return func(o *options) {
+		o.reqInterval = interval
+		o.reqLimit = limit
+	}
+}
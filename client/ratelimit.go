@@ -33,15 +33,20 @@ func (rt *rateLimitRoundTripper) announceRemainingCost(remaining int) {
 	const minimumCost = 10000
 	if remaining < minimumCost {
 		rt.setRequestAfter(
-			time.Now().Add(time.Millisecond * time.Duration(remaining-minimumCost)),
+			time.Now().Add(time.Millisecond * time.Duration(minimumCost-remaining)),
 		)
 	}
 }
 
+// setRequestAfter postpones the following requests until the ti. Since responses of
+// concurrent requests may announce the budgets out of order, it never brings the time
+// forward.
 func (rt *rateLimitRoundTripper) setRequestAfter(ti time.Time) {
 	rt.mu.Lock()
 	defer rt.mu.Unlock()
-	rt.requestAfter = ti
+	if ti.After(rt.requestAfter) {
+		rt.requestAfter = ti
+	}
 }
 
 func (rt *rateLimitRoundTripper) canRequestAfter() time.Time {
@@ -50,22 +55,24 @@ func (rt *rateLimitRoundTripper) canRequestAfter() time.Time {
 	return rt.requestAfter
 }
 
-func newRateLimitRoundTripper() *rateLimitRoundTripper {
+func newRateLimitRoundTripper(transport http.RoundTripper, interval time.Duration, limit int) *rateLimitRoundTripper {
 	return &rateLimitRoundTripper{
-		l:         rate.NewLimiter(rate.Every(reqInterval/time.Duration(reqLimit)), reqLimit),
-		transport: http.DefaultTransport,
+		l:         rate.NewLimiter(rate.Every(interval/time.Duration(limit)), limit),
+		transport: transport,
 	}
 }
 
 func (rt *rateLimitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	ctx := req.Context()
-	if err := rt.l.Wait(ctx); err != nil {
-		return nil, err
-	}
+	// Wait for recovering the budget before taking a token of the rate limiter, so that
+	// concurrent requests waiting for the budget don't burst at once after the recovery.
 	select {
 	case <-time.After(time.Until(rt.canRequestAfter())):
-		return rt.transport.RoundTrip(req)
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
+	if err := rt.l.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return rt.transport.RoundTrip(req)
 }
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimitRoundTripper_announceRemainingCost(t *testing.T) {
+	rt := newRateLimitRoundTripper(http.DefaultTransport, reqInterval, reqLimit)
+	rt.announceRemainingCost(20000)
+	if !rt.canRequestAfter().IsZero() {
+		t.Errorf("requests should not be postponed when the budget remains enough")
+	}
+
+	before := time.Now()
+	rt.announceRemainingCost(9000)
+	after := rt.canRequestAfter()
+	if d := after.Sub(before); d < time.Second || d > 2*time.Second {
+		t.Errorf("requests should be postponed about 1 second until recovering the budget, but: %s", d)
+	}
+
+	// the later announcement of the larger remaining should not bring the time forward
+	rt.announceRemainingCost(9900)
+	if !rt.canRequestAfter().Equal(after) {
+		t.Errorf("requestAfter should not be brought forward")
+	}
+}
@@ -10,9 +10,11 @@ import (
 
 func main() {
 	log.SetFlags(0)
-	err := kibelasync.Run(os.Args[1:], os.Stdout, os.Stderr)
+	err := kibelasync.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
 	if err != nil && err != flag.ErrHelp {
-		log.Println(err)
+		if msg := err.Error(); msg != "" {
+			log.Println(msg)
+		}
 		exitCode := 1
 		if ecoder, ok := err.(interface{ ExitCode() int }); ok {
 			exitCode = ecoder.ExitCode()
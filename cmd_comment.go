@@ -0,0 +1,101 @@
+package kibelasync
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/konifar/kibelasync/kibela"
+	"golang.org/x/xerrors"
+)
+
+type cmdComment struct{}
+
+func (cc *cmdComment) name() string {
+	return "comment"
+}
+
+func (cc *cmdComment) description() string {
+	return "post, edit or delete a comment"
+}
+
+const commentUsage = `usage:
+  kibelasync comment [note number, md file or URL] [file]
+  kibelasync comment -edit [comment number or URL] [file]
+  kibelasync comment -delete [-yes] [comment number or URL]`
+
+func (cc *cmdComment) run(ctx context.Context, argv []string, inStream io.Reader, outStream io.Writer, errStream io.Writer) error {
+	fs := flag.NewFlagSet("kibelasync comment", flag.ContinueOnError)
+	fs.SetOutput(errStream)
+	var (
+		edit = fs.Bool("edit", false, "edit the comment instead of posting a new one")
+		del  = fs.Bool("delete", false, "delete the comment")
+		yes  = fs.Bool("yes", false, "delete without confirmation")
+		dir  = fs.String("dir", profileFrom(ctx).dir(), "sync directory")
+	)
+	if err := fs.Parse(argv); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 || (*edit && *del) || (*del && fs.NArg() > 1) {
+		return xerrors.New(commentUsage)
+	}
+	arg := fs.Arg(0)
+	teams, err := newTeams(ctx)
+	if err != nil {
+		return err
+	}
+	ki, _, err := teams.Resolve(*dir, arg)
+	if err != nil {
+		return err
+	}
+
+	if *del {
+		var confirm func(*kibela.Comment) (bool, error)
+		if !*yes {
+			r := bufio.NewReader(inStream)
+			confirm = func(c *kibela.Comment) (bool, error) {
+				num, _ := c.ID.Number()
+				summary := strings.SplitN(strings.TrimSpace(c.Content), "\n", 2)[0]
+				return askYesNo(r, errStream, fmt.Sprintf("delete comment %d by %s %q?", num, c.Author.Account, summary))
+			}
+		}
+		c, err := ki.DeleteComment(ctx, arg, confirm)
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			log.Printf("deleted %s", c.URL)
+		}
+		return nil
+	}
+
+	r := inStream
+	if f := fs.Arg(1); f != "" {
+		f, err := os.Open(f)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	content, err := kibela.ReadCommentContent(r)
+	if err != nil {
+		return err
+	}
+	var c *kibela.Comment
+	if *edit {
+		c, err = ki.UpdateComment(ctx, arg, content)
+	} else {
+		c, err = ki.PostComment(ctx, arg, content)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(outStream, c.URL)
+	return nil
+}
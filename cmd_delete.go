@@ -0,0 +1,72 @@
+package kibelasync
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/konifar/kibelasync/kibela"
+	"golang.org/x/xerrors"
+)
+
+type cmdDelete struct{}
+
+func (cd *cmdDelete) name() string {
+	return "delete"
+}
+
+func (cd *cmdDelete) description() string {
+	return "delete notes"
+}
+
+func (cd *cmdDelete) run(ctx context.Context, argv []string, inStream io.Reader, outStream io.Writer, errStream io.Writer) error {
+	fs := flag.NewFlagSet("kibelasync delete", flag.ContinueOnError)
+	fs.SetOutput(errStream)
+	var (
+		yes   = fs.Bool("yes", false, "delete without confirmation")
+		trash = fs.Bool("trash", false, "move local files to .trash instead of removing them")
+		dir   = fs.String("dir", profileFrom(ctx).dir(), "sync directory")
+	)
+	if err := fs.Parse(argv); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return xerrors.New("usage: kibelasync delete [-yes] [-trash] [note numbers, md files or URLs]")
+	}
+	teams, err := newTeams(ctx)
+	if err != nil {
+		return err
+	}
+	var confirm func(*kibela.Note) (bool, error)
+	if !*yes {
+		r := bufio.NewReader(inStream)
+		confirm = func(n *kibela.Note) (bool, error) {
+			num, _ := n.ID.Number()
+			return askYesNo(r, errStream, fmt.Sprintf("delete note %d %q?", num, n.Title))
+		}
+	}
+	for _, arg := range fs.Args() {
+		ki, syncDir, err := teams.Resolve(*dir, arg)
+		if err != nil {
+			return err
+		}
+		if err := ki.DeleteNote(ctx, syncDir, arg, *trash, confirm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// askYesNo asks the question and reports whether it is answered with yes
+func askYesNo(r *bufio.Reader, w io.Writer, question string) (bool, error) {
+	fmt.Fprintf(w, "%s [y/N]: ", question)
+	ans, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	ans = strings.ToLower(strings.TrimSpace(ans))
+	return ans == "y" || ans == "yes", nil
+}
@@ -0,0 +1,76 @@
+package kibelasync
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/konifar/kibelasync/kibela/kibelatest"
+)
+
+func TestRun_deleteConfirmation(t *testing.T) {
+	ts := kibelatest.NewServer()
+	defer ts.Close()
+	home := ts.AddGroup("Home")
+	ts.AddNote(&kibelatest.Note{Title: "obsolete memo", Content: "bye\n", Groups: []*kibelatest.Group{home}})
+
+	tmpdir, err := ioutil.TempDir("", "kibelasync-cli-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	env := map[string]string{
+		"XDG_CONFIG_HOME":      tmpdir,
+		"KIBELA_TEAM":          ts.Team,
+		"KIBELA_TOKEN":         ts.Token,
+		"KIBELA_TOKEN_COMMAND": "",
+		"KIBELA_PROFILE":       "",
+		"KIBELA_DIR":           "",
+	}
+	for k, v := range env {
+		orig, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		defer func(k, orig string, ok bool) {
+			if ok {
+				os.Setenv(k, orig)
+			} else {
+				os.Unsetenv(k)
+			}
+		}(k, orig, ok)
+	}
+	dir := filepath.Join(tmpdir, "notes")
+	run := func(in string, args ...string) string {
+		t.Helper()
+		errStream := &bytes.Buffer{}
+		argv := append([]string{"-endpoint", ts.Endpoint()}, args...)
+		if err := Run(argv, strings.NewReader(in), ioutil.Discard, errStream); err != nil {
+			t.Fatalf("error should be nil, but: %s", err)
+		}
+		return errStream.String()
+	}
+	run("", "pull", "-dir", dir)
+	fpath := filepath.Join(dir, "1.md")
+
+	// the answer is read from the input stream
+	out := run("n\n", "delete", "-dir", dir, "1")
+	if !strings.Contains(out, `delete note 1 "obsolete memo"? [y/N]: `) {
+		t.Errorf("the confirmation should be asked, but: %q", out)
+	}
+	if _, ok := ts.Note(1); !ok {
+		t.Error("the note should not be deleted when declined")
+	}
+	if _, err := os.Stat(fpath); err != nil {
+		t.Errorf("the local file should be kept, but: %s", err)
+	}
+
+	run("y\n", "delete", "-dir", dir, "1")
+	if _, ok := ts.Note(1); ok {
+		t.Error("the note should be deleted")
+	}
+	if _, err := os.Stat(fpath); !os.IsNotExist(err) {
+		t.Errorf("the local file should be removed, but: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package kibelasync
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/konifar/kibelasync/kibela"
+	"golang.org/x/xerrors"
+)
+
+type cmdDiff struct{}
+
+func (cd *cmdDiff) name() string {
+	return "diff"
+}
+
+func (cd *cmdDiff) description() string {
+	return "show differences between markdowns and remote notes"
+}
+
+// exit status of diff subcommand is compatible with diff(1).
+// 0: no differences, 1: some differences were found, 2: trouble
+const (
+	diffExitDifferent = 1
+	diffExitTrouble   = 2
+)
+
+func (cd *cmdDiff) run(ctx context.Context, argv []string, inStream io.Reader, outStream io.Writer, errStream io.Writer) error {
+	fs := flag.NewFlagSet("kibelasync diff", flag.ContinueOnError)
+	fs.SetOutput(errStream)
+	var (
+		word = fs.Bool("word", false, "show word level differences")
+		dir  = fs.String("dir", profileFrom(ctx).dir(), "sync directory")
+	)
+	if err := fs.Parse(argv); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return &exitError{code: diffExitTrouble, err: xerrors.New("usage: kibelasync diff [md files, note numbers or URLs]")}
+	}
+
+	teams, err := newTeams(ctx)
+	if err != nil {
+		return &exitError{code: diffExitTrouble, err: err}
+	}
+	different := false
+	for _, arg := range fs.Args() {
+		ki, syncDir, err := teams.Resolve(*dir, arg)
+		if err != nil {
+			return &exitError{code: diffExitTrouble, err: err}
+		}
+		f, err := ki.LocalPath(syncDir, arg)
+		if err != nil {
+			return &exitError{code: diffExitTrouble, err: err}
+		}
+		md, err := kibela.LoadMD(f)
+		if err != nil {
+			return &exitError{code: diffExitTrouble, err: err}
+		}
+		d, err := ki.DiffMD(ctx, md, *word)
+		if err != nil {
+			return &exitError{code: diffExitTrouble, err: err}
+		}
+		if d != "" {
+			different = true
+			fmt.Fprint(outStream, d)
+		}
+	}
+	if different {
+		return &exitError{code: diffExitDifferent}
+	}
+	return nil
+}
@@ -19,25 +19,29 @@ func (cp *cmdPublish) description() string {
 	return "publish new markdown"
 }
 
-func (cp *cmdPublish) run(ctx context.Context, argv []string, outStream io.Writer, errStream io.Writer) error {
+func (cp *cmdPublish) run(ctx context.Context, argv []string, inStream io.Reader, outStream io.Writer, errStream io.Writer) error {
 	fs := flag.NewFlagSet("kibelasync publish", flag.ContinueOnError)
 	fs.SetOutput(errStream)
 	var (
 		title  = fs.String("title", "", "title of the note")
 		save   = fs.Bool("save", false, "save file after published the note")
 		coEdit = fs.Bool("co-edit", false, "co-editing on")
-		dir    = fs.String("dir", "notes", "sync directory")
+		dir    = fs.String("dir", profileFrom(ctx).dir(), "sync directory")
 	)
 	if err := fs.Parse(argv); err != nil {
 		return err
 	}
 	mdFile := fs.Arg(0)
-	ki, err := kibela.New(version)
+	teams, err := newTeams(ctx)
+	if err != nil {
+		return err
+	}
+	ki, syncDir, err := teams.Resolve(*dir, mdFile)
 	if err != nil {
 		return err
 	}
 
-	var r io.Reader = os.Stdin
+	r := inStream
 	if mdFile != "" {
 		var err error
 		f, err := os.Open(mdFile)
@@ -48,7 +52,7 @@ func (cp *cmdPublish) run(ctx context.Context, argv []string, outStream io.Write
 		r = f
 	}
 
-	m, err := kibela.NewMD(mdFile, r, *title, *coEdit, *dir)
+	m, err := kibela.NewMD(mdFile, r, *title, *coEdit, syncDir)
 	if err != nil {
 		return err
 	}
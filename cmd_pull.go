@@ -6,6 +6,7 @@ import (
 	"io"
 
 	"github.com/konifar/kibelasync/kibela"
+	"golang.org/x/xerrors"
 )
 
 type cmdPull struct{}
@@ -18,36 +19,168 @@ func (cp *cmdPull) description() string {
 	return "sync all markdowns"
 }
 
-func (cp *cmdPull) run(ctx context.Context, argv []string, outStream io.Writer, errStream io.Writer) error {
+func (cp *cmdPull) run(ctx context.Context, argv []string, inStream io.Reader, outStream io.Writer, errStream io.Writer) error {
 	fs := flag.NewFlagSet("kibelasync pull", flag.ContinueOnError)
 	var (
-		full   = fs.Bool("full", false, "pull every markdowns")
-		dir    = fs.String("dir", "notes", "sync directory")
-		folder = fs.String("folder", "", "folder in kibela")
-		limit  = fs.Int("limit", 0, "sync directory")
+		full     = fs.Bool("full", false, "pull every markdowns")
+		dir      = fs.String("dir", profileFrom(ctx).dir(), "sync directory")
+		folder   = fs.String("folder", profileFrom(ctx).Folder, "folder in kibela")
+		limit    = fs.Int("limit", 0, "sync directory")
+		rescan   = fs.Bool("rescan", false, "list every note ignoring the watermark of the last pull")
+		jobs     = fs.Int("jobs", 4, "number of notes fetched concurrently")
+		orphan   = fs.String("orphans", "", "action for local files of notes deleted on kibela: report, trash or delete")
+		team     = fs.String("team", "", "team to pull into {dir}/{team}")
+		allTeams = fs.Bool("all-teams", false, "pull every team in the profiles into {dir}/{team}")
+		layout   = fs.String("layout", profileFrom(ctx).Layout, "layout of the sync directory: flat or folder")
+		filename = fs.String("filename", profileFrom(ctx).Filename, "filename template like {id}-{slug}.md or {slug}.md")
+		comments = fs.Bool("comments", false, "pull comments of notes into {name}.comments.yaml")
+		attach   = fs.Bool("attachments", false, "download attachments into {dir}/attachments and link them by relative paths")
+		relink   = fs.Bool("links", false, "rewrite links to notes into relative paths of their local files")
 	)
 	fs.SetOutput(errStream)
 
 	if err := fs.Parse(argv); err != nil {
 		return err
 	}
+	folderSet, layoutSet, filenameSet := false, false, false
+	var attachments, links *bool
+	fs.Visit(func(f *flag.Flag) {
+		folderSet = folderSet || f.Name == "folder"
+		layoutSet = layoutSet || f.Name == "layout"
+		filenameSet = filenameSet || f.Name == "filename"
+		switch f.Name {
+		case "attachments":
+			attachments = attach
+		case "links":
+			links = relink
+		}
+	})
 
-	ki, err := kibela.New(version)
+	orphanAction, err := kibela.ParseOrphanAction(*orphan)
+	if err != nil {
+		return err
+	}
+	teams, err := newTeams(ctx)
 	if err != nil {
 		return err
 	}
 	args := fs.Args()
 	if len(args) > 0 {
+		if *comments {
+			return xerrors.New("-comments can't be used with notes specified")
+		}
 		for _, arg := range args {
-			if err := ki.PullNote(ctx, *dir, arg); err != nil {
+			var (
+				ki      *kibela.Kibela
+				syncDir string
+				err     error
+			)
+			if *team != "" {
+				ki, err = teams.Kibela(*team)
+				syncDir = teams.Dir(*dir, *team)
+			} else {
+				ki, syncDir, err = teams.Resolve(*dir, arg)
+			}
+			if err != nil {
+				return err
+			}
+			if err := setLayout(ki, syncDir, *layout, *filename, attachments, links); err != nil {
+				return err
+			}
+			if err := ki.PullNote(ctx, syncDir, arg); err != nil {
 				return err
 			}
 		}
 		return nil
 	}
 
-	if *full {
-		return ki.PullFullNotes(ctx, *dir, *folder, *limit)
+	if !*allTeams && *team == "" {
+		ki, syncDir, err := teams.Resolve(*dir, "")
+		if err != nil {
+			return err
+		}
+		if err := setLayout(ki, syncDir, *layout, *filename, attachments, links); err != nil {
+			return err
+		}
+		return pullNotes(ctx, ki, syncDir, *folder, *limit, *full, *rescan, *jobs, orphanAction, *comments)
+	}
+	pullTeams := []string{*team}
+	if *allTeams {
+		pullTeams = teams.Names()
+	}
+	for _, t := range pullTeams {
+		ki, err := teams.Kibela(t)
+		if err != nil {
+			return err
+		}
+		f, l, fn := *folder, *layout, *filename
+		if p := teams.Profile(t); p != nil {
+			// folders and layouts are per team
+			if !folderSet {
+				f = p.Folder
+			}
+			if !layoutSet {
+				l = p.Layout
+			}
+			if !filenameSet {
+				fn = p.Filename
+			}
+		}
+		syncDir := teams.Dir(*dir, t)
+		if err := setLayout(ki, syncDir, l, fn, attachments, links); err != nil {
+			return err
+		}
+		if err := pullNotes(ctx, ki, syncDir, f, *limit, *full, *rescan, *jobs, orphanAction, *comments); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pullNotes(ctx context.Context, ki *kibela.Kibela, dir, folder string, limit int, full, rescan bool, jobs int, orphan kibela.OrphanAction, comments bool) error {
+	var err error
+	if full {
+		err = ki.PullFullNotes(ctx, dir, folder, limit, orphan)
+	} else {
+		err = ki.PullNotes(ctx, dir, folder, limit, rescan, jobs, orphan)
+	}
+	if err != nil || !comments {
+		return err
+	}
+	return ki.PullComments(ctx, dir, folder, limit, jobs)
+}
+
+// setLayout sets the layout, the filename template, and whether to download attachments
+// and to rewrite links of the sync directory unless they are empty or nil, which keeps
+// the current ones
+func setLayout(ki *kibela.Kibela, dir, layout, filename string, attachments, links *bool) error {
+	if layout != "" {
+		l, err := kibela.ParseLayout(layout)
+		if err != nil {
+			return err
+		}
+		if err := ki.SetLayout(dir, l); err != nil {
+			return err
+		}
+	}
+	if filename != "" {
+		t, err := kibela.ParseFilenameTemplate(filename)
+		if err != nil {
+			return err
+		}
+		if err := ki.SetFilenameTemplate(dir, t); err != nil {
+			return err
+		}
+	}
+	if attachments != nil {
+		if err := ki.SetAttachments(dir, *attachments); err != nil {
+			return err
+		}
+	}
+	if links != nil {
+		if err := ki.SetLinks(dir, *links); err != nil {
+			return err
+		}
 	}
-	return ki.PullNotes(ctx, *dir, *folder, *limit)
+	return nil
 }
@@ -19,22 +19,32 @@ func (cp *cmdPush) description() string {
 	return "push markdown"
 }
 
-func (cp *cmdPush) run(ctx context.Context, argv []string, outStream io.Writer, errStream io.Writer) error {
+func (cp *cmdPush) run(ctx context.Context, argv []string, inStream io.Reader, outStream io.Writer, errStream io.Writer) error {
 	fs := flag.NewFlagSet("kibelasync push", flag.ContinueOnError)
 	fs.SetOutput(errStream)
-
+	var (
+		dir = fs.String("dir", profileFrom(ctx).dir(), "sync directory")
+	)
 	if err := fs.Parse(argv); err != nil {
 		return err
 	}
 
-	ki, err := kibela.New(version)
+	teams, err := newTeams(ctx)
 	if err != nil {
 		return err
 	}
 	if fs.NArg() < 1 {
-		return xerrors.New("usage: kibelasync push [md files]")
+		return xerrors.New("usage: kibelasync push [md files, note numbers or URLs]")
 	}
-	for _, f := range fs.Args() {
+	for _, arg := range fs.Args() {
+		ki, syncDir, err := teams.Resolve(*dir, arg)
+		if err != nil {
+			return err
+		}
+		f, err := ki.LocalPath(syncDir, arg)
+		if err != nil {
+			return err
+		}
 		md, err := kibela.LoadMD(f)
 		if err != nil {
 			return err
@@ -0,0 +1,74 @@
+package kibelasync
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/konifar/kibelasync/kibela"
+)
+
+type cmdStatus struct{}
+
+func (cs *cmdStatus) name() string {
+	return "status"
+}
+
+func (cs *cmdStatus) description() string {
+	return "show local and remote state of markdowns"
+}
+
+var statusOrder = []kibela.SyncStatus{
+	kibela.StatusModifiedLocally,
+	kibela.StatusUpdatedRemotely,
+	kibela.StatusConflict,
+	kibela.StatusUnpublished,
+	kibela.StatusDeletedRemotely,
+	kibela.StatusNotPulled,
+}
+
+func (cs *cmdStatus) run(ctx context.Context, argv []string, inStream io.Reader, outStream io.Writer, errStream io.Writer) error {
+	fs := flag.NewFlagSet("kibelasync status", flag.ContinueOnError)
+	fs.SetOutput(errStream)
+	var (
+		dir = fs.String("dir", profileFrom(ctx).dir(), "sync directory")
+	)
+	if err := fs.Parse(argv); err != nil {
+		return err
+	}
+
+	teams, err := newTeams(ctx)
+	if err != nil {
+		return err
+	}
+	ki, syncDir, err := teams.Resolve(*dir, "")
+	if err != nil {
+		return err
+	}
+	stats, err := ki.Status(ctx, syncDir)
+	if err != nil {
+		return err
+	}
+	grouped := make(map[kibela.SyncStatus][]*kibela.NoteStatus)
+	for _, st := range stats {
+		grouped[st.Status] = append(grouped[st.Status], st)
+	}
+	for _, s := range statusOrder {
+		sts := grouped[s]
+		if len(sts) == 0 {
+			continue
+		}
+		fmt.Fprintf(outStream, "%s:\n", s)
+		for _, st := range sts {
+			target := st.Path
+			if target == "" {
+				num, _ := st.ID.Number()
+				target = fmt.Sprintf("#%d (updated at %s)", num, st.RemoteUpdatedAt.Format("2006-01-02 15:04:05"))
+			}
+			fmt.Fprintf(outStream, "\t%s\n", target)
+		}
+		fmt.Fprintln(outStream)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package kibelasync
+
+import (
+	"context"
+	"flag"
+	"io"
+)
+
+type cmdSync struct{}
+
+func (cs *cmdSync) name() string {
+	return "sync"
+}
+
+func (cs *cmdSync) description() string {
+	return "pull and push markdowns in one pass"
+}
+
+func (cs *cmdSync) run(ctx context.Context, argv []string, inStream io.Reader, outStream io.Writer, errStream io.Writer) error {
+	fs := flag.NewFlagSet("kibelasync sync", flag.ContinueOnError)
+	fs.SetOutput(errStream)
+	var (
+		dir = fs.String("dir", profileFrom(ctx).dir(), "sync directory")
+	)
+	if err := fs.Parse(argv); err != nil {
+		return err
+	}
+
+	teams, err := newTeams(ctx)
+	if err != nil {
+		return err
+	}
+	ki, syncDir, err := teams.Resolve(*dir, "")
+	if err != nil {
+		return err
+	}
+	return ki.Sync(ctx, syncDir)
+}
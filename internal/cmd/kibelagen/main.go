@@ -0,0 +1,41 @@
+// Command kibelagen generates typed GraphQL operations. It is invoked by go generate.
+//
+//	//go:generate go run ../internal/cmd/kibelagen -config kibelagen.yaml
+//
+// With -update-schema, it downloads the published schema from the schemaURL before
+// generating, so that the operations are validated against the latest schema.
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"log"
+
+	"github.com/konifar/kibelasync/internal/kibelagen"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("kibelagen: ")
+	config := flag.String("config", "kibelagen.yaml", "path to the config file")
+	update := flag.Bool("update-schema", false, "download the schema from the schemaURL before generating")
+	flag.Parse()
+
+	c, err := kibelagen.LoadConfig(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *update {
+		if err := c.UpdateSchema(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}
+	src, err := c.Generate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(c.OutputPath(), src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,213 @@
+// Package graphql implements the subset of GraphQL used by kibelasync: a parser of
+// executable documents and values resolved with variables, a parser of schemas and
+// validation of documents against them.
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Document is a parsed GraphQL executable document
+type Document struct {
+	Operations []*Operation
+}
+
+// Operation returns the operation by the name. When the name is empty, the document
+// must have only one operation.
+func (d *Document) Operation(name string) (*Operation, error) {
+	if name == "" {
+		if len(d.Operations) != 1 {
+			return nil, fmt.Errorf("operation name is required for the document with %d operations", len(d.Operations))
+		}
+		return d.Operations[0], nil
+	}
+	for _, op := range d.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation named %q", name)
+}
+
+// OperationType is "query" or "mutation"
+type OperationType string
+
+// OperationTypes
+const (
+	Query    OperationType = "query"
+	Mutation OperationType = "mutation"
+)
+
+// Operation is an operation definition
+type Operation struct {
+	Type                OperationType
+	Name                string
+	VariableDefinitions []*VariableDefinition
+	SelectionSet        []*Field
+	Pos                 Position
+}
+
+// VariableDefinition is a definition of a variable of an operation
+type VariableDefinition struct {
+	Name    string
+	Type    *Type
+	Default *Value
+	Pos     Position
+}
+
+// Type is a type reference like `[ID!]!`
+type Type struct {
+	// Name is the name of the named type. It is empty for list types.
+	Name    string
+	Elem    *Type
+	NonNull bool
+}
+
+func (t *Type) String() string {
+	s := t.Name
+	if t.Elem != nil {
+		s = "[" + t.Elem.String() + "]"
+	}
+	if t.NonNull {
+		s += "!"
+	}
+	return s
+}
+
+// NamedType returns the innermost named type
+func (t *Type) NamedType() string {
+	for t.Elem != nil {
+		t = t.Elem
+	}
+	return t.Name
+}
+
+// Field is a field selection
+type Field struct {
+	Alias        string
+	Name         string
+	Arguments    []*Argument
+	SelectionSet []*Field
+	Pos          Position
+}
+
+// ResponseKey returns the key of the field in the response, that is the alias if exists
+func (f *Field) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// Argument is an argument of a field
+type Argument struct {
+	Name  string
+	Value *Value
+	Pos   Position
+}
+
+// ValueKind is a kind of values
+type ValueKind int
+
+// ValueKinds
+const (
+	VariableValue ValueKind = iota
+	IntValue
+	FloatValue
+	StringValue
+	BooleanValue
+	NullValue
+	EnumValue
+	ListValue
+	ObjectValue
+)
+
+// Value is an input value
+type Value struct {
+	Kind ValueKind
+	// Raw is the variable name, the literal of scalars or the enum name
+	Raw    string
+	List   []*Value
+	Fields []*ObjectField
+	Pos    Position
+}
+
+// ObjectField is a field of object values
+type ObjectField struct {
+	Name  string
+	Value *Value
+}
+
+// Resolve converts the value into the same form as values decoded by encoding/json
+// with substituting variables. Enum values are resolved to strings.
+func (v *Value) Resolve(vars map[string]interface{}) (interface{}, error) {
+	switch v.Kind {
+	case VariableValue:
+		val, ok := vars[v.Raw]
+		if !ok {
+			return nil, nil
+		}
+		return val, nil
+	case IntValue, FloatValue:
+		return strconv.ParseFloat(v.Raw, 64)
+	case StringValue, EnumValue:
+		return v.Raw, nil
+	case BooleanValue:
+		return v.Raw == "true", nil
+	case NullValue:
+		return nil, nil
+	case ListValue:
+		list := make([]interface{}, len(v.List))
+		for i, item := range v.List {
+			val, err := item.Resolve(vars)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = val
+		}
+		return list, nil
+	case ObjectValue:
+		obj := make(map[string]interface{}, len(v.Fields))
+		for _, f := range v.Fields {
+			val, err := f.Value.Resolve(vars)
+			if err != nil {
+				return nil, err
+			}
+			obj[f.Name] = val
+		}
+		return obj, nil
+	}
+	return nil, fmt.Errorf("unknown value kind: %d", v.Kind)
+}
+
+// Variables returns the names of variables referred in the value
+func (v *Value) Variables() []string {
+	switch v.Kind {
+	case VariableValue:
+		return []string{v.Raw}
+	case ListValue:
+		var names []string
+		for _, item := range v.List {
+			names = append(names, item.Variables()...)
+		}
+		return names
+	case ObjectValue:
+		var names []string
+		for _, f := range v.Fields {
+			names = append(names, f.Value.Variables()...)
+		}
+		return names
+	}
+	return nil
+}
+
+// SyntaxError is an error of parsing
+type SyntaxError struct {
+	Pos     Position
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %s: %s", e.Pos, e.Message)
+}
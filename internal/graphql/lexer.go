@@ -0,0 +1,293 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "EOF"
+	case tokenPunct:
+		return "punctuator"
+	case tokenName:
+		return "name"
+	case tokenInt:
+		return "int"
+	case tokenFloat:
+		return "float"
+	case tokenString:
+		return "string"
+	}
+	return "unknown"
+}
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   Position
+}
+
+// Position is a position in the source
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// lexer tokenizes GraphQL documents
+// ref. https://spec.graphql.org/June2018/#sec-Language.Source-Text
+type lexer struct {
+	src       string
+	offset    int
+	line, col int
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: src, line: 1, col: 1}
+}
+
+func (l *lexer) errorf(pos Position, format string, args ...interface{}) error {
+	return &SyntaxError{Pos: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+func (l *lexer) peekByte(n int) byte {
+	if l.offset+n < len(l.src) {
+		return l.src[l.offset+n]
+	}
+	return 0
+}
+
+func (l *lexer) advance(n int) {
+	for i := 0; i < n && l.offset < len(l.src); i++ {
+		if l.src[l.offset] == '\n' {
+			l.line++
+			l.col = 1
+		} else if l.src[l.offset]&0xC0 != 0x80 {
+			// count columns by runes
+			l.col++
+		}
+		l.offset++
+	}
+}
+
+const bom = "\ufeff"
+
+func (l *lexer) skipIgnored() {
+	for l.offset < len(l.src) {
+		switch c := l.src[l.offset]; c {
+		case ' ', '\t', '\n', '\r', ',':
+			l.advance(1)
+		case '#':
+			for l.offset < len(l.src) && l.src[l.offset] != '\n' {
+				l.advance(1)
+			}
+		default:
+			if strings.HasPrefix(l.src[l.offset:], bom) {
+				l.advance(len(bom))
+				continue
+			}
+			return
+		}
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipIgnored()
+	pos := Position{Line: l.line, Column: l.col}
+	if l.offset >= len(l.src) {
+		return token{kind: tokenEOF, pos: pos}, nil
+	}
+	c := l.src[l.offset]
+	switch {
+	case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+		l.advance(1)
+		return token{kind: tokenPunct, value: string(c), pos: pos}, nil
+	case c == '.':
+		if strings.HasPrefix(l.src[l.offset:], "...") {
+			l.advance(3)
+			return token{kind: tokenPunct, value: "...", pos: pos}, nil
+		}
+		return token{}, l.errorf(pos, "unexpected character %q", c)
+	case c == '_' || isLetter(c):
+		start := l.offset
+		for l.offset < len(l.src) && (l.src[l.offset] == '_' || isLetter(l.src[l.offset]) || isDigit(l.src[l.offset])) {
+			l.advance(1)
+		}
+		return token{kind: tokenName, value: l.src[start:l.offset], pos: pos}, nil
+	case c == '-' || isDigit(c):
+		return l.number(pos)
+	case c == '"':
+		if strings.HasPrefix(l.src[l.offset:], `"""`) {
+			return l.blockString(pos)
+		}
+		return l.string(pos)
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.offset:])
+	return token{}, l.errorf(pos, "unexpected character %q", r)
+}
+
+func (l *lexer) number(pos Position) (token, error) {
+	start := l.offset
+	kind := tokenInt
+	if l.peekByte(0) == '-' {
+		l.advance(1)
+	}
+	digits := func() error {
+		if !isDigit(l.peekByte(0)) {
+			return l.errorf(Position{Line: l.line, Column: l.col}, "invalid number")
+		}
+		for isDigit(l.peekByte(0)) {
+			l.advance(1)
+		}
+		return nil
+	}
+	if err := digits(); err != nil {
+		return token{}, err
+	}
+	if l.peekByte(0) == '.' {
+		kind = tokenFloat
+		l.advance(1)
+		if err := digits(); err != nil {
+			return token{}, err
+		}
+	}
+	if c := l.peekByte(0); c == 'e' || c == 'E' {
+		kind = tokenFloat
+		l.advance(1)
+		if c := l.peekByte(0); c == '+' || c == '-' {
+			l.advance(1)
+		}
+		if err := digits(); err != nil {
+			return token{}, err
+		}
+	}
+	return token{kind: kind, value: l.src[start:l.offset], pos: pos}, nil
+}
+
+func (l *lexer) string(pos Position) (token, error) {
+	l.advance(1)
+	buf := &strings.Builder{}
+	for {
+		if l.offset >= len(l.src) {
+			return token{}, l.errorf(pos, "unterminated string")
+		}
+		c := l.src[l.offset]
+		switch c {
+		case '"':
+			l.advance(1)
+			return token{kind: tokenString, value: buf.String(), pos: pos}, nil
+		case '\n', '\r':
+			return token{}, l.errorf(pos, "unterminated string")
+		case '\\':
+			esc := l.peekByte(1)
+			switch esc {
+			case '"', '\\', '/':
+				buf.WriteByte(esc)
+			case 'b':
+				buf.WriteByte('\b')
+			case 'f':
+				buf.WriteByte('\f')
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 't':
+				buf.WriteByte('\t')
+			case 'u':
+				if l.offset+6 > len(l.src) {
+					return token{}, l.errorf(pos, "invalid unicode escape")
+				}
+				var r rune
+				if _, err := fmt.Sscanf(l.src[l.offset+2:l.offset+6], "%04x", &r); err != nil {
+					return token{}, l.errorf(pos, "invalid unicode escape")
+				}
+				buf.WriteRune(r)
+				l.advance(4)
+			default:
+				return token{}, l.errorf(pos, "invalid escape sequence \\%c", esc)
+			}
+			l.advance(2)
+		default:
+			_, size := utf8.DecodeRuneInString(l.src[l.offset:])
+			buf.WriteString(l.src[l.offset : l.offset+size])
+			l.advance(size)
+		}
+	}
+}
+
+func (l *lexer) blockString(pos Position) (token, error) {
+	l.advance(3)
+	buf := &strings.Builder{}
+	for {
+		if l.offset >= len(l.src) {
+			return token{}, l.errorf(pos, "unterminated block string")
+		}
+		rest := l.src[l.offset:]
+		switch {
+		case strings.HasPrefix(rest, `"""`):
+			l.advance(3)
+			return token{kind: tokenString, value: blockStringValue(buf.String()), pos: pos}, nil
+		case strings.HasPrefix(rest, `\"""`):
+			buf.WriteString(`"""`)
+			l.advance(4)
+		default:
+			_, size := utf8.DecodeRuneInString(rest)
+			buf.WriteString(rest[:size])
+			l.advance(size)
+		}
+	}
+}
+
+// blockStringValue removes the common indentation and the leading and trailing blank lines
+// ref. https://spec.graphql.org/June2018/#BlockStringValue()
+func blockStringValue(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	common := -1
+	for _, line := range lines[1:] {
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < len(line) && (common < 0 || indent < common) {
+			common = indent
+		}
+	}
+	if common > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= common {
+				lines[i] = lines[i][common:]
+			} else {
+				lines[i] = ""
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
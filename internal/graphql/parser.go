@@ -0,0 +1,361 @@
+package graphql
+
+import "fmt"
+
+// Parse parses the GraphQL executable document. Fragments and directives are not
+// supported since kibelasync doesn't use them.
+func Parse(src string) (*Document, error) {
+	p, err := newParser(src)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{}
+	for p.tok.kind != tokenEOF {
+		op, err := p.parseOperation()
+		if err != nil {
+			return nil, err
+		}
+		doc.Operations = append(doc.Operations, op)
+	}
+	if len(doc.Operations) == 0 {
+		return nil, p.errorf("empty document")
+	}
+	return doc, nil
+}
+
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+func newParser(src string) (*parser, error) {
+	p := &parser{lex: newLexer(src)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Pos: p.tok.pos, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokenEOF {
+		return p.errorf("unexpected EOF")
+	}
+	return p.errorf("unexpected %s %q", p.tok.kind, p.tok.value)
+}
+
+func (p *parser) peekPunct(punct string) bool {
+	return p.tok.kind == tokenPunct && p.tok.value == punct
+}
+
+func (p *parser) skipPunct(punct string) (bool, error) {
+	if !p.peekPunct(punct) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *parser) expectPunct(punct string) error {
+	if !p.peekPunct(punct) {
+		return p.errorf("expected %q, but got %s %q", punct, p.tok.kind, p.tok.value)
+	}
+	return p.advance()
+}
+
+func (p *parser) expectName() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.errorf("expected name, but got %s %q", p.tok.kind, p.tok.value)
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *parser) parseOperation() (*Operation, error) {
+	op := &Operation{Type: Query, Pos: p.tok.pos}
+	if p.peekPunct("{") {
+		// query shorthand
+		sels, err := p.parseSelectionSet()
+		if err != nil {
+			return nil, err
+		}
+		op.SelectionSet = sels
+		return op, nil
+	}
+	if p.tok.kind != tokenName {
+		return nil, p.unexpected()
+	}
+	switch p.tok.value {
+	case "query", "mutation":
+		op.Type = OperationType(p.tok.value)
+	case "fragment":
+		return nil, p.errorf("fragments are not supported")
+	default:
+		return nil, p.errorf("unsupported operation type %q", p.tok.value)
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokenName {
+		op.Name = p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peekPunct("(") {
+		defs, err := p.parseVariableDefinitions()
+		if err != nil {
+			return nil, err
+		}
+		op.VariableDefinitions = defs
+	}
+	if p.peekPunct("@") {
+		return nil, p.errorf("directives are not supported")
+	}
+	sels, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.SelectionSet = sels
+	return op, nil
+}
+
+func (p *parser) parseVariableDefinitions() ([]*VariableDefinition, error) {
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	var defs []*VariableDefinition
+	for {
+		if ok, err := p.skipPunct(")"); err != nil || ok {
+			return defs, err
+		}
+		def := &VariableDefinition{Pos: p.tok.pos}
+		if err := p.expectPunct("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		def.Name = name
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		if def.Type, err = p.parseType(); err != nil {
+			return nil, err
+		}
+		if ok, err := p.skipPunct("="); err != nil {
+			return nil, err
+		} else if ok {
+			if def.Default, err = p.parseValue(true); err != nil {
+				return nil, err
+			}
+		}
+		defs = append(defs, def)
+	}
+}
+
+func (p *parser) parseType() (*Type, error) {
+	var t *Type
+	if ok, err := p.skipPunct("["); err != nil {
+		return nil, err
+	} else if ok {
+		elem, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct("]"); err != nil {
+			return nil, err
+		}
+		t = &Type{Elem: elem}
+	} else {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		t = &Type{Name: name}
+	}
+	ok, err := p.skipPunct("!")
+	if err != nil {
+		return nil, err
+	}
+	t.NonNull = ok
+	return t, nil
+}
+
+func (p *parser) parseSelectionSet() ([]*Field, error) {
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+	var fields []*Field
+	for {
+		if ok, err := p.skipPunct("}"); err != nil {
+			return nil, err
+		} else if ok {
+			if len(fields) == 0 {
+				return nil, p.errorf("empty selection set")
+			}
+			return fields, nil
+		}
+		if p.peekPunct("...") {
+			return nil, p.errorf("fragments are not supported")
+		}
+		f, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+}
+
+func (p *parser) parseField() (*Field, error) {
+	f := &Field{Pos: p.tok.pos}
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := p.skipPunct(":"); err != nil {
+		return nil, err
+	} else if ok {
+		f.Alias = name
+		if name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+	}
+	f.Name = name
+	if p.peekPunct("(") {
+		if f.Arguments, err = p.parseArguments(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peekPunct("@") {
+		return nil, p.errorf("directives are not supported")
+	}
+	if p.peekPunct("{") {
+		if f.SelectionSet, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p *parser) parseArguments() ([]*Argument, error) {
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	var args []*Argument
+	for {
+		if ok, err := p.skipPunct(")"); err != nil || ok {
+			if ok && len(args) == 0 {
+				return nil, p.errorf("empty arguments")
+			}
+			return args, err
+		}
+		arg := &Argument{Pos: p.tok.pos}
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		arg.Name = name
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		if arg.Value, err = p.parseValue(false); err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+}
+
+func (p *parser) parseValue(isConst bool) (*Value, error) {
+	v := &Value{Pos: p.tok.pos}
+	switch p.tok.kind {
+	case tokenPunct:
+		switch p.tok.value {
+		case "$":
+			if isConst {
+				return nil, p.errorf("variables are not allowed here")
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			v.Kind = VariableValue
+			v.Raw = name
+			return v, nil
+		case "[":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			v.Kind = ListValue
+			v.List = []*Value{}
+			for {
+				if ok, err := p.skipPunct("]"); err != nil || ok {
+					return v, err
+				}
+				item, err := p.parseValue(isConst)
+				if err != nil {
+					return nil, err
+				}
+				v.List = append(v.List, item)
+			}
+		case "{":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			v.Kind = ObjectValue
+			v.Fields = []*ObjectField{}
+			for {
+				if ok, err := p.skipPunct("}"); err != nil || ok {
+					return v, err
+				}
+				name, err := p.expectName()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expectPunct(":"); err != nil {
+					return nil, err
+				}
+				val, err := p.parseValue(isConst)
+				if err != nil {
+					return nil, err
+				}
+				v.Fields = append(v.Fields, &ObjectField{Name: name, Value: val})
+			}
+		}
+		return nil, p.unexpected()
+	case tokenInt:
+		v.Kind = IntValue
+	case tokenFloat:
+		v.Kind = FloatValue
+	case tokenString:
+		v.Kind = StringValue
+	case tokenName:
+		switch p.tok.value {
+		case "true", "false":
+			v.Kind = BooleanValue
+		case "null":
+			v.Kind = NullValue
+		default:
+			v.Kind = EnumValue
+		}
+	default:
+		return nil, p.unexpected()
+	}
+	v.Raw = p.tok.value
+	return v, p.advance()
+}
@@ -0,0 +1,113 @@
+package graphql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`# comment
+mutation UpdateNote($id: ID!, $newNote: NoteInput!, $groups: [ID!] = ["R3JvdXAvMQ"]) {
+  updateNote(input: {id: $id, newNote: $newNote, draft: false}) {
+    note {
+      summary: contentSummaryHtml
+      updatedAt
+    }
+  }
+}`)
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	op, err := doc.Operation("")
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if op.Type != Mutation || op.Name != "UpdateNote" {
+		t.Errorf("unexpected operation: %s %s", op.Type, op.Name)
+	}
+	if len(op.VariableDefinitions) != 3 {
+		t.Fatalf("len(op.VariableDefinitions) = %d, expect: 3", len(op.VariableDefinitions))
+	}
+	if s := op.VariableDefinitions[2].Type.String(); s != "[ID!]" {
+		t.Errorf("type = %s, expect: [ID!]", s)
+	}
+	f := op.SelectionSet[0]
+	if f.Name != "updateNote" || len(f.Arguments) != 1 {
+		t.Fatalf("unexpected field: %+v", f)
+	}
+	input, err := f.Arguments[0].Value.Resolve(map[string]interface{}{
+		"id":      "QmxvZy8x",
+		"newNote": map[string]interface{}{"title": "hello"},
+	})
+	if err != nil {
+		t.Errorf("error should be nil, but: %s", err)
+	}
+	expect := map[string]interface{}{
+		"id":      "QmxvZy8x",
+		"newNote": map[string]interface{}{"title": "hello"},
+		"draft":   false,
+	}
+	if !reflect.DeepEqual(input, expect) {
+		t.Errorf("\n   out: %#v\nexpect: %#v", input, expect)
+	}
+	summary := f.SelectionSet[0].SelectionSet[0]
+	if summary.ResponseKey() != "summary" || summary.Name != "contentSummaryHtml" {
+		t.Errorf("unexpected alias: %+v", summary)
+	}
+}
+
+func TestParse_values(t *testing.T) {
+	doc, err := Parse(`{
+  notes(first: 10, after: "Nw", orderBy: {field: CONTENT_UPDATED_AT, direction: DESC}, ratio: -1.5e3, q: "\"あ\"\n", n: null) {
+    totalCount
+  }
+}`)
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	args := doc.Operations[0].SelectionSet[0].Arguments
+	out := make(map[string]interface{}, len(args))
+	for _, a := range args {
+		v, err := a.Value.Resolve(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[a.Name] = v
+	}
+	expect := map[string]interface{}{
+		"first": float64(10),
+		"after": "Nw",
+		"orderBy": map[string]interface{}{
+			"field":     "CONTENT_UPDATED_AT",
+			"direction": "DESC",
+		},
+		"ratio": float64(-1500),
+		"q":     "\"あ\"\n",
+		"n":     nil,
+	}
+	if !reflect.DeepEqual(out, expect) {
+		t.Errorf("\n   out: %#v\nexpect: %#v", out, expect)
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	testCases := []struct {
+		name, input, expect string
+	}{
+		{"empty", "", "empty document"},
+		{"unclosed", "{ note { title }", "got EOF"},
+		{"empty selection", "{ note { } }", "empty selection set"},
+		{"fragment", "{ note { ...NoteFields } }", "fragments are not supported"},
+		{"unterminated string", `{ note(id: "aaa) { title } }`, "unterminated string"},
+		{"bad character", "{ note % }", "unexpected character"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.input)
+			if err == nil || !strings.Contains(err.Error(), tc.expect) {
+				t.Errorf("error should contain %q, but: %v", tc.expect, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// String prints the document in the canonical form, so that equivalent documents
+// are printed in the same text
+func (d *Document) String() string {
+	buf := &strings.Builder{}
+	for i, op := range d.Operations {
+		if i > 0 {
+			buf.WriteString("\n\n")
+		}
+		op.print(buf)
+	}
+	return buf.String()
+}
+
+func (op *Operation) print(buf *strings.Builder) {
+	buf.WriteString(string(op.Type))
+	if op.Name != "" {
+		buf.WriteString(" " + op.Name)
+	}
+	if len(op.VariableDefinitions) > 0 {
+		buf.WriteByte('(')
+		for i, def := range op.VariableDefinitions {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString("$" + def.Name + ": " + def.Type.String())
+			if def.Default != nil {
+				buf.WriteString(" = ")
+				def.Default.print(buf)
+			}
+		}
+		buf.WriteByte(')')
+	}
+	buf.WriteByte(' ')
+	printSelectionSet(buf, op.SelectionSet, 0)
+}
+
+func printSelectionSet(buf *strings.Builder, fields []*Field, depth int) {
+	buf.WriteString("{\n")
+	indent := strings.Repeat("  ", depth+1)
+	for _, f := range fields {
+		buf.WriteString(indent)
+		if f.Alias != "" {
+			buf.WriteString(f.Alias + ": ")
+		}
+		buf.WriteString(f.Name)
+		if len(f.Arguments) > 0 {
+			buf.WriteByte('(')
+			for i, arg := range f.Arguments {
+				if i > 0 {
+					buf.WriteString(", ")
+				}
+				buf.WriteString(arg.Name + ": ")
+				arg.Value.print(buf)
+			}
+			buf.WriteByte(')')
+		}
+		if len(f.SelectionSet) > 0 {
+			buf.WriteByte(' ')
+			printSelectionSet(buf, f.SelectionSet, depth+1)
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(strings.Repeat("  ", depth) + "}")
+}
+
+func (v *Value) print(buf *strings.Builder) {
+	switch v.Kind {
+	case VariableValue:
+		buf.WriteString("$" + v.Raw)
+	case StringValue:
+		buf.WriteString(quote(v.Raw))
+	case ListValue:
+		buf.WriteByte('[')
+		for i, item := range v.List {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			item.print(buf)
+		}
+		buf.WriteByte(']')
+	case ObjectValue:
+		buf.WriteByte('{')
+		for i, f := range v.Fields {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(f.Name + ": ")
+			f.Value.print(buf)
+		}
+		buf.WriteByte('}')
+	default:
+		buf.WriteString(v.Raw)
+	}
+}
+
+// quote quotes the string. JSON strings are valid GraphQL strings.
+func quote(s string) string {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
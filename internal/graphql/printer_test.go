@@ -0,0 +1,52 @@
+package graphql
+
+import "testing"
+
+func TestDocument_String(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  string
+		expect string
+	}{{
+		name:  "shorthand",
+		input: `{ note(id: "Qm\"x") { title, summary: contentSummaryHtml } }`,
+		expect: `query {
+  note(id: "Qm\"x") {
+    title
+    summary: contentSummaryHtml
+  }
+}`,
+	}, {
+		name: "variables",
+		input: `mutation Update($id: ID!, $first: Int = 10, $order: NoteOrder = {field: PUBLISHED_AT, direction: DESC}) {
+  updateNote(input: {id: $id, draft: false, ids: [1, 2.5, null]}) { note { id } }
+}`,
+		expect: `mutation Update($id: ID!, $first: Int = 10, $order: NoteOrder = {field: PUBLISHED_AT, direction: DESC}) {
+  updateNote(input: {id: $id, draft: false, ids: [1, 2.5, null]}) {
+    note {
+      id
+    }
+  }
+}`,
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := Parse(tc.input)
+			if err != nil {
+				t.Fatalf("error should be nil, but: %s", err)
+			}
+			out := doc.String()
+			if out != tc.expect {
+				t.Errorf("\n   out: %s\nexpect: %s", out, tc.expect)
+			}
+			// printed documents can be parsed again into the same text
+			doc2, err := Parse(out)
+			if err != nil {
+				t.Fatalf("error should be nil, but: %s", err)
+			}
+			if doc2.String() != out {
+				t.Errorf("printed document is not stable:\n%s", doc2.String())
+			}
+		})
+	}
+}
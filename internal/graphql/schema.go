@@ -0,0 +1,399 @@
+package graphql
+
+import "fmt"
+
+// TypeKind is a kind of named types
+type TypeKind string
+
+// TypeKinds
+const (
+	ScalarKind      TypeKind = "SCALAR"
+	ObjectKind      TypeKind = "OBJECT"
+	InterfaceKind   TypeKind = "INTERFACE"
+	UnionKind       TypeKind = "UNION"
+	EnumKind        TypeKind = "ENUM"
+	InputObjectKind TypeKind = "INPUT_OBJECT"
+)
+
+// Schema is a GraphQL schema parsed from SDL
+type Schema struct {
+	Query    string
+	Mutation string
+	Types    map[string]*TypeDefinition
+}
+
+// TypeDefinition is a definition of a named type
+type TypeDefinition struct {
+	Kind       TypeKind
+	Name       string
+	Interfaces []string
+	// Fields are fields of objects and interfaces, or input fields of input objects
+	Fields     []*FieldDefinition
+	EnumValues []string
+	// PossibleTypes are the member types of unions
+	PossibleTypes []string
+	Pos           Position
+}
+
+// Field returns the field definition by the name
+func (td *TypeDefinition) Field(name string) *FieldDefinition {
+	for _, f := range td.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// IsLeaf reports whether the type is a scalar or an enum
+func (td *TypeDefinition) IsLeaf() bool {
+	return td.Kind == ScalarKind || td.Kind == EnumKind
+}
+
+// IsInput reports whether the type can be used for arguments and variables
+func (td *TypeDefinition) IsInput() bool {
+	return td.IsLeaf() || td.Kind == InputObjectKind
+}
+
+// FieldDefinition is a definition of a field or an input value
+type FieldDefinition struct {
+	Name      string
+	Arguments []*FieldDefinition
+	Type      *Type
+	Default   *Value
+}
+
+// Argument returns the argument definition by the name
+func (fd *FieldDefinition) Argument(name string) *FieldDefinition {
+	for _, a := range fd.Arguments {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+var builtinScalars = []string{"Int", "Float", "String", "Boolean", "ID"}
+
+// ParseSchema parses the schema definition language. Descriptions, directives and
+// directive definitions are ignored, and extensions are not supported.
+func ParseSchema(src string) (*Schema, error) {
+	p, err := newParser(src)
+	if err != nil {
+		return nil, err
+	}
+	s := &Schema{Types: make(map[string]*TypeDefinition)}
+	for _, name := range builtinScalars {
+		s.Types[name] = &TypeDefinition{Kind: ScalarKind, Name: name}
+	}
+	for p.tok.kind != tokenEOF {
+		if err := p.parseTypeSystemDefinition(s); err != nil {
+			return nil, err
+		}
+	}
+	if s.Query == "" {
+		s.Query = "Query"
+	}
+	if s.Mutation == "" && s.Types["Mutation"] != nil {
+		s.Mutation = "Mutation"
+	}
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// check checks that all the referred types are defined
+func (s *Schema) check() error {
+	if td := s.Types[s.Query]; td == nil || td.Kind != ObjectKind {
+		return fmt.Errorf("query type %q is not defined", s.Query)
+	}
+	if s.Mutation != "" {
+		if td := s.Types[s.Mutation]; td == nil || td.Kind != ObjectKind {
+			return fmt.Errorf("mutation type %q is not defined", s.Mutation)
+		}
+	}
+	for _, td := range s.Types {
+		for _, name := range td.PossibleTypes {
+			if mt := s.Types[name]; mt == nil || mt.Kind != ObjectKind {
+				return &SyntaxError{Pos: td.Pos, Message: fmt.Sprintf("member %q of %s is not an object type", name, td.Name)}
+			}
+		}
+		for _, name := range td.Interfaces {
+			if it := s.Types[name]; it == nil || it.Kind != InterfaceKind {
+				return &SyntaxError{Pos: td.Pos, Message: fmt.Sprintf("interface %q of %s is not defined", name, td.Name)}
+			}
+		}
+		for _, f := range td.Fields {
+			ft := s.Types[f.Type.NamedType()]
+			if ft == nil {
+				return &SyntaxError{Pos: td.Pos, Message: fmt.Sprintf("type %q of %s.%s is not defined", f.Type.NamedType(), td.Name, f.Name)}
+			}
+			if td.Kind == InputObjectKind && !ft.IsInput() {
+				return &SyntaxError{Pos: td.Pos, Message: fmt.Sprintf("%s.%s must be an input type", td.Name, f.Name)}
+			}
+			for _, a := range f.Arguments {
+				at := s.Types[a.Type.NamedType()]
+				if at == nil || !at.IsInput() {
+					return &SyntaxError{Pos: td.Pos, Message: fmt.Sprintf("argument %s of %s.%s must be an input type", a.Name, td.Name, f.Name)}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *parser) skipDescription() error {
+	if p.tok.kind == tokenString {
+		return p.advance()
+	}
+	return nil
+}
+
+// skipDirectives skips directives like `@deprecated(reason: "...")`
+func (p *parser) skipDirectives() error {
+	for p.peekPunct("@") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if _, err := p.expectName(); err != nil {
+			return err
+		}
+		if p.peekPunct("(") {
+			if _, err := p.parseArguments(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseTypeSystemDefinition(s *Schema) error {
+	if err := p.skipDescription(); err != nil {
+		return err
+	}
+	pos := p.tok.pos
+	keyword, err := p.expectName()
+	if err != nil {
+		return err
+	}
+	switch keyword {
+	case "schema":
+		return p.parseSchemaDefinition(s)
+	case "directive":
+		return p.skipDirectiveDefinition()
+	}
+	name, err := p.expectName()
+	if err != nil {
+		return err
+	}
+	if s.Types[name] != nil {
+		return &SyntaxError{Pos: pos, Message: fmt.Sprintf("type %q is defined twice", name)}
+	}
+	td := &TypeDefinition{Name: name, Pos: pos}
+	switch keyword {
+	case "scalar":
+		td.Kind = ScalarKind
+		err = p.skipDirectives()
+	case "type", "interface":
+		td.Kind = ObjectKind
+		if keyword == "interface" {
+			td.Kind = InterfaceKind
+		}
+		if p.tok.kind == tokenName && p.tok.value == "implements" {
+			if td.Interfaces, err = p.parseImplements(); err != nil {
+				return err
+			}
+		}
+		if err := p.skipDirectives(); err != nil {
+			return err
+		}
+		td.Fields, err = p.parseFieldDefinitions("{", "}")
+	case "input":
+		td.Kind = InputObjectKind
+		if err := p.skipDirectives(); err != nil {
+			return err
+		}
+		td.Fields, err = p.parseFieldDefinitions("{", "}")
+	case "union":
+		td.Kind = UnionKind
+		if err := p.skipDirectives(); err != nil {
+			return err
+		}
+		td.PossibleTypes, err = p.parseUnionMembers()
+	case "enum":
+		td.Kind = EnumKind
+		if err := p.skipDirectives(); err != nil {
+			return err
+		}
+		td.EnumValues, err = p.parseEnumValues()
+	default:
+		return &SyntaxError{Pos: pos, Message: fmt.Sprintf("unsupported definition %q", keyword)}
+	}
+	if err != nil {
+		return err
+	}
+	s.Types[name] = td
+	return nil
+}
+
+func (p *parser) parseSchemaDefinition(s *Schema) error {
+	if err := p.skipDirectives(); err != nil {
+		return err
+	}
+	if err := p.expectPunct("{"); err != nil {
+		return err
+	}
+	for {
+		if ok, err := p.skipPunct("}"); err != nil || ok {
+			return err
+		}
+		op, err := p.expectName()
+		if err != nil {
+			return err
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case "query":
+			s.Query = name
+		case "mutation":
+			s.Mutation = name
+		default:
+			return p.errorf("unsupported operation type %q", op)
+		}
+	}
+}
+
+// skipDirectiveDefinition skips the definition like
+// `directive @auth(role: String) on FIELD_DEFINITION | OBJECT` after "directive"
+func (p *parser) skipDirectiveDefinition() error {
+	if err := p.expectPunct("@"); err != nil {
+		return err
+	}
+	if _, err := p.expectName(); err != nil {
+		return err
+	}
+	if p.peekPunct("(") {
+		if _, err := p.parseFieldDefinitions("(", ")"); err != nil {
+			return err
+		}
+	}
+	if p.tok.kind == tokenName && p.tok.value == "repeatable" {
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+	if on, err := p.expectName(); err != nil {
+		return err
+	} else if on != "on" {
+		return p.errorf(`"on" is expected, but got %q`, on)
+	}
+	_, err := p.parseNames("|")
+	return err
+}
+
+// parseUnionMembers parses the members like `= A | B`
+func (p *parser) parseUnionMembers() ([]string, error) {
+	if err := p.expectPunct("="); err != nil {
+		return nil, err
+	}
+	return p.parseNames("|")
+}
+
+// parseNames parses the names separated by the separator, which may lead them
+func (p *parser) parseNames(sep string) ([]string, error) {
+	if _, err := p.skipPunct(sep); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if ok, err := p.skipPunct(sep); err != nil {
+			return nil, err
+		} else if !ok {
+			return names, nil
+		}
+	}
+}
+
+func (p *parser) parseImplements() ([]string, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	return p.parseNames("&")
+}
+
+func (p *parser) parseFieldDefinitions(open, close string) ([]*FieldDefinition, error) {
+	if err := p.expectPunct(open); err != nil {
+		return nil, err
+	}
+	var fields []*FieldDefinition
+	for {
+		if ok, err := p.skipPunct(close); err != nil || ok {
+			return fields, err
+		}
+		if err := p.skipDescription(); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		f := &FieldDefinition{Name: name}
+		if p.peekPunct("(") {
+			if f.Arguments, err = p.parseFieldDefinitions("(", ")"); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		if f.Type, err = p.parseType(); err != nil {
+			return nil, err
+		}
+		if ok, err := p.skipPunct("="); err != nil {
+			return nil, err
+		} else if ok {
+			if f.Default, err = p.parseValue(true); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.skipDirectives(); err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+}
+
+func (p *parser) parseEnumValues() ([]string, error) {
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+	var values []string
+	for {
+		if ok, err := p.skipPunct("}"); err != nil || ok {
+			return values, err
+		}
+		if err := p.skipDescription(); err != nil {
+			return nil, err
+		}
+		v, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.skipDirectives(); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+}
@@ -0,0 +1,243 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError is an error of the document against the schema
+type ValidationError struct {
+	Pos     Position
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// ValidationErrors is a list of validation errors
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Validate validates the document against the schema. It checks that the selected
+// fields exist, leaf fields and only them have no selections, the arguments are
+// defined and typed correctly, and the variables are defined, used and typed
+// correctly. It returns ValidationErrors when the document is invalid.
+func (s *Schema) Validate(doc *Document) error {
+	var errs ValidationErrors
+	for _, op := range doc.Operations {
+		errs = append(errs, s.validateOperation(op)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+type validator struct {
+	s    *Schema
+	vars map[string]*VariableDefinition
+	used map[string]bool
+	errs ValidationErrors
+}
+
+func (v *validator) errorf(pos Position, format string, args ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+func (s *Schema) validateOperation(op *Operation) ValidationErrors {
+	v := &validator{
+		s:    s,
+		vars: make(map[string]*VariableDefinition),
+		used: make(map[string]bool),
+	}
+	root := s.Query
+	if op.Type == Mutation {
+		root = s.Mutation
+	}
+	if root == "" {
+		v.errorf(op.Pos, "schema doesn't support %s", op.Type)
+		return v.errs
+	}
+	for _, def := range op.VariableDefinitions {
+		if v.vars[def.Name] != nil {
+			v.errorf(def.Pos, "variable $%s is defined twice", def.Name)
+		}
+		v.vars[def.Name] = def
+		if td := s.Types[def.Type.NamedType()]; td == nil || !td.IsInput() {
+			v.errorf(def.Pos, "variable $%s must be an input type, but %s", def.Name, def.Type)
+		} else if def.Default != nil {
+			v.validateValue(def.Default, def.Type, "default value of $"+def.Name)
+		}
+	}
+	v.validateSelectionSet(s.Types[root], op.SelectionSet)
+	for _, def := range op.VariableDefinitions {
+		if !v.used[def.Name] {
+			v.errorf(def.Pos, "variable $%s is never used", def.Name)
+		}
+	}
+	return v.errs
+}
+
+func (v *validator) validateSelectionSet(parent *TypeDefinition, fields []*Field) {
+	for _, f := range fields {
+		if f.Name == "__typename" {
+			if len(f.Arguments) > 0 || len(f.SelectionSet) > 0 {
+				v.errorf(f.Pos, "__typename can't have arguments nor selections")
+			}
+			continue
+		}
+		fd := parent.Field(f.Name)
+		if fd == nil {
+			v.errorf(f.Pos, "field %q doesn't exist on type %s", f.Name, parent.Name)
+			continue
+		}
+		v.validateArguments(f, fd)
+		ft := v.s.Types[fd.Type.NamedType()]
+		switch {
+		case ft.IsLeaf() && len(f.SelectionSet) > 0:
+			v.errorf(f.Pos, "selections can't be made on %s of %s.%s", fd.Type, parent.Name, f.Name)
+		case !ft.IsLeaf() && len(f.SelectionSet) == 0:
+			v.errorf(f.Pos, "%s.%s of type %s must have a selection of subfields", parent.Name, f.Name, fd.Type)
+		case !ft.IsLeaf():
+			v.validateSelectionSet(ft, f.SelectionSet)
+		}
+	}
+}
+
+func (v *validator) validateArguments(f *Field, fd *FieldDefinition) {
+	given := make(map[string]bool, len(f.Arguments))
+	for _, arg := range f.Arguments {
+		if given[arg.Name] {
+			v.errorf(arg.Pos, "argument %q is given twice", arg.Name)
+		}
+		given[arg.Name] = true
+		ad := fd.Argument(arg.Name)
+		if ad == nil {
+			v.errorf(arg.Pos, "unknown argument %q on field %s", arg.Name, f.Name)
+			continue
+		}
+		v.validateValue(arg.Value, ad.Type, fmt.Sprintf("argument %q of %s", arg.Name, f.Name))
+	}
+	for _, ad := range fd.Arguments {
+		if ad.Type.NonNull && ad.Default == nil && !given[ad.Name] {
+			v.errorf(f.Pos, "required argument %q of %s is missing", ad.Name, f.Name)
+		}
+	}
+}
+
+// validateValue validates the value given at the location of the type
+func (v *validator) validateValue(val *Value, typ *Type, at string) {
+	if val.Kind == VariableValue {
+		v.used[val.Raw] = true
+		def := v.vars[val.Raw]
+		if def == nil {
+			v.errorf(val.Pos, "variable $%s is not defined", val.Raw)
+			return
+		}
+		varType := def.Type
+		if typ.NonNull && !varType.NonNull && def.Default != nil {
+			// nullable variables with defaults can be used for non-null locations
+			varType = &Type{Name: varType.Name, Elem: varType.Elem, NonNull: true}
+		}
+		if !typeCompatible(varType, typ) {
+			v.errorf(val.Pos, "variable $%s of type %s can't be used for %s of type %s", val.Raw, def.Type, at, typ)
+		}
+		return
+	}
+	if val.Kind == NullValue {
+		if typ.NonNull {
+			v.errorf(val.Pos, "%s must not be null", at)
+		}
+		return
+	}
+	if typ.Elem != nil {
+		if val.Kind != ListValue {
+			// a single value is coerced into a list
+			v.validateValue(val, typ.Elem, at)
+			return
+		}
+		for _, item := range val.List {
+			v.validateValue(item, typ.Elem, at)
+		}
+		return
+	}
+	td := v.s.Types[typ.Name]
+	switch td.Kind {
+	case EnumKind:
+		if val.Kind != EnumValue || !contains(td.EnumValues, val.Raw) {
+			v.errorf(val.Pos, "%s must be one of %s, but got %q", at, strings.Join(td.EnumValues, ", "), val.Raw)
+		}
+	case InputObjectKind:
+		if val.Kind != ObjectValue {
+			v.errorf(val.Pos, "%s must be an input object %s", at, td.Name)
+			return
+		}
+		given := make(map[string]bool, len(val.Fields))
+		for _, f := range val.Fields {
+			given[f.Name] = true
+			fd := td.Field(f.Name)
+			if fd == nil {
+				v.errorf(f.Value.Pos, "unknown field %q of input object %s", f.Name, td.Name)
+				continue
+			}
+			v.validateValue(f.Value, fd.Type, fmt.Sprintf("field %q of %s", f.Name, td.Name))
+		}
+		for _, fd := range td.Fields {
+			if fd.Type.NonNull && fd.Default == nil && !given[fd.Name] {
+				v.errorf(val.Pos, "required field %q of input object %s is missing", fd.Name, td.Name)
+			}
+		}
+	case ScalarKind:
+		if !scalarCompatible(td.Name, val.Kind) {
+			v.errorf(val.Pos, "%s must be %s, but got %q", at, td.Name, val.Raw)
+		}
+	}
+}
+
+func scalarCompatible(scalar string, kind ValueKind) bool {
+	switch scalar {
+	case "Int":
+		return kind == IntValue
+	case "Float":
+		return kind == IntValue || kind == FloatValue
+	case "String":
+		return kind == StringValue
+	case "Boolean":
+		return kind == BooleanValue
+	case "ID":
+		return kind == StringValue || kind == IntValue
+	}
+	// custom scalars accept any literals
+	return kind != ListValue && kind != ObjectValue
+}
+
+// typeCompatible reports whether values of the variable type can be used at the location type
+func typeCompatible(varType, locType *Type) bool {
+	if locType.NonNull && !varType.NonNull {
+		return false
+	}
+	if (varType.Elem == nil) != (locType.Elem == nil) {
+		return false
+	}
+	if varType.Elem != nil {
+		return typeCompatible(varType.Elem, locType.Elem)
+	}
+	return varType.Name == locType.Name
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
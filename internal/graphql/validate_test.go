@@ -0,0 +1,198 @@
+package graphql
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSchema = `
+"the root"
+type Query {
+  note(id: ID!): Note!
+  notes(first: Int, after: String, orderBy: NoteOrder): NoteConnection!
+}
+
+type Mutation {
+  updateNote(input: UpdateNoteInput!): UpdateNotePayload
+}
+
+interface Node {
+  id: ID!
+}
+
+type Note implements Node {
+  id: ID!
+  title: String!
+  author: User!
+  updatedAt: DateTime! @deprecated(reason: "for testing")
+}
+
+type User implements Node {
+  id: ID!
+  account: String!
+}
+
+type NoteConnection {
+  nodes: [Note]
+  totalCount: Int!
+}
+
+type UpdateNotePayload {
+  note: Note
+}
+
+input UpdateNoteInput {
+  id: ID!
+  title: String!
+  draft: Boolean = false
+  groupIds: [ID!]
+}
+
+input NoteOrder {
+  field: NoteOrderField!
+  direction: OrderDirection = DESC
+}
+
+enum NoteOrderField {
+  PUBLISHED_AT
+  CONTENT_UPDATED_AT
+}
+
+enum OrderDirection { ASC DESC }
+
+scalar DateTime
+`
+
+func TestParseSchema(t *testing.T) {
+	s, err := ParseSchema(testSchema)
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if s.Query != "Query" || s.Mutation != "Mutation" {
+		t.Errorf("unexpected root types: %s, %s", s.Query, s.Mutation)
+	}
+	note := s.Types["Note"]
+	if note.Kind != ObjectKind || len(note.Interfaces) != 1 || note.Field("updatedAt").Type.String() != "DateTime!" {
+		t.Errorf("unexpected Note type: %+v", note)
+	}
+	if fd := s.Types["Query"].Field("notes"); fd.Argument("orderBy").Type.Name != "NoteOrder" {
+		t.Errorf("unexpected arguments of notes: %+v", fd.Arguments)
+	}
+
+	s, err = ParseSchema(`
+directive @cost(complexity: Int) repeatable on FIELD_DEFINITION | OBJECT
+type Query { search: [SearchResult!]! @cost(complexity: 10) }
+type Note { title: String! }
+type Comment { content: String! }
+"""
+results
+"""
+union SearchResult =
+  | Note
+  | Comment
+`)
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if td := s.Types["SearchResult"]; td.Kind != UnionKind || strings.Join(td.PossibleTypes, ",") != "Note,Comment" {
+		t.Errorf("unexpected union: %+v", td)
+	}
+	if _, err := ParseSchema("type Query { a: U }\nunion U = String"); err == nil {
+		t.Error("error should be occurred for non-object members")
+	}
+
+	if _, err := ParseSchema(`type Query { note: Unknown }`); err == nil || !strings.Contains(err.Error(), `"Unknown"`) {
+		t.Errorf("error should be occurred for undefined types, but: %v", err)
+	}
+}
+
+func TestSchema_Validate(t *testing.T) {
+	s, err := ParseSchema(testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name  string
+		input string
+		want  string
+	}{{
+		name: "valid query",
+		input: `query($first: Int!, $after: String) {
+  notes(first: $first, after: $after, orderBy: {field: PUBLISHED_AT}) {
+    totalCount
+    nodes { id title author { account } __typename }
+  }
+}`,
+	}, {
+		name: "valid mutation",
+		input: `mutation($id: ID!, $title: String = "untitled") {
+  updateNote(input: {id: $id, title: $title, groupIds: "R3JvdXAvMQ"}) { note { id } }
+}`,
+	}, {
+		name:  "unknown field",
+		input: `{ notes { after } }`,
+		want:  `field "after" doesn't exist on type NoteConnection`,
+	}, {
+		name:  "selection on scalar",
+		input: `{ note(id: "x") { title { x } } }`,
+		want:  "selections can't be made on String!",
+	}, {
+		name:  "missing selection",
+		input: `{ note(id: "x") { author } }`,
+		want:  "must have a selection of subfields",
+	}, {
+		name:  "missing argument",
+		input: `{ note { id } }`,
+		want:  `required argument "id" of note is missing`,
+	}, {
+		name:  "unknown argument",
+		input: `{ note(id: "x", first: 1) { id } }`,
+		want:  `unknown argument "first"`,
+	}, {
+		name:  "invalid enum",
+		input: `{ notes(orderBy: {field: TITLE}) { totalCount } }`,
+		want:  "must be one of PUBLISHED_AT, CONTENT_UPDATED_AT",
+	}, {
+		name:  "invalid scalar",
+		input: `{ notes(first: "10") { totalCount } }`,
+		want:  `must be Int`,
+	}, {
+		name:  "missing input field",
+		input: `mutation { updateNote(input: {id: "x"}) { note { id } } }`,
+		want:  `required field "title" of input object UpdateNoteInput is missing`,
+	}, {
+		name:  "undefined variable",
+		input: `{ note(id: $id) { id } }`,
+		want:  "variable $id is not defined",
+	}, {
+		name:  "unused variable",
+		input: `query($id: ID!) { notes { totalCount } }`,
+		want:  "variable $id is never used",
+	}, {
+		name:  "nullable variable",
+		input: `query($id: ID) { note(id: $id) { id } }`,
+		want:  "variable $id of type ID can't be used",
+	}, {
+		name:  "mismatched variable",
+		input: `query($id: String!) { note(id: $id) { id } }`,
+		want:  "variable $id of type String! can't be used",
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := Parse(tc.input)
+			if err != nil {
+				t.Fatalf("error should be nil, but: %s", err)
+			}
+			err = s.Validate(doc)
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("error should be nil, but: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error should contain %q, but: %v", tc.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,586 @@
+// Package kibelagen generates typed operations from GraphQL queries and mutations
+// declared as string constants, validating them against the schema.
+//
+// For each constant named like `getNoteQuery` or `updateNoteMutation`, it generates
+// the variables type `getNoteVariables`, the response type `getNoteData` with nested
+// types for the selections, and the method `(ki *Kibela) doGetNote` which sends the
+// operation and unmarshals the response. Object types can be bound to hand-written
+// Go types, whose JSON fields are checked to cover the selections.
+package kibelagen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/konifar/kibelasync/internal/graphql"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the configuration of the generator
+type Config struct {
+	// Package is the package name of the output
+	Package string `yaml:"package"`
+	// Schema is the path to the schema file in SDL
+	Schema string `yaml:"schema"`
+	// SchemaURL is the URL of the published schema which the Schema is vendored from
+	SchemaURL string `yaml:"schemaURL"`
+	// Operations are paths to the Go files declaring the operation constants
+	Operations []string `yaml:"operations"`
+	// Output is the path to the generated Go file
+	Output string `yaml:"output"`
+	// Scalars maps GraphQL scalars to Go types. The built-in scalars are mapped by default.
+	Scalars map[string]string `yaml:"scalars"`
+	// Bindings maps GraphQL object and input types to Go types in the package
+	Bindings map[string]string `yaml:"bindings"`
+	// Variables maps operation constants to hand-written variables types, which can
+	// be shared among operations
+	Variables map[string]string `yaml:"variables"`
+	// Idempotent lists mutations safe to retry
+	Idempotent []string `yaml:"idempotent"`
+
+	dir string
+}
+
+var defaultScalars = map[string]string{
+	"ID":      "string",
+	"String":  "string",
+	"Int":     "int",
+	"Float":   "float64",
+	"Boolean": "bool",
+}
+
+// LoadConfig loads the configuration file. Paths in it are relative to the file.
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load config: %w", err)
+	}
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, xerrors.Errorf("failed to load config %q: %w", path, err)
+	}
+	c.dir = filepath.Dir(path)
+	return c, nil
+}
+
+// OutputPath returns the path to the generated file
+func (c *Config) OutputPath() string {
+	return filepath.Join(c.dir, c.Output)
+}
+
+// UpdateSchema downloads the published schema from the SchemaURL into the Schema. The
+// schema is written only when it can be parsed.
+func (c *Config) UpdateSchema(ctx context.Context) error {
+	if c.SchemaURL == "" {
+		return xerrors.New("failed to update schema: schemaURL is not configured")
+	}
+	req, err := http.NewRequest(http.MethodGet, c.SchemaURL, nil)
+	if err != nil {
+		return xerrors.Errorf("failed to update schema: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return xerrors.Errorf("failed to update schema: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("failed to update schema: %s returned %s", c.SchemaURL, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return xerrors.Errorf("failed to update schema: %w", err)
+	}
+	if _, err := graphql.ParseSchema(string(b)); err != nil {
+		return xerrors.Errorf("failed to parse schema from %s: %w", c.SchemaURL, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(c.dir, c.Schema), b, 0644); err != nil {
+		return xerrors.Errorf("failed to update schema: %w", err)
+	}
+	return nil
+}
+
+type operation struct {
+	constName string
+	base      string
+	op        *graphql.Operation
+}
+
+type generator struct {
+	c       *Config
+	schema  *graphql.Schema
+	structs map[string]*ast.StructType
+	buf     *bytes.Buffer
+	types   map[string]bool
+}
+
+// Generate validates the operations against the schema and returns the generated source
+func (c *Config) Generate() ([]byte, error) {
+	b, err := ioutil.ReadFile(filepath.Join(c.dir, c.Schema))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read schema: %w", err)
+	}
+	schema, err := graphql.ParseSchema(string(b))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse schema %q: %w", c.Schema, err)
+	}
+	structs, err := c.parseStructs()
+	if err != nil {
+		return nil, err
+	}
+	ops, err := c.loadOperations(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{
+		c:       c,
+		schema:  schema,
+		structs: structs,
+		buf:     &bytes.Buffer{},
+		types:   make(map[string]bool),
+	}
+	fmt.Fprintf(g.buf, `// Code generated by kibelagen. DO NOT EDIT.
+
+package %s
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/konifar/kibelasync/client"
+)
+`, c.Package)
+	for _, op := range ops {
+		if err := g.generate(op); err != nil {
+			return nil, xerrors.Errorf("failed to generate %s: %w", op.constName, err)
+		}
+	}
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to format generated code: %w\n%s", err, g.buf.String())
+	}
+	return src, nil
+}
+
+// loadOperations loads and validates the operation constants in the order of declarations
+func (c *Config) loadOperations(schema *graphql.Schema) ([]*operation, error) {
+	var ops []*operation
+	fset := token.NewFileSet()
+	for _, fname := range c.Operations {
+		f, err := parser.ParseFile(fset, filepath.Join(c.dir, fname), nil, 0)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse %q: %w", fname, err)
+		}
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, name := range vs.Names {
+					op, err := loadOperation(fset, schema, name.Name, vs.Values, i)
+					if err != nil {
+						return nil, err
+					}
+					if op != nil {
+						ops = append(ops, op)
+					}
+				}
+			}
+		}
+	}
+	return ops, nil
+}
+
+func loadOperation(fset *token.FileSet, schema *graphql.Schema, name string, values []ast.Expr, i int) (*operation, error) {
+	var (
+		base   string
+		opType graphql.OperationType
+	)
+	switch {
+	case strings.HasSuffix(name, "Query"):
+		base, opType = strings.TrimSuffix(name, "Query"), graphql.Query
+	case strings.HasSuffix(name, "Mutation"):
+		base, opType = strings.TrimSuffix(name, "Mutation"), graphql.Mutation
+	default:
+		return nil, nil
+	}
+	if i >= len(values) {
+		return nil, nil
+	}
+	lit, ok := values[i].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return nil, xerrors.Errorf("%s: %s must be a string literal", fset.Position(values[i].Pos()), name)
+	}
+	src, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := graphql.Parse(src)
+	if err != nil {
+		return nil, xerrors.Errorf("%s: invalid %s: %w", fset.Position(lit.Pos()), name, err)
+	}
+	if len(doc.Operations) != 1 {
+		return nil, xerrors.Errorf("%s: %s must have just one operation", fset.Position(lit.Pos()), name)
+	}
+	op := doc.Operations[0]
+	if op.Type != opType {
+		return nil, xerrors.Errorf("%s: %s must be a %s", fset.Position(lit.Pos()), name, opType)
+	}
+	if err := schema.Validate(doc); err != nil {
+		return nil, xerrors.Errorf("%s: invalid %s: %w", fset.Position(lit.Pos()), name, err)
+	}
+	return &operation{constName: name, base: base, op: op}, nil
+}
+
+// parseStructs collects struct types declared in the package to check bindings
+func (c *Config) parseStructs() (map[string]*ast.StructType, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, c.dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != c.Output
+	}, 0)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse package: %w", err)
+	}
+	pkg, ok := pkgs[c.Package]
+	if !ok {
+		return nil, xerrors.Errorf("package %q is not found in %q", c.Package, c.dir)
+	}
+	structs := make(map[string]*ast.StructType)
+	for _, f := range pkg.Files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					structs[ts.Name.Name] = st
+				}
+			}
+		}
+	}
+	return structs, nil
+}
+
+func (g *generator) generate(op *operation) error {
+	method := "do" + strings.ToUpper(op.base[:1]) + op.base[1:]
+	varsType := ""
+	if len(op.op.VariableDefinitions) > 0 {
+		varsType = g.c.Variables[op.constName]
+		if varsType != "" {
+			if err := g.checkVariables(varsType, op.op.VariableDefinitions); err != nil {
+				return err
+			}
+		} else {
+			varsType = op.base + "Variables"
+			if err := g.generateVariables(varsType, op.op.VariableDefinitions); err != nil {
+				return err
+			}
+		}
+	}
+
+	root := g.schema.Query
+	if op.op.Type == graphql.Mutation {
+		root = g.schema.Mutation
+	}
+	dataType := op.base + "Data"
+	if err := g.generateObject(dataType, op.base, g.schema.Types[root], op.op.SelectionSet); err != nil {
+		return err
+	}
+
+	params := "ctx context.Context"
+	payload := "Query: " + op.constName + ",\n"
+	if varsType != "" {
+		params += ", vars *" + varsType
+		payload += "Variables: vars,\n"
+	}
+	for _, name := range g.c.Idempotent {
+		if name == op.constName {
+			payload += "Idempotent: true,\n"
+		}
+	}
+	fmt.Fprintf(g.buf, `
+// %s sends %s
+func (ki *Kibela) %s(%s) (*%s, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		%s})
+	if err != nil {
+		return nil, err
+	}
+	var res %s
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+`, method, op.constName, method, params, dataType, payload, dataType)
+	return nil
+}
+
+func (g *generator) declare(name string) error {
+	if g.types[name] {
+		return xerrors.Errorf("type %s is generated twice", name)
+	}
+	if g.structs[name] != nil {
+		return xerrors.Errorf("type %s conflicts with the declared one", name)
+	}
+	g.types[name] = true
+	return nil
+}
+
+func (g *generator) generateVariables(name string, defs []*graphql.VariableDefinition) error {
+	if err := g.declare(name); err != nil {
+		return err
+	}
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "\ntype %s struct {\n", name)
+	for _, def := range defs {
+		typ, err := g.goType(def.Type, true)
+		if err != nil {
+			return xerrors.Errorf("variable $%s: %w", def.Name, err)
+		}
+		tag := def.Name
+		if !def.Type.NonNull {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(buf, "%s %s `json:%q`\n", goName(def.Name), typ, tag)
+	}
+	buf.WriteString("}\n")
+	g.buf.WriteString(buf.String())
+	return nil
+}
+
+func (g *generator) generateObject(name, prefix string, td *graphql.TypeDefinition, fields []*graphql.Field) error {
+	if err := g.declare(name); err != nil {
+		return err
+	}
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "\ntype %s struct {\n", name)
+	var nested []func() error
+	for _, f := range fields {
+		key := f.ResponseKey()
+		var typ *graphql.Type
+		if f.Name == "__typename" {
+			typ = &graphql.Type{Name: "String", NonNull: true}
+		} else {
+			typ = td.Field(f.Name).Type
+		}
+		ft := g.schema.Types[typ.NamedType()]
+		var goTyp string
+		switch bound := g.c.Bindings[ft.Name]; {
+		case ft.IsLeaf():
+			t, err := g.goType(typ, false)
+			if err != nil {
+				return err
+			}
+			goTyp = t
+		case bound != "":
+			if err := g.checkBound(bound, ft, f.SelectionSet, f.Name); err != nil {
+				return err
+			}
+			goTyp = wrapList(typ, "*"+bound)
+		default:
+			childName := prefix + goName(key)
+			goTyp = wrapList(typ, "*"+childName)
+			f, ft := f, ft
+			nested = append(nested, func() error {
+				return g.generateObject(childName, childName, ft, f.SelectionSet)
+			})
+		}
+		fmt.Fprintf(buf, "%s %s `json:%q`\n", goName(key), goTyp, key)
+	}
+	buf.WriteString("}\n")
+	g.buf.WriteString(buf.String())
+	for _, fn := range nested {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func wrapList(typ *graphql.Type, elem string) string {
+	for t := typ; t.Elem != nil; t = t.Elem {
+		elem = "[]" + elem
+	}
+	return elem
+}
+
+// goType returns the Go type of leaf types and input types
+func (g *generator) goType(typ *graphql.Type, input bool) (string, error) {
+	td := g.schema.Types[typ.NamedType()]
+	var elem string
+	switch {
+	case td.Kind == graphql.ScalarKind:
+		elem = g.c.Scalars[td.Name]
+		if elem == "" {
+			elem = defaultScalars[td.Name]
+		}
+		if elem == "" {
+			return "", xerrors.Errorf("scalar %s is not mapped", td.Name)
+		}
+	case td.Kind == graphql.EnumKind:
+		elem = "string"
+	case input && g.c.Bindings[td.Name] != "":
+		elem = "*" + g.c.Bindings[td.Name]
+	default:
+		return "", xerrors.Errorf("type %s must be bound to a Go type", td.Name)
+	}
+	return wrapList(typ, elem), nil
+}
+
+// jsonFields returns the JSON keys of the struct and their types
+func jsonFields(st *ast.StructType) map[string]ast.Expr {
+	fields := make(map[string]ast.Expr)
+	for _, f := range st.Fields.List {
+		names := make([]string, 0, len(f.Names))
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+		if len(names) == 0 {
+			// embedded field
+			if id, ok := f.Type.(*ast.Ident); ok {
+				names = append(names, id.Name)
+			}
+		}
+		if f.Tag != nil {
+			tag, _ := strconv.Unquote(f.Tag.Value)
+			if key := strings.Split(reflect.StructTag(tag).Get("json"), ",")[0]; key == "-" {
+				continue
+			} else if key != "" && len(names) == 1 {
+				names = []string{key}
+			}
+		}
+		for _, n := range names {
+			fields[n] = f.Type
+		}
+	}
+	return fields
+}
+
+func lookupField(fields map[string]ast.Expr, key string) ast.Expr {
+	if t, ok := fields[key]; ok {
+		return t
+	}
+	// encoding/json matches keys case-insensitively
+	for k, t := range fields {
+		if strings.EqualFold(k, key) {
+			return t
+		}
+	}
+	return nil
+}
+
+// checkBound checks that the bound struct has fields for all the selections
+func (g *generator) checkBound(goTyp string, td *graphql.TypeDefinition, sels []*graphql.Field, at string) error {
+	st := g.structs[goTyp]
+	if st == nil {
+		return xerrors.Errorf("bound type %s of %s is not a struct declared in the package", goTyp, at)
+	}
+	fields := jsonFields(st)
+	for _, f := range sels {
+		key := f.ResponseKey()
+		ft := lookupField(fields, key)
+		if ft == nil {
+			return xerrors.Errorf("%s has no field for %q selected in %s", goTyp, key, at)
+		}
+		if len(f.SelectionSet) == 0 {
+			continue
+		}
+		name := typeName(ft)
+		if g.structs[name] == nil {
+			return xerrors.Errorf("%s.%s must be a struct declared in the package for the selections", goTyp, key)
+		}
+		child := g.schema.Types[td.Field(f.Name).Type.NamedType()]
+		if err := g.checkBound(name, child, f.SelectionSet, at+"."+key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkVariables checks that the hand-written variables type has just the variables
+func (g *generator) checkVariables(goTyp string, defs []*graphql.VariableDefinition) error {
+	st := g.structs[goTyp]
+	if st == nil {
+		return xerrors.Errorf("variables type %s is not a struct declared in the package", goTyp)
+	}
+	fields := jsonFields(st)
+	names := make(map[string]bool, len(defs))
+	for _, def := range defs {
+		names[def.Name] = true
+		if _, ok := fields[def.Name]; !ok {
+			return xerrors.Errorf("%s has no field for variable $%s", goTyp, def.Name)
+		}
+	}
+	var extra []string
+	for k := range fields {
+		if !names[k] {
+			extra = append(extra, k)
+		}
+	}
+	if len(extra) > 0 {
+		sort.Strings(extra)
+		return xerrors.Errorf("%s has fields not defined as variables: %s", goTyp, strings.Join(extra, ", "))
+	}
+	return nil
+}
+
+func typeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return typeName(t.X)
+	case *ast.ArrayType:
+		return typeName(t.Elt)
+	}
+	return ""
+}
+
+var initialisms = map[string]string{
+	"Api":  "API",
+	"Html": "HTML",
+	"Id":   "ID",
+	"Ids":  "IDs",
+	"Json": "JSON",
+	"Url":  "URL",
+}
+
+// goName converts the GraphQL name to the exported Go name following golint, e.g.
+// "folderId" to "FolderID"
+func goName(name string) string {
+	var (
+		words []string
+		start int
+	)
+	for i := 1; i <= len(name); i++ {
+		if i == len(name) || 'A' <= name[i] && name[i] <= 'Z' {
+			words = append(words, strings.ToUpper(name[start:start+1])+name[start+1:i])
+			start = i
+		}
+	}
+	for i, w := range words {
+		if s, ok := initialisms[w]; ok {
+			words[i] = s
+		}
+	}
+	return strings.Join(words, "")
+}
@@ -0,0 +1,158 @@
+package kibelagen
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoName(t *testing.T) {
+	testCases := []struct {
+		input, expect string
+	}{
+		{"id", "ID"},
+		{"folderId", "FolderID"},
+		{"groupIds", "GroupIDs"},
+		{"contentSummaryHtml", "ContentSummaryHTML"},
+		{"totalCount", "TotalCount"},
+		{"a", "A"},
+	}
+	for _, tc := range testCases {
+		if out := goName(tc.input); out != tc.expect {
+			t.Errorf("goName(%q) = %q, expect: %q", tc.input, out, tc.expect)
+		}
+	}
+}
+
+func setupPackage(t *testing.T, src string) (*Config, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "kibelagen-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := ioutil.ReadFile("testdata/schema.graphql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"schema.graphql": string(schema),
+		"query.go":       src,
+		"kibelagen.yaml": `package: sample
+schema: schema.graphql
+operations: [query.go]
+output: operations_gen.go
+bindings:
+  User: User
+`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := LoadConfig(filepath.Join(dir, "kibelagen.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, func() { os.RemoveAll(dir) }
+}
+
+func TestConfig_Generate(t *testing.T) {
+	c, cleanup := setupPackage(t, "package sample\n\n"+
+		"type User struct {\n\tAccount string `json:\"account\"`\n}\n\n"+
+		"const getNoteQuery = `query($id: ID!) {\n  note(id: $id) { id title html: contentHtml author { account } }\n}`\n\n"+
+		"const countQuery = `{ notes(first: 1) { totalCount } }`\n")
+	defer cleanup()
+
+	src, err := c.Generate()
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	for _, expect := range []string{
+		"type getNoteVariables struct {\n\tID string `json:\"id\"`\n}",
+		"type getNoteData struct {\n\tNote *getNoteNote `json:\"note\"`\n}",
+		"\tHTML   string `json:\"html\"`\n\tAuthor *User  `json:\"author\"`\n",
+		"func (ki *Kibela) doGetNote(ctx context.Context, vars *getNoteVariables) (*getNoteData, error) {",
+		"func (ki *Kibela) doCount(ctx context.Context) (*countData, error) {",
+	} {
+		if !strings.Contains(string(src), expect) {
+			t.Errorf("generated code should contain:\n%s\n\ngenerated:\n%s", expect, src)
+		}
+	}
+}
+
+func TestConfig_Generate_errors(t *testing.T) {
+	testCases := []struct {
+		name string
+		src  string
+		want string
+	}{{
+		name: "invalid selection",
+		src:  "package sample\n\nconst noteQuery = `{ note(id: \"x\") { unknown } }`\n",
+		want: `field "unknown" doesn't exist on type Note`,
+	}, {
+		name: "missing field in bound type",
+		src: "package sample\n\ntype User struct {\n\tName string `json:\"name\"`\n}\n\n" +
+			"const noteQuery = `{ note(id: \"x\") { author { account } } }`\n",
+		want: `User has no field for "account" selected in author`,
+	}, {
+		name: "unbound type",
+		src:  "package sample\n\nconst noteQuery = `{ note(id: \"x\") { author { account } } }`\n",
+		want: "bound type User of author is not a struct declared in the package",
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, cleanup := setupPackage(t, tc.src)
+			defer cleanup()
+			_, err := c.Generate()
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error should contain %q, but: %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestConfig_UpdateSchema(t *testing.T) {
+	published := "type Query { note(id: ID!): Note! }\ntype Note { id: ID! title: String! }\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/schema.graphql":
+			w.Write([]byte(published))
+		case "/broken.graphql":
+			w.Write([]byte("<html>not a schema</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	c, cleanup := setupPackage(t, "package sample\n")
+	defer cleanup()
+	schemaPath := filepath.Join(c.dir, c.Schema)
+	vendored, err := ioutil.ReadFile(schemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/broken.graphql", "/missing.graphql"} {
+		c.SchemaURL = ts.URL + p
+		if err := c.UpdateSchema(context.Background()); err == nil {
+			t.Errorf("%s: error should be occurred", p)
+		}
+		if b, _ := ioutil.ReadFile(schemaPath); string(b) != string(vendored) {
+			t.Errorf("%s: the schema should be kept, but: %q", p, b)
+		}
+	}
+
+	c.SchemaURL = ts.URL + "/schema.graphql"
+	if err := c.UpdateSchema(context.Background()); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if b, _ := ioutil.ReadFile(schemaPath); string(b) != published {
+		t.Errorf("the schema should be updated, but: %q", b)
+	}
+}
@@ -0,0 +1,267 @@
+package kibela
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/xerrors"
+)
+
+// attachmentsDir is the directory in the sync directory into which the attachments
+// referenced by notes are downloaded like "attachments/123/image.png"
+const attachmentsDir = "attachments"
+
+// SetAttachments enables or disables downloading attachments by pull in the sync
+// directory. The links in existing files are rewritten by the next pull.
+func (ki *Kibela) SetAttachments(dir string, enabled bool) error {
+	st, err := ki.syncState(dir)
+	if err != nil {
+		return xerrors.Errorf("failed to SetAttachments: %w", err)
+	}
+	return st.updateSettings(func() bool {
+		if st.Attachments == enabled {
+			return false
+		}
+		st.Attachments = enabled
+		return true
+	})
+}
+
+// attachmentReg matches the URLs of attachments in contents, which are like
+// "/attachments/123" or "https://{team}.kibe.la/attachments/123"
+var attachmentReg = regexp.MustCompile(`(?:https://([0-9A-Za-z-]+)\.kibe\.la)?/attachments/([0-9]+)`)
+
+type attachmentRef struct {
+	start, end int
+	num        int
+	url        string
+}
+
+// attachmentRefs finds the URLs of the attachments of the team in the content.
+// URLs continuing to other paths or queries are ignored.
+func (st *syncState) attachmentRefs(content string) []attachmentRef {
+	var refs []attachmentRef
+	for _, loc := range attachmentReg.FindAllStringSubmatchIndex(content, -1) {
+		start, end := loc[0], loc[1]
+		if loc[2] >= 0 && content[loc[2]:loc[3]] != st.team {
+			continue
+		}
+		if start > 0 && isURLChar(content[start-1]) {
+			continue
+		}
+		if end < len(content) && (isURLChar(content[end]) && content[end] != '.' ||
+			content[end] == '.' && end+1 < len(content) && isURLChar(content[end+1])) {
+			continue
+		}
+		num, err := strconv.Atoi(content[loc[4]:loc[5]])
+		if err != nil {
+			continue
+		}
+		refs = append(refs, attachmentRef{start: start, end: end, num: num, url: content[start:end]})
+	}
+	return refs
+}
+
+func isURLChar(c byte) bool {
+	return c < 0x80 && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))) ||
+		strings.IndexByte("_-./:?#%~", c) >= 0
+}
+
+// attachmentFile returns the path of the downloaded attachment, or the empty string
+// when it hasn't been downloaded
+func (st *syncState) attachmentFile(num int) string {
+	d := filepath.Join(st.dir, attachmentsDir, strconv.Itoa(num))
+	fis, err := ioutil.ReadDir(d)
+	if err != nil {
+		return ""
+	}
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() {
+			return filepath.Join(d, fi.Name())
+		}
+	}
+	return ""
+}
+
+// downloadAttachments downloads the attachments referenced by the content which
+// haven't been downloaded yet, if it is enabled in the sync directory
+func (ki *Kibela) downloadAttachments(ctx context.Context, st *syncState, content string) error {
+	if !st.attachments() {
+		return nil
+	}
+	for _, ref := range st.attachmentRefs(content) {
+		if st.attachmentFile(ref.num) != "" {
+			continue
+		}
+		if err := ki.downloadAttachment(ctx, st, ref.num); err != nil {
+			return xerrors.Errorf("failed to download attachment %d: %w", ref.num, err)
+		}
+	}
+	return nil
+}
+
+func (ki *Kibela) downloadAttachment(ctx context.Context, st *syncState, num int) error {
+	resp, err := ki.cli.Get(ctx, fmt.Sprintf("/attachments/%d", num))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// download into the meta directory first not to leave partial files
+	tmpDir := filepath.Join(st.dir, syncMetaDir)
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(tmpDir, "attachment")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fpath := filepath.Join(st.dir, attachmentsDir, strconv.Itoa(num), attachmentFilename(resp.Header))
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), fpath); err != nil {
+		return err
+	}
+	log.Printf("downloaded %q", fpath)
+	return nil
+}
+
+// attachmentFilename decides the filename of the attachment by the Content-Disposition
+// or the Content-Type. Characters which can't be in Markdown links without escaping are
+// replaced with "_".
+func attachmentFilename(h http.Header) string {
+	var name string
+	if _, params, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil {
+		name = filepath.Base(filepath.FromSlash(params["filename"]))
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune(`"'<>()[]/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, ".")
+	if name != "" {
+		return name
+	}
+	name = "attachment"
+	if mt, _, err := mime.ParseMediaType(h.Get("Content-Type")); err == nil {
+		// the extensions are sorted, and the last one is the common one like ".jpg"
+		if exts, _ := mime.ExtensionsByType(mt); len(exts) > 0 {
+			name += exts[len(exts)-1]
+		}
+	}
+	return name
+}
+
+// localizeAttachments rewrites the URLs of the downloaded attachments in the content
+// of the MD into the paths relative to the file. The URLs are remembered in the MD to
+// restore them exactly on push. When an attachment is referenced by different URLs,
+// only the first form is rewritten.
+func (st *syncState) localizeAttachments(m *MD) {
+	urls := make(map[int]string)
+	var (
+		b    strings.Builder
+		last int
+	)
+	for _, ref := range st.attachmentRefs(m.Content) {
+		if u, ok := urls[ref.num]; ok && u != ref.url {
+			continue
+		}
+		fpath := st.attachmentFile(ref.num)
+		if fpath == "" {
+			continue
+		}
+		rel, err := relPathFrom(m.filepath, fpath)
+		if err != nil {
+			continue
+		}
+		urls[ref.num] = ref.url
+		b.WriteString(m.Content[last:ref.start])
+		b.WriteString(filepath.ToSlash(rel))
+		last = ref.end
+	}
+	b.WriteString(m.Content[last:])
+	m.Content = b.String()
+	m.attachments = urls
+}
+
+// localAttachmentReg matches the relative paths of the downloaded attachments
+var localAttachmentReg = regexp.MustCompile(`(?:\.\.?/)*` + attachmentsDir + `/([0-9]+)/[^\s"'<>()\[\]/\\]+`)
+
+// remoteAttachments returns the content of the MD whose relative paths of the
+// downloaded attachments are restored to the URLs. The URLs remembered by
+// localizeAttachments are used, and "/attachments/{id}" otherwise. The URLs
+// used are remembered in the MD.
+func (st *syncState) remoteAttachments(m *MD, urls map[int]string) string {
+	used := make(map[int]string)
+	var (
+		b    strings.Builder
+		last int
+	)
+	content := m.Content
+	for _, loc := range localAttachmentReg.FindAllStringSubmatchIndex(content, -1) {
+		start, end := loc[0], loc[1]
+		if start > 0 && isURLChar(content[start-1]) || end < len(content) && content[end] == '/' {
+			continue
+		}
+		num, err := strconv.Atoi(content[loc[2]:loc[3]])
+		if err != nil {
+			continue
+		}
+		fpath := st.attachmentFile(num)
+		if fpath == "" || !samePath(filepath.Join(filepath.Dir(m.filepath), filepath.FromSlash(content[start:end])), fpath) {
+			continue
+		}
+		u, ok := urls[num]
+		if !ok {
+			u = fmt.Sprintf("/attachments/%d", num)
+		}
+		used[num] = u
+		b.WriteString(content[last:start])
+		b.WriteString(u)
+		last = end
+	}
+	b.WriteString(content[last:])
+	m.attachments = used
+	return b.String()
+}
+
+func samePath(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && a == b
+}
+
+// relPathFrom returns the path of the target relative to the directory of the file
+func relPathFrom(fpath, target string) (string, error) {
+	from, err := filepath.Abs(filepath.Dir(fpath))
+	if err != nil {
+		return "", err
+	}
+	to, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(from, to)
+}
@@ -0,0 +1,93 @@
+package kibela
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncState_localizeAttachments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kibelasync-attachments-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"1/image.png", "2/doc.pdf"} {
+		fpath := filepath.Join(dir, attachmentsDir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st := &syncState{dir: dir, team: "example"}
+
+	testCases := []struct {
+		name    string
+		fpath   string
+		content string
+		expect  string
+	}{{
+		name:    "image",
+		fpath:   "1.md",
+		content: "![image](/attachments/1)\n",
+		expect:  "![image](attachments/1/image.png)\n",
+	}, {
+		name:    "folder layout",
+		fpath:   "Home/daily/1-hello.md",
+		content: `<img src="https://example.kibe.la/attachments/1" width="100"> [doc](/attachments/2).` + "\n",
+		expect:  `<img src="../../attachments/1/image.png" width="100"> [doc](../../attachments/2/doc.pdf).` + "\n",
+	}, {
+		name:    "different forms of the same attachment",
+		fpath:   "1.md",
+		content: "![a](https://example.kibe.la/attachments/1) ![b](/attachments/1)\n",
+		expect:  "![a](attachments/1/image.png) ![b](/attachments/1)\n",
+	}, {
+		name:    "not downloaded, other teams and other paths",
+		fpath:   "1.md",
+		content: "/attachments/3 https://other.kibe.la/attachments/1 https://example.com/attachments/1 /attachments/1/x /attachments/1?w=1\n",
+		expect:  "/attachments/3 https://other.kibe.la/attachments/1 https://example.com/attachments/1 /attachments/1/x /attachments/1?w=1\n",
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &MD{Content: tc.content, filepath: filepath.Join(dir, filepath.FromSlash(tc.fpath))}
+			st.localizeAttachments(m)
+			if m.Content != tc.expect {
+				t.Errorf("localized:\n  got:    %q\n  expect: %q", m.Content, tc.expect)
+			}
+			if got := st.remoteAttachments(m, m.attachments); got != tc.content {
+				t.Errorf("round trip:\n  got:    %q\n  expect: %q", got, tc.content)
+			}
+		})
+	}
+
+	// new links to the downloaded attachments are restored to "/attachments/{id}"
+	m := &MD{Content: "![new](./attachments/2/doc.pdf)\n", filepath: filepath.Join(dir, "3.md")}
+	if got, expect := st.remoteAttachments(m, nil), "![new](/attachments/2)\n"; got != expect {
+		t.Errorf("got: %q, expect: %q", got, expect)
+	}
+}
+
+func TestAttachmentFilename(t *testing.T) {
+	testCases := []struct {
+		disposition, contentType string
+		expect                   string
+	}{
+		{`attachment; filename="image.png"`, "image/png", "image.png"},
+		{`attachment; filename="my (1).png"`, "image/png", "my__1_.png"},
+		{`attachment; filename="../secret"`, "", "secret"},
+		{"", "image/png", "attachment.png"},
+		{"", "", "attachment"},
+	}
+	for _, tc := range testCases {
+		h := http.Header{}
+		h.Set("Content-Disposition", tc.disposition)
+		h.Set("Content-Type", tc.contentType)
+		if got := attachmentFilename(h); got != tc.expect {
+			t.Errorf("%q: got: %q, expect: %q", tc.disposition, got, tc.expect)
+		}
+	}
+}
@@ -2,10 +2,16 @@ package kibela
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/konifar/kibelasync/client"
 	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
 )
 
 // Comment represents comment of Kibela
@@ -14,22 +20,308 @@ type Comment struct {
 	Content     string `json:"content"`
 	Author      User   `json:"author"`
 	PublishedAt Time   `json:"publishedAt"`
+	UpdatedAt   Time   `json:"updatedAt"`
 	Summary     string `json:"summary"`
+	URL         string `json:"url"`
+}
+
+// Comments is a page of comments of a note
+type Comments struct {
+	TotalCount int        `json:"totalCount"`
+	PageInfo   PageInfo   `json:"pageInfo"`
+	Nodes      []*Comment `json:"nodes"`
+}
+
+// PageInfo is the information of the page of a connection
+type PageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
 }
 
 // GetComment gets kibela comment
 func (ki *Kibela) GetComment(ctx context.Context, num int) (*Comment, error) {
 	id := newID(idTypeComment, num)
-	data, err := ki.cli.Do(ctx, &client.Payload{Query: getCommentQuery(id)})
+	res, err := ki.doGetComment(ctx, &getCommentVariables{ID: id})
 	if err != nil {
 		return nil, xerrors.Errorf("failed to ki.GetComment: %w", err)
 	}
-	var res struct {
-		Comment *Comment `json:"comment"`
-	}
-	if err := json.Unmarshal(data, &res); err != nil {
-		return nil, xerrors.Errorf("failed to ki.GetComment: %w", err)
-	}
 	res.Comment.ID = id
 	return res.Comment, nil
 }
+
+// ReadCommentContent reads the content of a comment like NewMD. The frontmatter is
+// stripped if any, and unlike NewMD, the first heading is kept since comments have no
+// titles.
+func ReadCommentContent(r io.Reader) (string, error) {
+	m := &MD{}
+	if err := m.loadContent(r, false, false); err != nil {
+		return "", xerrors.Errorf("failed to ReadCommentContent: %w", err)
+	}
+	content := strings.TrimSpace(m.Content)
+	if content == "" {
+		return "", xerrors.New("content required")
+	}
+	return content + "\n", nil
+}
+
+// PostComment posts the comment on the note, which is specified by a Markdown file, a
+// note number, an ID or a URL like PullNote, and returns the posted comment.
+func (ki *Kibela) PostComment(ctx context.Context, arg, content string) (*Comment, error) {
+	id, _, err := ki.resolveNote(arg)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to PostComment: %w", err)
+	}
+	res, err := ki.doCreateComment(ctx, &createCommentVariables{CommentableID: id, Content: content})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to PostComment: %w", err)
+	}
+	if res.CreateComment == nil || res.CreateComment.Comment == nil {
+		return nil, xerrors.New("failed to PostComment on any reason. null createComment was returned")
+	}
+	return res.CreateComment.Comment, nil
+}
+
+// UpdateComment replaces the content of the comment specified by a comment number, an
+// ID or a URL, and returns the updated comment.
+func (ki *Kibela) UpdateComment(ctx context.Context, arg, content string) (*Comment, error) {
+	id, err := ki.resolveComment(arg)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to UpdateComment: %w", err)
+	}
+	res, err := ki.doUpdateComment(ctx, &updateCommentVariables{ID: id, Content: content})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to UpdateComment: %w", err)
+	}
+	if res.UpdateComment == nil || res.UpdateComment.Comment == nil {
+		return nil, xerrors.New("failed to UpdateComment on any reason. null updateComment was returned")
+	}
+	return res.UpdateComment.Comment, nil
+}
+
+// DeleteComment deletes the comment specified by a comment number, an ID or a URL,
+// and returns the deleted comment. The confirm is called with the remote comment
+// before deleting it unless it is nil, and the comment is kept and nil is returned
+// when it returns false.
+func (ki *Kibela) DeleteComment(ctx context.Context, arg string, confirm func(*Comment) (bool, error)) (*Comment, error) {
+	id, err := ki.resolveComment(arg)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to DeleteComment: %w", err)
+	}
+	if confirm != nil {
+		res, err := ki.doGetComment(ctx, &getCommentVariables{ID: id})
+		if err != nil {
+			return nil, xerrors.Errorf("failed to DeleteComment: %w", err)
+		}
+		res.Comment.ID = id
+		ok, err := confirm(res.Comment)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to DeleteComment: %w", err)
+		}
+		if !ok {
+			return nil, nil
+		}
+	}
+	res, err := ki.doDeleteComment(ctx, &deleteCommentVariables{ID: id})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to DeleteComment: %w", err)
+	}
+	if res.DeleteComment == nil || res.DeleteComment.Comment == nil {
+		return nil, xerrors.New("failed to DeleteComment on any reason. null deleteComment was returned")
+	}
+	return res.DeleteComment.Comment, nil
+}
+
+// commentPageLimit is the number of notes or comments fetched by a request to pull
+// comments
+const commentPageLimit = 100
+
+// commentsPath returns the path of the sidecar file holding the comments of the note
+// file, e.g. "370.comments.yaml" for "370.md"
+func commentsPath(fpath string) string {
+	return strings.TrimSuffix(fpath, ".md") + ".comments.yaml"
+}
+
+// commentYAML is a comment in the sidecar file
+type commentYAML struct {
+	ID          int    `yaml:"id"`
+	Author      string `yaml:"author"`
+	PublishedAt string `yaml:"publishedAt"`
+	// UpdatedAt is written only when the comment has been edited
+	UpdatedAt string `yaml:"updatedAt,omitempty"`
+	Content   string `yaml:"content"`
+}
+
+// PullComments pulls the comments of the notes pulled into the dir into the sidecar
+// files next to the note files, like "370.comments.yaml" for "370.md". Since comments
+// don't change the updatedAt of notes, every note is listed with the number of the
+// comments and the time of the latest comment, and the comments of a note are fetched
+// only when they have changed since the last pull. The comments are fetched by the
+// jobs number of workers concurrently.
+func (ki *Kibela) PullComments(ctx context.Context, dir, folder string, limit, jobs int) (err error) {
+	var folderID ID
+	if folder != "" {
+		var err error
+		folderID, err = ki.fetchFolderID(ctx, folder)
+		if err != nil {
+			return xerrors.Errorf("failed to PullComments: %w", err)
+		}
+	}
+	st, err := ki.syncState(dir)
+	if err != nil {
+		return xerrors.Errorf("failed to PullComments: %w", err)
+	}
+	defer func() {
+		if e := st.save(); e != nil && err == nil {
+			err = xerrors.Errorf("failed to PullComments: %w", e)
+		}
+	}()
+	notes, err := ki.listCommentStats(ctx, folderID, limit)
+	if err != nil {
+		return xerrors.Errorf("failed to PullComments: %w", err)
+	}
+	var updated []*Note
+	for _, n := range notes {
+		num, err := n.ID.Number()
+		if err != nil {
+			return xerrors.Errorf("failed to PullComments: %w", err)
+		}
+		ns := st.get(num)
+		if ns == nil {
+			// not pulled
+			continue
+		}
+		cs := newCommentsState(&n.Comments)
+		if ns.Comments.equal(cs) {
+			if _, err := os.Stat(commentsPath(st.localPath(num))); cs.Count == 0 || err == nil {
+				continue
+			}
+		}
+		updated = append(updated, n)
+	}
+	return runJobs(ctx, len(updated), jobs, func(ctx context.Context, i int) (string, error) {
+		return ki.pullNoteComments(ctx, st, updated[i])
+	})
+}
+
+// listCommentStats lists the notes with the number of the comments and the last comment
+func (ki *Kibela) listCommentStats(ctx context.Context, folderID ID, limit int) ([]*Note, error) {
+	var (
+		notes      []*Note
+		nextCursor string
+	)
+	for {
+		take := commentPageLimit
+		if limit > 0 && limit-len(notes) < take {
+			take = limit - len(notes)
+		}
+		res, err := ki.doListNoteCommentStats(ctx, newNotesVariables(take, folderID, nextCursor, limit > 0))
+		if err != nil {
+			return nil, xerrors.Errorf("failed to ki.listCommentStats: %w", err)
+		}
+		notes = append(notes, res.Notes.Nodes...)
+		if !res.Notes.PageInfo.HasNextPage || (limit > 0 && len(notes) >= limit) {
+			return notes, nil
+		}
+		nextCursor = res.Notes.PageInfo.EndCursor
+	}
+}
+
+// listComments lists all the comments of the note in order of publication
+func (ki *Kibela) listComments(ctx context.Context, id ID) ([]*Comment, error) {
+	var (
+		comments   []*Comment
+		nextCursor string
+	)
+	for {
+		res, err := ki.doListNoteComments(ctx, &listNoteCommentsVariables{ID: id, First: commentPageLimit, After: nextCursor})
+		if err != nil {
+			return nil, xerrors.Errorf("failed to ki.listComments: %w", err)
+		}
+		if res.Note == nil {
+			return nil, xerrors.Errorf("failed to ki.listComments: note %s not found", id)
+		}
+		c := res.Note.Comments
+		comments = append(comments, c.Nodes...)
+		if !c.PageInfo.HasNextPage {
+			return comments, nil
+		}
+		nextCursor = c.PageInfo.EndCursor
+	}
+}
+
+// pullNoteComments saves the comments of the note into the sidecar file, or removes
+// the file when the note has no comments
+func (ki *Kibela) pullNoteComments(ctx context.Context, st *syncState, n *Note) (string, error) {
+	num, err := n.ID.Number()
+	if err != nil {
+		return "", xerrors.Errorf("failed to pullNoteComments: %w", err)
+	}
+	fpath := commentsPath(st.localPath(num))
+	cs := newCommentsState(&n.Comments)
+	if cs.Count == 0 {
+		st.setComments(num, nil)
+		if err := os.Remove(fpath); err != nil {
+			if os.IsNotExist(err) {
+				return "", nil
+			}
+			return "", xerrors.Errorf("failed to pullNoteComments: %w", err)
+		}
+		return fmt.Sprintf("removed %q", fpath), nil
+	}
+	comments, err := ki.listComments(ctx, n.ID)
+	if err != nil {
+		return "", xerrors.Errorf("failed to pullNoteComments: %w", err)
+	}
+	if err := writeComments(fpath, comments); err != nil {
+		return "", xerrors.Errorf("failed to pullNoteComments: %w", err)
+	}
+	st.setComments(num, cs)
+	return fmt.Sprintf("saved comments to %q", fpath), nil
+}
+
+func writeComments(fpath string, comments []*Comment) error {
+	cys := make([]*commentYAML, len(comments))
+	for i, c := range comments {
+		num, err := c.ID.Number()
+		if err != nil {
+			return err
+		}
+		cy := &commentYAML{
+			ID:          num,
+			Author:      c.Author.Account,
+			PublishedAt: c.PublishedAt.Format(time.RFC3339),
+			Content:     c.Content,
+		}
+		if c.UpdatedAt.After(c.PublishedAt.Time) {
+			cy.UpdatedAt = c.UpdatedAt.Format(time.RFC3339)
+		}
+		cys[i] = cy
+	}
+	b, err := yaml.Marshal(cys)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fpath, b, 0644)
+}
+
+func newCommentsState(c *Comments) *commentsState {
+	cs := &commentsState{Count: c.TotalCount}
+	if len(c.Nodes) > 0 && c.Nodes[0] != nil {
+		last := c.Nodes[len(c.Nodes)-1]
+		cs.LatestAt = last.PublishedAt
+		if last.UpdatedAt.After(cs.LatestAt.Time) {
+			cs.LatestAt = last.UpdatedAt
+		}
+	}
+	return cs
+}
+
+func (cs *commentsState) equal(o *commentsState) bool {
+	if cs == nil || o == nil {
+		return cs == nil && (o == nil || o.Count == 0)
+	}
+	return cs.Count == o.Count && cs.LatestAt.Equal(o.LatestAt.Time)
+}
@@ -0,0 +1,38 @@
+package kibela
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadCommentContent(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  string
+		expect string
+		hasErr bool
+	}{
+		{name: "plain", input: "LGTM", expect: "LGTM\n"},
+		{name: "heading", input: "# Review\r\n\r\nLGTM\r\n", expect: "# Review\n\nLGTM\n"},
+		{name: "frontmatter", input: "---\ntitle: memo\n---\n\nLGTM\n", expect: "LGTM\n"},
+		{name: "BOM and CRLF", input: "\ufeff---\r\ntitle: memo\r\n---\r\n# Review\r\nLGTM\r\n", expect: "# Review\nLGTM\n"},
+		{name: "empty", input: " \n\n", hasErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ReadCommentContent(strings.NewReader(tc.input))
+			if tc.hasErr {
+				if err == nil {
+					t.Errorf("error should be occurred, but got: %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error should be nil, but: %s", err)
+			}
+			if got != tc.expect {
+				t.Errorf("got: %q, expect: %q", got, tc.expect)
+			}
+		})
+	}
+}
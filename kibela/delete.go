@@ -0,0 +1,125 @@
+package kibela
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// trashDir is the directory in the sync directory to which local files of deleted
+// notes are moved
+const trashDir = ".trash"
+
+// DeleteNote deletes the note specified by the Markdown file, the number, the ID or the
+// URL from Kibela. Then the local file, its base snapshot and its sync state in the dir are
+// removed. The local file is moved into ".trash" instead when trash is true.
+// The confirm is called with the remote note before deleting it unless it is nil, and
+// the note is kept when it returns false. Comment URLs are refused not to delete the
+// whole note by mistake.
+func (ki *Kibela) DeleteNote(ctx context.Context, dir, arg string, trash bool, confirm func(*Note) (bool, error)) error {
+	if !strings.HasSuffix(arg, ".md") {
+		if id, err := parseID(arg, ki.team); err == nil && id.Type() == idTypeComment {
+			return xerrors.Errorf("failed to DeleteNote: %s specifies a comment, not a note", arg)
+		}
+	}
+	id, fpath, err := ki.resolveNote(arg)
+	if err != nil {
+		return xerrors.Errorf("failed to DeleteNote: %w", err)
+	}
+	num, err := id.Number()
+	if err != nil {
+		return xerrors.Errorf("failed to DeleteNote: %w", err)
+	}
+	n, err := ki.getNote(ctx, id)
+	if err != nil {
+		return xerrors.Errorf("failed to DeleteNote: %w", err)
+	}
+	if confirm != nil {
+		ok, err := confirm(n)
+		if err != nil {
+			return xerrors.Errorf("failed to DeleteNote: %w", err)
+		}
+		if !ok {
+			return nil
+		}
+	}
+	res, err := ki.doDeleteNote(ctx, &deleteNoteVariables{ID: n.ID})
+	if err != nil {
+		return xerrors.Errorf("failed to DeleteNote while accessing remote: %w", err)
+	}
+	if res.DeleteNote == nil || res.DeleteNote.Note == nil {
+		return xerrors.New("failed to delete the note on any reason. null deleteNote was returned")
+	}
+	log.Printf("deleted %s", ki.noteURL(n))
+
+	if fpath != "" {
+		dir = findSyncDir(fpath)
+	}
+	st, err := ki.syncState(dir)
+	if err != nil {
+		return xerrors.Errorf("failed to DeleteNote: %w", err)
+	}
+	if fpath == "" {
+		fpath = st.localPath(num)
+	}
+	if err := removeLocalNote(dir, num, fpath, trash); err != nil {
+		return xerrors.Errorf("failed to DeleteNote: %w", err)
+	}
+	st.forget(num)
+	return st.save()
+}
+
+// removeLocalNote removes the local file of the note, the sidecar file of its comments
+// and its base snapshot. The files are moved into the trash directory instead when
+// trash is true, keeping their paths in the dir, so that files of the same name in
+// different folders don't overwrite each other.
+func removeLocalNote(dir string, num int, fpath string, trash bool) error {
+	for _, f := range []string{fpath, commentsPath(fpath)} {
+		if _, err := os.Stat(f); err != nil {
+			continue
+		}
+		if trash {
+			dst := filepath.Join(dir, trashDir, trashPath(dir, f))
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return xerrors.Errorf("failed to move %q to trash: %w", f, err)
+			}
+			if err := os.Rename(f, dst); err != nil {
+				return xerrors.Errorf("failed to move %q to trash: %w", f, err)
+			}
+			log.Printf("moved %q to %q", f, dst)
+		} else {
+			if err := os.Remove(f); err != nil {
+				return xerrors.Errorf("failed to remove %q: %w", f, err)
+			}
+			log.Printf("removed %q", f)
+		}
+	}
+	basePath := filepath.Join(dir, syncMetaDir, baseDir, fmt.Sprintf("%d.md", num))
+	if err := os.Remove(basePath); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("failed to remove base: %w", err)
+	}
+	return nil
+}
+
+// trashPath returns the path of the file relative to the dir, or its base name
+// when it isn't in the dir
+func trashPath(dir, fpath string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return filepath.Base(fpath)
+	}
+	abs, err := filepath.Abs(fpath)
+	if err != nil {
+		return filepath.Base(fpath)
+	}
+	rel, err := filepath.Rel(absDir, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Base(fpath)
+	}
+	return rel
+}
@@ -0,0 +1,44 @@
+package kibela
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveLocalNote_trash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kibelasync-delete-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// notes of the same slug in different folders
+	files := map[int]string{
+		1: filepath.Join(dir, "Home", "daily", "memo.md"),
+		2: filepath.Join(dir, "Dev", "memo.md"),
+	}
+	for num, fpath := range files {
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(filepath.Dir(fpath)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := removeLocalNote(dir, num, fpath, true); err != nil {
+			t.Fatalf("error should be nil, but: %s", err)
+		}
+	}
+	for _, fpath := range files {
+		rel, _ := filepath.Rel(dir, fpath)
+		b, err := ioutil.ReadFile(filepath.Join(dir, trashDir, rel))
+		if err != nil {
+			t.Errorf("the file should be moved to trash, but: %s", err)
+			continue
+		}
+		if string(b) != filepath.Dir(fpath) {
+			t.Errorf("the file in trash is overwritten: %s", b)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package kibela
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type editKind int
+
+const (
+	editEqual editKind = iota
+	editDelete
+	editInsert
+)
+
+type edit struct {
+	kind editKind
+	text string
+}
+
+// splitLines splits s into lines keeping their trailing newlines,
+// so that strings.Join(splitLines(s), "") == s
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// maxDiffTokens is the max number of the tokens in the changed region compared by diffTokens.
+// Larger regions are treated as replaced entirely, which makes one hunk or one conflict,
+// since the cost of the comparison grows with the square of the changed tokens.
+const maxDiffTokens = 10000
+
+// diffTokens computes the shortest edit script which converts a into b
+// by using the linear space variation of the Myers' O(ND) difference algorithm.
+// ref. http://www.xmailserver.org/diff2.pdf
+func diffTokens(a, b []string) []edit {
+	return diffTokensLimit(a, b, maxDiffTokens)
+}
+
+// diffTokensLimit is diffTokens which treats the changed region as replaced entirely
+// when it has more than limit tokens.
+func diffTokensLimit(a, b []string, limit int) []edit {
+	d := &differ{a: a, b: b}
+	aLo, aHi, bLo, bHi := d.trim(0, len(a), 0, len(b))
+	if (aHi-aLo)+(bHi-bLo) > limit {
+		d.replace(aLo, aHi, bLo, bHi)
+	} else {
+		d.compare(aLo, aHi, bLo, bHi)
+	}
+	d.equal(aHi, len(a))
+	return sortChanges(d.edits)
+}
+
+type differ struct {
+	a, b  []string
+	edits []edit
+}
+
+// trim emits the common prefix of the ranges and returns the ranges without
+// the common prefix and suffix. The caller emits the suffix.
+func (d *differ) trim(aLo, aHi, bLo, bHi int) (int, int, int, int) {
+	start := aLo
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	d.equal(start, aLo)
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	return aLo, aHi, bLo, bHi
+}
+
+func (d *differ) equal(lo, hi int) {
+	for _, s := range d.a[lo:hi] {
+		d.edits = append(d.edits, edit{kind: editEqual, text: s})
+	}
+}
+
+func (d *differ) replace(aLo, aHi, bLo, bHi int) {
+	for _, s := range d.a[aLo:aHi] {
+		d.edits = append(d.edits, edit{kind: editDelete, text: s})
+	}
+	for _, s := range d.b[bLo:bHi] {
+		d.edits = append(d.edits, edit{kind: editInsert, text: s})
+	}
+}
+
+// compare emits the edit script of a[aLo:aHi] and b[bLo:bHi] by dividing them
+// at the middle snake recursively.
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	suffix := aHi
+	aLo, aHi, bLo, bHi = d.trim(aLo, aHi, bLo, bHi)
+	if aLo == aHi || bLo == bHi {
+		d.replace(aLo, aHi, bLo, bHi)
+	} else {
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		d.equal(x, u)
+		d.compare(u, aHi, v, bHi)
+	}
+	d.equal(aHi, suffix)
+}
+
+// middleSnake finds the snake in the middle of the shortest edit script of
+// a[aLo:aHi] and b[bLo:bHi] by searching from the both ends, and returns the
+// start (x, y) and the end (u, v) of it. The ranges must have neither common
+// prefix nor common suffix, so that both halves are shorter than the whole.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	max := (n + m + 1) / 2
+	offset := max + 1
+	// vf holds the furthest x on each diagonal k = x - y from the start, and vb holds
+	// the furthest distance from the end on each diagonal k = (n - x) - (m - y).
+	vf, vb := make([]int, 2*max+3), make([]int, 2*max+3)
+	for dd := 0; dd <= max; dd++ {
+		for k := -dd; k <= dd; k += 2 {
+			var fx int
+			if k == -dd || (k != dd && vf[offset+k-1] < vf[offset+k+1]) {
+				fx = vf[offset+k+1]
+			} else {
+				fx = vf[offset+k-1] + 1
+			}
+			fy := fx - k
+			sx, sy := fx, fy
+			for fx < n && fy < m && d.a[aLo+fx] == d.b[bLo+fy] {
+				fx++
+				fy++
+			}
+			vf[offset+k] = fx
+			if rk := delta - k; odd && -(dd-1) <= rk && rk <= dd-1 && fx+vb[offset+rk] >= n {
+				return aLo + sx, bLo + sy, aLo + fx, bLo + fy
+			}
+		}
+		for k := -dd; k <= dd; k += 2 {
+			var rx int
+			if k == -dd || (k != dd && vb[offset+k-1] < vb[offset+k+1]) {
+				rx = vb[offset+k+1]
+			} else {
+				rx = vb[offset+k-1] + 1
+			}
+			ry := rx - k
+			sx, sy := rx, ry
+			for rx < n && ry < m && d.a[aHi-1-rx] == d.b[bHi-1-ry] {
+				rx++
+				ry++
+			}
+			vb[offset+k] = rx
+			if fk := delta - k; !odd && -dd <= fk && fk <= dd && rx+vf[offset+fk] >= n {
+				return aHi - rx, bHi - ry, aHi - sx, bHi - sy
+			}
+		}
+	}
+	// never reached since the paths from the both ends always overlap
+	return aLo, bLo, aLo, bLo
+}
+
+// sortChanges moves deletions before insertions in each run of changes, which are
+// mixed by dividing the sequences.
+func sortChanges(edits []edit) []edit {
+	for i := 0; i < len(edits); {
+		if edits[i].kind == editEqual {
+			i++
+			continue
+		}
+		j := i
+		for j < len(edits) && edits[j].kind != editEqual {
+			j++
+		}
+		run := make([]edit, 0, j-i)
+		for _, e := range edits[i:j] {
+			if e.kind == editDelete {
+				run = append(run, e)
+			}
+		}
+		for _, e := range edits[i:j] {
+			if e.kind == editInsert {
+				run = append(run, e)
+			}
+		}
+		copy(edits[i:j], run)
+		i = j
+	}
+	return edits
+}
+
+// matchIndexes returns the slice which maps each index of a to the matched index of b.
+// The value is -1 when the element isn't matched.
+func matchIndexes(a, b []string) []int {
+	idx := make([]int, len(a))
+	i, j := 0, 0
+	for _, e := range diffTokens(a, b) {
+		switch e.kind {
+		case editEqual:
+			idx[i] = j
+			i++
+			j++
+		case editDelete:
+			idx[i] = -1
+			i++
+		case editInsert:
+			j++
+		}
+	}
+	return idx
+}
+
+const diffContextLines = 3
+
+type hunk struct {
+	edits      []edit
+	fromLine   int
+	toLine     int
+	fromN, toN int
+}
+
+// unifiedDiff renders the differences between from and to in the unified format.
+// It returns an empty string when there are no differences. When wordDiff is true,
+// changed lines are rendered like `git diff --word-diff=plain`.
+func unifiedDiff(fromName, toName, from, to string, wordDiff bool) string {
+	edits := diffTokens(splitLines(from), splitLines(to))
+	hunks := buildHunks(edits)
+	if len(hunks) == 0 {
+		return ""
+	}
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", fromName, toName)
+	for _, h := range hunks {
+		fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(h.fromLine, h.fromN), hunkRange(h.toLine, h.toN))
+		if wordDiff {
+			writeWordDiffHunk(buf, h.edits)
+			continue
+		}
+		for _, e := range h.edits {
+			prefix := " "
+			switch e.kind {
+			case editDelete:
+				prefix = "-"
+			case editInsert:
+				prefix = "+"
+			}
+			buf.WriteString(prefix + e.text)
+			if !strings.HasSuffix(e.text, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return buf.String()
+}
+
+func hunkRange(line, n int) string {
+	if n == 0 {
+		// the empty range starts at the line just before
+		return fmt.Sprintf("%d,0", line-1)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", line)
+	}
+	return fmt.Sprintf("%d,%d", line, n)
+}
+
+func buildHunks(edits []edit) []*hunk {
+	// line numbers (1-origin) of each edit in from and to
+	fromLines, toLines := make([]int, len(edits)), make([]int, len(edits))
+	fromL, toL := 1, 1
+	var changed []int
+	for i, e := range edits {
+		fromLines[i], toLines[i] = fromL, toL
+		switch e.kind {
+		case editEqual:
+			fromL++
+			toL++
+		case editDelete:
+			fromL++
+			changed = append(changed, i)
+		case editInsert:
+			toL++
+			changed = append(changed, i)
+		}
+	}
+
+	var hunks []*hunk
+	for ci := 0; ci < len(changed); ci++ {
+		start := changed[ci] - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := changed[ci]
+		// merge the changes when the context lines between them overlap
+		for ci+1 < len(changed) && changed[ci+1]-end <= 2*diffContextLines+1 {
+			ci++
+			end = changed[ci]
+		}
+		end += diffContextLines + 1
+		if end > len(edits) {
+			end = len(edits)
+		}
+		h := &hunk{
+			edits:    edits[start:end],
+			fromLine: fromLines[start],
+			toLine:   toLines[start],
+		}
+		for _, e := range h.edits {
+			if e.kind != editInsert {
+				h.fromN++
+			}
+			if e.kind != editDelete {
+				h.toN++
+			}
+		}
+		hunks = append(hunks, h)
+	}
+	return hunks
+}
+
+// maxWordDiffTokens is the max number of the words in the changed lines compared by the word diff.
+// Larger changes are rendered as the deleted and inserted lines, since each Japanese character is a word.
+const maxWordDiffTokens = 2000
+
+func writeWordDiffHunk(buf *strings.Builder, edits []edit) {
+	for i := 0; i < len(edits); {
+		if edits[i].kind == editEqual {
+			buf.WriteString(edits[i].text)
+			i++
+			continue
+		}
+		var deleted, inserted strings.Builder
+		for ; i < len(edits) && edits[i].kind != editEqual; i++ {
+			if edits[i].kind == editDelete {
+				deleted.WriteString(edits[i].text)
+			} else {
+				inserted.WriteString(edits[i].text)
+			}
+		}
+		words := diffTokensLimit(splitWords(deleted.String()), splitWords(inserted.String()), maxWordDiffTokens)
+		for j := 0; j < len(words); {
+			kind := words[j].kind
+			var run strings.Builder
+			for ; j < len(words) && words[j].kind == kind; j++ {
+				run.WriteString(words[j].text)
+			}
+			switch kind {
+			case editEqual:
+				buf.WriteString(run.String())
+			case editDelete:
+				writeWordDiffRun(buf, "[-", run.String(), "-]")
+			case editInsert:
+				writeWordDiffRun(buf, "{+", run.String(), "+}")
+			}
+		}
+	}
+}
+
+// writeWordDiffRun writes the changed run enclosing with the markers line by line,
+// so that the markers never span lines.
+func writeWordDiffRun(buf *strings.Builder, open, run, close string) {
+	for _, line := range splitLines(run) {
+		text := strings.TrimSuffix(line, "\n")
+		if text != "" {
+			buf.WriteString(open + text + close)
+		}
+		if text != line {
+			buf.WriteString("\n")
+		}
+	}
+}
+
+type runeClass int
+
+const (
+	runeOther runeClass = iota
+	runeSpace
+	runeWord
+)
+
+func classifyRune(r rune) runeClass {
+	switch {
+	case r == '\n':
+		return runeOther
+	case unicode.IsSpace(r):
+		return runeSpace
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana):
+		return runeOther
+	case unicode.IsLetter(r), unicode.IsDigit(r), r == '_':
+		return runeWord
+	}
+	return runeOther
+}
+
+// splitWords splits s into words for the word diff. Runs of letters and digits, and
+// runs of spaces are words. Since Japanese sentences have no spaces between words,
+// each Kanji, Hiragana and Katakana character is treated as a word like punctuations
+// and newlines.
+func splitWords(s string) []string {
+	var (
+		words []string
+		start int
+		prev  = runeOther
+	)
+	for i, r := range s {
+		cls := classifyRune(r)
+		if i > start && (cls != prev || cls == runeOther) {
+			words = append(words, s[start:i])
+			start = i
+		}
+		prev = cls
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	return words
+}
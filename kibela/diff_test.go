@@ -0,0 +1,168 @@
+package kibela
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffTokens(t *testing.T) {
+	a := strings.Split("ABCABBA", "")
+	b := strings.Split("CBABAC", "")
+	edits := diffTokens(a, b)
+	var from, to []string
+	changes := 0
+	for _, e := range edits {
+		if e.kind != editInsert {
+			from = append(from, e.text)
+		}
+		if e.kind != editDelete {
+			to = append(to, e.text)
+		}
+		if e.kind != editEqual {
+			changes++
+		}
+	}
+	if !reflect.DeepEqual(from, a) || !reflect.DeepEqual(to, b) {
+		t.Errorf("edit script doesn't reproduce inputs: %v", edits)
+	}
+	// the shortest edit script of the example in the Myers' paper has 5 changes
+	if changes != 5 {
+		t.Errorf("changes = %d, expect: 5", changes)
+	}
+}
+
+func TestDiffTokens_shortest(t *testing.T) {
+	// compare the number of changes with the length of the longest common subsequence
+	lcs := func(a, b []string) int {
+		dp := make([][]int, len(a)+1)
+		for i := range dp {
+			dp[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				switch {
+				case a[i] == b[j]:
+					dp[i][j] = dp[i+1][j+1] + 1
+				case dp[i+1][j] > dp[i][j+1]:
+					dp[i][j] = dp[i+1][j]
+				default:
+					dp[i][j] = dp[i][j+1]
+				}
+			}
+		}
+		return dp[0][0]
+	}
+	rnd := rand.New(rand.NewSource(1))
+	gen := func() []string {
+		s := make([]string, rnd.Intn(20))
+		for i := range s {
+			s[i] = string('A' + rune(rnd.Intn(3)))
+		}
+		return s
+	}
+	for i := 0; i < 1000; i++ {
+		a, b := gen(), gen()
+		var from, to []string
+		changes := 0
+		for _, e := range diffTokens(a, b) {
+			if e.kind != editInsert {
+				from = append(from, e.text)
+			}
+			if e.kind != editDelete {
+				to = append(to, e.text)
+			}
+			if e.kind != editEqual {
+				changes++
+			}
+		}
+		if strings.Join(from, "") != strings.Join(a, "") || strings.Join(to, "") != strings.Join(b, "") {
+			t.Fatalf("edit script of %q and %q doesn't reproduce inputs", a, b)
+		}
+		if expect := len(a) + len(b) - 2*lcs(a, b); changes != expect {
+			t.Fatalf("changes of %q and %q = %d, expect: %d", a, b, changes, expect)
+		}
+	}
+}
+
+func TestUnifiedDiff_large(t *testing.T) {
+	var from, to strings.Builder
+	for i := 0; i < 4000; i++ {
+		fmt.Fprintf(&from, "line %d\n", i)
+		fmt.Fprintf(&to, "rewritten %d\n", i)
+	}
+	// the changed region larger than maxDiffTokens is replaced entirely in one hunk
+	out := unifiedDiff("a", "b", "head\n"+from.String()+"tail\n", "head\n"+to.String()+"tail\n", false)
+	if n := strings.Count(out, "@@ -"); n != 1 {
+		t.Errorf("hunks = %d, expect: 1", n)
+	}
+	if !strings.HasPrefix(out, "--- a\n+++ b\n@@ -1,4002 +1,4002 @@\n head\n-line 0\n") {
+		t.Errorf("unexpected diff: %.100q", out)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+	to := "1\n2\n3\n4\n5\n6\n7\nhachi\n9\n10\n11\n12\n13\n14\n15\n16\n"
+	expect := `--- remote/1.md
++++ notes/1.md
+@@ -5,7 +5,7 @@
+ 5
+ 6
+ 7
+-8
++hachi
+ 9
+ 10
+ 11
+@@ -13,3 +13,4 @@
+ 13
+ 14
+ 15
++16
+`
+	if out := unifiedDiff("remote/1.md", "notes/1.md", from, to, false); out != expect {
+		t.Errorf("\n   out:\n%s\nexpect:\n%s", out, expect)
+	}
+
+	if out := unifiedDiff("remote/1.md", "notes/1.md", from, from, false); out != "" {
+		t.Errorf("no differences should be empty, but:\n%s", out)
+	}
+}
+
+func TestUnifiedDiff_wordDiff(t *testing.T) {
+	from := "# 議事録\n今日はいい天気です。\n明日は雨です。\n"
+	to := "# 議事録\n今日はとてもいい天気です。\n明日は晴れです。\n"
+	expect := `--- a
++++ b
+@@ -1,3 +1,3 @@
+# 議事録
+今日は{+とても+}いい天気です。
+明日は[-雨-]{+晴れ+}です。
+`
+	if out := unifiedDiff("a", "b", from, to, true); out != expect {
+		t.Errorf("\n   out:\n%s\nexpect:\n%s", out, expect)
+	}
+}
+
+func TestUnifiedDiff_wordDiffLarge(t *testing.T) {
+	from := "# 議事録\n" + strings.Repeat("今日はいい天気です。", 900) + "\n"
+	to := "# 議事録\n" + strings.Repeat("明日は雨が降ります。", 900) + "\n"
+	// the words more than maxWordDiffTokens aren't compared but the common prefix and suffix
+	expect := "--- a\n+++ b\n@@ -1,2 +1,2 @@\n# 議事録\n" +
+		"[-" + strings.TrimSuffix(strings.Repeat("今日はいい天気です。", 900), "す。") + "-]" +
+		"{+" + strings.TrimSuffix(strings.Repeat("明日は雨が降ります。", 900), "す。") + "+}す。\n"
+	if out := unifiedDiff("a", "b", from, to, true); out != expect {
+		t.Errorf("unexpected diff: %.200q", out)
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	out := splitWords("Hello, go_lang  世界とカナ!\n")
+	expect := []string{"Hello", ",", " ", "go_lang", "  ", "世", "界", "と", "カ", "ナ", "!", "\n"}
+	if !reflect.DeepEqual(out, expect) {
+		t.Errorf("\n   out: %q\nexpect: %q", out, expect)
+	}
+}
@@ -0,0 +1,768 @@
+package kibela
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/konifar/kibelasync/client"
+	"github.com/konifar/kibelasync/kibela/kibelatest"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+)
+
+func setupE2E(t *testing.T) (*kibelatest.Server, *Kibela, string) {
+	t.Helper()
+	ts := kibelatest.NewServer()
+	home := ts.AddGroup("Home")
+	ts.AddNote(&kibelatest.Note{Title: "hello", Content: "hello\n\nworld\n", Groups: []*kibelatest.Group{home}})
+	cli, err := client.New("test", ts.Team, ts.Token, client.WithEndpoint(ts.Endpoint()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ki := testKibela(cli)
+	ki.team = ts.Team
+	dir, err := ioutil.TempDir("", "kibelasync-e2e-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PullNotes(context.Background(), dir, "", 0, false, 2, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	return ts, ki, dir
+}
+
+func editMD(t *testing.T, fpath string, fn func(string) string) *MD {
+	t.Helper()
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fpath, []byte(fn(string(b))), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadMD(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestE2E_pullAndPush(t *testing.T) {
+	ts, ki, dir := setupE2E(t)
+	defer ts.Close()
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "1.md")
+	m := editMD(t, fpath, func(s string) string {
+		return strings.Replace(s, "world", "kibela", 1)
+	})
+	if err := ki.PushMD(context.Background(), m); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	n, _ := ts.Note(1)
+	if n.Content != "hello\n\nkibela\n" {
+		t.Errorf("remote content should be updated, but: %q", n.Content)
+	}
+
+	// an edit on the web doesn't conflict with the local edit on another line
+	ts.UpdateNote(1, func(n *kibelatest.Note) { n.Content = "hi\n\nkibela\n" })
+	m = editMD(t, fpath, func(s string) string {
+		return strings.Replace(s, "\nkibela\n", "\nkibelasync\n", 1)
+	})
+	if err := ki.PushMD(context.Background(), m); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	n, _ = ts.Note(1)
+	if n.Content != "hi\n\nkibelasync\n" {
+		t.Errorf("remote content should be merged, but: %q", n.Content)
+	}
+}
+
+func TestE2E_conflict(t *testing.T) {
+	ts, ki, dir := setupE2E(t)
+	defer ts.Close()
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "1.md")
+	ts.UpdateNote(1, func(n *kibelatest.Note) { n.Content = "hello\n\nremote\n" })
+	m := editMD(t, fpath, func(s string) string {
+		return strings.Replace(s, "world", "local", 1)
+	})
+	err := ki.PushMD(context.Background(), m)
+	if !xerrors.Is(err, ErrConflict) {
+		t.Fatalf("error should be ErrConflict, but: %v", err)
+	}
+	n, _ := ts.Note(1)
+	if n.Content != "hello\n\nremote\n" {
+		t.Errorf("remote content should not be changed, but: %q", n.Content)
+	}
+	b, _ := ioutil.ReadFile(fpath)
+	if !hasConflictMarkers(string(b)) {
+		t.Errorf("conflict markers should be written, but: %s", string(b))
+	}
+}
+
+func TestE2E_delete(t *testing.T) {
+	ts, ki, dir := setupE2E(t)
+	defer ts.Close()
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	for _, arg := range []string{"https://kibelatest.kibe.la/notes/1#comment_1", string(newID(idTypeComment, 1))} {
+		if err := ki.DeleteNote(ctx, dir, arg, false, nil); err == nil {
+			t.Errorf("error should be occurred for the comment %s", arg)
+		}
+	}
+	if _, ok := ts.Note(1); !ok {
+		t.Fatal("the note should be kept for comments")
+	}
+
+	deny := func(*Note) (bool, error) { return false, nil }
+	if err := ki.DeleteNote(ctx, dir, "https://kibelatest.kibe.la/notes/1", false, deny); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if _, ok := ts.Note(1); !ok {
+		t.Fatal("the note should be kept when not confirmed")
+	}
+
+	fpath := filepath.Join(dir, "1.md")
+	if err := ki.DeleteNote(ctx, dir, fpath, true, nil); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if _, ok := ts.Note(1); ok {
+		t.Error("the remote note should be deleted")
+	}
+	if _, err := os.Stat(fpath); !os.IsNotExist(err) {
+		t.Errorf("the local file should be removed, but: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, trashDir, "1.md")); err != nil {
+		t.Errorf("the local file should be moved to trash, but: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, syncMetaDir, baseDir, "1.md")); !os.IsNotExist(err) {
+		t.Errorf("the base should be removed, but: %v", err)
+	}
+	st, err := loadSyncState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.get(1) != nil {
+		t.Error("the sync state should be forgotten")
+	}
+
+	if err := ki.DeleteNote(ctx, dir, "1", false, nil); err == nil {
+		t.Error("error should be occurred for the deleted note")
+	}
+}
+
+func TestE2E_pullOrphans(t *testing.T) {
+	testCases := []struct {
+		action               OrphanAction
+		modify, full         bool
+		kept, trashed, state bool
+	}{
+		{action: OrphanIgnore, kept: true, state: true},
+		{action: OrphanReport, kept: true, state: true},
+		{action: OrphanTrash, trashed: true},
+		{action: OrphanDelete},
+		{action: OrphanDelete, modify: true, trashed: true},
+		{action: OrphanTrash, full: true, trashed: true},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s(modify=%t,full=%t)", tc.action, tc.modify, tc.full), func(t *testing.T) {
+			ts, ki, dir := setupE2E(t)
+			defer ts.Close()
+			defer os.RemoveAll(dir)
+
+			fpath := filepath.Join(dir, "1.md")
+			if tc.modify {
+				editMD(t, fpath, func(s string) string { return s + "\nlocal changes\n" })
+			}
+			if err := ts.DeleteNote(1); err != nil {
+				t.Fatal(err)
+			}
+			pull := func() error {
+				return ki.PullNotes(context.Background(), dir, "", 0, false, 2, tc.action)
+			}
+			if tc.full {
+				pull = func() error {
+					return ki.PullFullNotes(context.Background(), dir, "", 0, tc.action)
+				}
+			}
+			if err := pull(); err != nil {
+				t.Fatalf("error should be nil, but: %s", err)
+			}
+			if _, err := os.Stat(fpath); (err == nil) != tc.kept {
+				t.Errorf("kept: %t, but: %v", tc.kept, err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, trashDir, "1.md")); (err == nil) != tc.trashed {
+				t.Errorf("trashed: %t, but: %v", tc.trashed, err)
+			}
+			if got := ki.states[filepath.Clean(dir)].get(1) != nil; got != tc.state {
+				t.Errorf("state: %t, but: %t", tc.state, got)
+			}
+		})
+	}
+
+	ts, ki, dir := setupE2E(t)
+	defer ts.Close()
+	defer os.RemoveAll(dir)
+	if err := ki.PullNotes(context.Background(), dir, "", 1, false, 2, OrphanTrash); err == nil {
+		t.Error("error should be occurred with the limit")
+	}
+	if err := ki.PullFullNotes(context.Background(), dir, "", 1, OrphanTrash); err == nil {
+		t.Error("error should be occurred with the limit")
+	}
+}
+
+func TestE2E_folderLayout(t *testing.T) {
+	ts, ki, dir := setupE2E(t)
+	defer ts.Close()
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	exists := func(t *testing.T, rel string, expect bool) {
+		t.Helper()
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(rel))); (err == nil) != expect {
+			t.Errorf("%s exists: %t, but: %v", rel, expect, err)
+		}
+	}
+
+	// a newer note stops the incremental listing in the order of contentUpdatedAt
+	// before the moved note
+	hello, _ := ts.Note(1)
+	ts.AddNote(&kibelatest.Note{Title: "newer", Content: "newer\n", Groups: hello.Groups})
+
+	// existing files are moved by the next pull after the layout is changed
+	if err := ki.SetLayout(dir, LayoutFolder); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PullNotes(ctx, dir, "", 0, false, 2, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	exists(t, "1.md", false)
+	exists(t, "Home/1-hello.md", true)
+
+	// files are moved when the folder of the note is changed remotely
+	dev := ts.AddGroup("Dev")
+	f := ts.AddFolder(dev, "Design/Docs")
+	if err := ts.UpdateNote(1, func(n *kibelatest.Note) {
+		n.Folders = []*kibelatest.Folder{f}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PullNotes(ctx, dir, "", 0, false, 2, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	exists(t, "Home/1-hello.md", false)
+	fpath := filepath.Join(dir, "Dev", "Design", "Docs", "1-hello.md")
+	exists(t, "Dev/Design/Docs/1-hello.md", true)
+
+	// the note is identified by the id of the frontmatter
+	m := editMD(t, fpath, func(s string) string {
+		return strings.Replace(s, "world", "local world", 1)
+	})
+	if num, err := m.ID.Number(); err != nil || num != 1 {
+		t.Fatalf("number should be 1, but: %d, %v", num, err)
+	}
+	stats, err := ki.Status(ctx, dir)
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	var modified []string
+	for _, st := range stats {
+		if st.Status == StatusModifiedLocally {
+			modified = append(modified, st.Path)
+		}
+	}
+	if len(modified) != 1 || modified[0] != fpath {
+		t.Errorf("unexpected status: %v", modified)
+	}
+	if err := ki.PushMD(ctx, m); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	n, _ := ts.Note(1)
+	if !strings.Contains(n.Content, "local world") {
+		t.Errorf("pushed content is unexpected: %q", n.Content)
+	}
+	exists(t, "Dev/Design/Docs/1-hello.md", true)
+
+	// the directory emptied by the move is removed
+	if err := ts.UpdateNote(2, func(n *kibelatest.Note) {
+		n.Folders = []*kibelatest.Folder{f}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PullNotes(ctx, dir, "", 0, false, 2, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	exists(t, "Home", false)
+	exists(t, "Dev/Design/Docs/2-newer.md", true)
+}
+
+func TestE2E_filenameTemplate(t *testing.T) {
+	ts, ki, dir := setupE2E(t)
+	defer ts.Close()
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	// an unpublished file which must not be overwritten
+	draft := filepath.Join(dir, "design.md")
+	if err := ioutil.WriteFile(draft, []byte("---\ntitle: design\ngroups: [Dev]\n---\n\ndraft\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dev := ts.AddGroup("Dev")
+	ts.AddNote(&kibelatest.Note{Title: "Design", Content: "one\n", Groups: []*kibelatest.Group{dev}})
+	ts.AddNote(&kibelatest.Note{Title: "議事録 10月", Content: "two\n", Groups: []*kibelatest.Group{dev}})
+	ts.AddNote(&kibelatest.Note{Title: "議事録 10月", Content: "three\n", Groups: []*kibelatest.Group{dev}})
+
+	if err := ki.SetFilenameTemplate(dir, "{slug}.md"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PullNotes(ctx, dir, "", 0, false, 1, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	files := func() []string {
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, fi := range fis {
+			if !fi.IsDir() {
+				names = append(names, fi.Name())
+			}
+		}
+		return names
+	}
+	expect := []string{"design-2.md", "design.md", "hello.md", "議事録-10月-3.md", "議事録-10月.md"}
+	if got := files(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("got: %v, expect: %v", got, expect)
+	}
+	if b, _ := ioutil.ReadFile(draft); string(b) != "---\ntitle: design\ngroups: [Dev]\n---\n\ndraft\n" {
+		t.Errorf("unpublished file is overwritten: %q", string(b))
+	}
+
+	// the number is recovered from the "id" field of the frontmatter
+	m, err := LoadMD(filepath.Join(dir, "議事録-10月-3.md"))
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if num, err := m.ID.Number(); err != nil || num != 3 {
+		t.Errorf("number should be 3, but: %d, %v", num, err)
+	}
+
+	// files are renamed when the titles are changed remotely
+	if err := ts.UpdateNote(1, func(n *kibelatest.Note) { n.Title = "Hello Kibela" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PullNotes(ctx, dir, "", 0, false, 1, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	expect = []string{"design-2.md", "design.md", "hello-kibela.md", "議事録-10月-3.md", "議事録-10月.md"}
+	if got := files(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("got: %v, expect: %v", got, expect)
+	}
+	stats, err := ki.Status(ctx, dir)
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	for _, s := range stats {
+		expect := StatusUpToDate
+		if s.Path == draft {
+			expect = StatusUnpublished
+		}
+		if s.Status != expect {
+			t.Errorf("%s: got: %s, expect: %s", s.Path, s.Status, expect)
+		}
+	}
+
+	// the published file keeps its name
+	if err := ki.publishFile(ctx, dir, draft); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if got := files(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("got: %v, expect: %v", got, expect)
+	}
+	if num, err := noteNumberOf(draft); err != nil || num != 5 {
+		t.Errorf("number should be 5, but: %d, %v", num, err)
+	}
+}
+
+func TestE2E_pullComments(t *testing.T) {
+	ts, ki, dir := setupE2E(t)
+	defer ts.Close()
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	n := ts.AddNote(&kibelatest.Note{Title: "design", Content: "review me\n", Groups: []*kibelatest.Group{ts.AddGroup("Dev")}})
+	reviewer := ts.AddUser("reviewer")
+	// more than a page
+	for i := 0; i < commentPageLimit+1; i++ {
+		ts.AddComment(n, reviewer, fmt.Sprintf("comment %d\nsecond line\n", i))
+	}
+	if err := ki.PullNotes(ctx, dir, "", 0, false, 2, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if err := ki.PullComments(ctx, dir, "", 0, 2); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	fpath := filepath.Join(dir, "2.comments.yaml")
+	readComments := func(t *testing.T) []*commentYAML {
+		t.Helper()
+		b, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cys []*commentYAML
+		if err := yaml.Unmarshal(b, &cys); err != nil {
+			t.Fatalf("error should be nil, but: %s", err)
+		}
+		return cys
+	}
+	cys := readComments(t)
+	if len(cys) != commentPageLimit+1 {
+		t.Fatalf("%d comments should be saved, but: %d", commentPageLimit+1, len(cys))
+	}
+	if c := cys[0]; c.Author != "reviewer" || c.Content != "comment 0\nsecond line\n" || c.PublishedAt == "" || c.ID == 0 {
+		t.Errorf("unexpected comment: %+v", c)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "1.comments.yaml")); !os.IsNotExist(err) {
+		t.Errorf("comments of the note without comments should not be saved, but: %v", err)
+	}
+
+	// the comments are not fetched again unless they have changed, even when the
+	// note is pulled again
+	if err := ioutil.WriteFile(fpath, []byte("[]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.UpdateNote(2, func(n *kibelatest.Note) { n.Content = "reviewed\n" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PullNotes(ctx, dir, "", 0, false, 2, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if err := ki.PullComments(ctx, dir, "", 0, 2); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if cys := readComments(t); len(cys) != 0 {
+		t.Errorf("comments should not be refreshed, but: %d", len(cys))
+	}
+
+	ts.AddComment(n, nil, "LGTM")
+	if err := ki.PullComments(ctx, dir, "", 0, 2); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	cys = readComments(t)
+	if len(cys) != commentPageLimit+2 || cys[len(cys)-1].Content != "LGTM" {
+		t.Errorf("comments should be refreshed, but: %d", len(cys))
+	}
+
+	// the comments go along with the note
+	if err := ki.DeleteNote(ctx, dir, "2", true, nil); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, trashDir, "2.comments.yaml")); err != nil {
+		t.Errorf("comments should be trashed, but: %s", err)
+	}
+}
+
+func TestE2E_comment(t *testing.T) {
+	ts, ki, dir := setupE2E(t)
+	defer ts.Close()
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	c, err := ki.PostComment(ctx, filepath.Join(dir, "1.md"), "LGTM\n")
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if c.URL != "https://kibelatest.kibe.la/notes/1#comment_1" {
+		t.Errorf("unexpected URL: %s", c.URL)
+	}
+	if _, err := ki.UpdateComment(ctx, c.URL, "LGTM!\n"); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if rc, _ := ts.Comment(1); rc.Content != "LGTM!\n" {
+		t.Errorf("the comment should be updated, but: %q", rc.Content)
+	}
+
+	declined, err := ki.DeleteComment(ctx, "1", func(c *Comment) (bool, error) {
+		if c.Content != "LGTM!\n" {
+			t.Errorf("unexpected comment to confirm: %+v", c)
+		}
+		return false, nil
+	})
+	if err != nil || declined != nil {
+		t.Fatalf("the comment should be kept, but: %v, %v", declined, err)
+	}
+	if _, ok := ts.Comment(1); !ok {
+		t.Fatal("the comment should be kept")
+	}
+	if _, err := ki.DeleteComment(ctx, "1", nil); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if _, ok := ts.Comment(1); ok {
+		t.Error("the comment should be deleted")
+	}
+	if _, err := ki.UpdateComment(ctx, "https://kibelatest.kibe.la/notes/1", "x"); err == nil {
+		t.Error("error should be occurred for the note URL")
+	}
+}
+
+func TestE2E_attachments(t *testing.T) {
+	ts, ki, dir := setupE2E(t)
+	defer ts.Close()
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	img := ts.AddAttachment("image.png", "image/png", []byte("PNG"))
+	doc := ts.AddAttachment("spec.pdf", "application/pdf", []byte("PDF"))
+	remote := fmt.Sprintf("hello\n\n![image](%s)\n\n<a href=\"https://%s.kibe.la%s\">spec</a> world\n",
+		img.Path(), ts.Team, doc.Path())
+	if err := ts.UpdateNote(1, func(n *kibelatest.Note) { n.Content = remote }); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.SetAttachments(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PullNotes(ctx, dir, "", 0, false, 2, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, attachmentsDir, "1", "image.png"))
+	if err != nil || string(b) != "PNG" {
+		t.Errorf("the attachment should be downloaded, but: %q, %v", b, err)
+	}
+	fpath := filepath.Join(dir, "1.md")
+	m, err := LoadMD(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "hello\n\n![image](attachments/1/image.png)\n\n<a href=\"attachments/2/spec.pdf\">spec</a> world\n"
+	if m.Content != expect {
+		t.Errorf("links should be rewritten:\n  got:    %q\n  expect: %q", m.Content, expect)
+	}
+	if diff, err := ki.DiffMD(ctx, m, false); err != nil || diff != "" {
+		t.Errorf("no differences should be found, but: %q, %v", diff, err)
+	}
+
+	// the links are restored to the URLs on push
+	m = editMD(t, fpath, func(s string) string {
+		return strings.Replace(s, "world", "local world", 1)
+	})
+	if err := ki.PushMD(ctx, m); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	n, _ := ts.Note(1)
+	if expect := strings.Replace(remote, "world", "local world", 1); n.Content != expect {
+		t.Errorf("pushed content is unexpected:\n  got:    %q\n  expect: %q", n.Content, expect)
+	}
+
+	// the links follow the file moved by the layout
+	if err := ki.SetLayout(dir, LayoutFolder); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PullNotes(ctx, dir, "", 0, false, 2, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	fpath = filepath.Join(dir, "Home", "1-hello.md")
+	b, err = ioutil.ReadFile(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "![image](../attachments/1/image.png)") {
+		t.Errorf("links should be relative to the moved file, but:\n%s", b)
+	}
+	stats, err := ki.Status(ctx, dir)
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if len(stats) != 1 || stats[0].Status != StatusUpToDate || stats[0].Path != fpath {
+		t.Errorf("unexpected status: %+v", stats)
+	}
+
+	// the URLs are restored in the local file when disabled
+	if err := ki.SetAttachments(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PullNotes(ctx, dir, "", 0, false, 2, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	m, err = LoadMD(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := ts.Note(1); m.Content != n.Content {
+		t.Errorf("the local content should be the same as the remote:\n  got:    %q\n  expect: %q", m.Content, n.Content)
+	}
+}
+
+func TestE2E_uploadLocalFiles(t *testing.T) {
+	ts, ki, dir := setupE2E(t)
+	defer ts.Close()
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "diagram.png"), []byte("PNG"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fpath := filepath.Join(dir, "1.md")
+	m := editMD(t, fpath, func(s string) string {
+		return strings.Replace(s, "world", "world\n\n![diagram](./diagram.png)", 1)
+	})
+	if err := ki.PushMD(ctx, m); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	n, _ := ts.Note(1)
+	if expect := "hello\n\nworld\n\n![diagram](/attachments/1)\n"; n.Content != expect {
+		t.Errorf("pushed content is unexpected:\n  got:    %q\n  expect: %q", n.Content, expect)
+	}
+	if as := ts.Attachments(); len(as) != 1 || string(as[0].Data) != "PNG" || as[0].Name != "diagram.png" {
+		t.Errorf("the file should be uploaded, but: %+v", as)
+	}
+	m, err := LoadMD(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(m.Content, "![diagram](./diagram.png)") {
+		t.Errorf("the local file should keep the reference, but: %q", m.Content)
+	}
+
+	// the local file keeps the reference after the remote changes are pulled
+	if err := ts.UpdateNote(1, func(n *kibelatest.Note) {
+		n.Content = strings.Replace(n.Content, "hello", "hello remote", 1)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PullNotes(ctx, dir, "", 0, false, 2, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	m, err = LoadMD(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "hello remote\n\nworld\n\n![diagram](./diagram.png)\n"; m.Content != expect {
+		t.Errorf("pulled content is unexpected:\n  got:    %q\n  expect: %q", m.Content, expect)
+	}
+	if diff, err := ki.DiffMD(ctx, m, false); err != nil || diff != "" {
+		t.Errorf("no differences should be found, but: %q, %v", diff, err)
+	}
+
+	// unchanged files are not uploaded again
+	m = editMD(t, fpath, func(s string) string {
+		return strings.Replace(s, "world", "local world", 1)
+	})
+	if err := ki.PushMD(ctx, m); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	draft := filepath.Join(dir, "draft.md")
+	if err := ioutil.WriteFile(draft, []byte("---\ntitle: draft\ngroups: [Home]\n---\n\n![](diagram.png)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.publishFile(ctx, dir, draft); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if as := ts.Attachments(); len(as) != 1 {
+		t.Errorf("the file should not be uploaded again, but: %d", len(as))
+	}
+	n, _ = ts.Note(1)
+	if expect := "hello remote\n\nlocal world\n\n![diagram](/attachments/1)\n"; n.Content != expect {
+		t.Errorf("pushed content is unexpected:\n  got:    %q\n  expect: %q", n.Content, expect)
+	}
+	if n, _ := ts.Note(2); n.Content != "![](/attachments/1)\n" {
+		t.Errorf("published content is unexpected: %q", n.Content)
+	}
+
+	// a changed file is uploaded again
+	if err := ioutil.WriteFile(filepath.Join(dir, "diagram.png"), []byte("PNG2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m = editMD(t, fpath, func(s string) string { return s })
+	if err := ki.PushMD(ctx, m); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if n, _ := ts.Note(1); !strings.Contains(n.Content, "![diagram](/attachments/2)") {
+		t.Errorf("the new attachment should be linked, but: %q", n.Content)
+	}
+}
+
+func TestE2E_links(t *testing.T) {
+	ts, ki, dir := setupE2E(t)
+	defer ts.Close()
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	remote1 := "hello\n\nsee [design](/notes/2) and [the comment](/notes/2#comment_1)\n"
+	if err := ts.UpdateNote(1, func(n *kibelatest.Note) { n.Content = remote1 }); err != nil {
+		t.Fatal(err)
+	}
+	remote2 := "back to [hello](https://kibelatest.kibe.la/@kibelatest/1)\n"
+	ts.AddNote(&kibelatest.Note{Title: "design", Content: remote2, Groups: []*kibelatest.Group{ts.AddGroup("C# 100%")}})
+	if err := ki.SetLayout(dir, LayoutFolder); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.SetFilenameTemplate(dir, "{slug}.md"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.SetLinks(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PullNotes(ctx, dir, "", 0, false, 2, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	read := func(t *testing.T, rel string) string {
+		t.Helper()
+		m, err := LoadMD(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m.Content
+	}
+	if got, expect := read(t, "Home/hello.md"), "hello\n\nsee [design](../C%23%20100%25/design.md) and [the comment](../C%23%20100%25/design.md#comment_1)\n"; got != expect {
+		t.Errorf("links should be rewritten:\n  got:    %q\n  expect: %q", got, expect)
+	}
+	if got, expect := read(t, "C# 100%/design.md"), "back to [hello](../Home/hello.md)\n"; got != expect {
+		t.Errorf("links should be rewritten:\n  got:    %q\n  expect: %q", got, expect)
+	}
+
+	// the links follow the renamed file, and the URLs are restored on push
+	if err := ts.UpdateNote(2, func(n *kibelatest.Note) { n.Title = "design v2" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PullNotes(ctx, dir, "", 0, false, 2, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	fpath := filepath.Join(dir, "Home", "hello.md")
+	m := editMD(t, fpath, func(s string) string {
+		if !strings.Contains(s, "[design](../C%23%20100%25/design-v2.md)") {
+			t.Errorf("links should follow the renamed file, but:\n%s", s)
+		}
+		return strings.Replace(s, "see", "please see", 1)
+	})
+	if err := ki.PushMD(ctx, m); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	n, _ := ts.Note(1)
+	if expect := strings.Replace(remote1, "see", "please see", 1); n.Content != expect {
+		t.Errorf("pushed content is unexpected:\n  got:    %q\n  expect: %q", n.Content, expect)
+	}
+	if diff, err := ki.DiffMD(ctx, m, false); err != nil || diff != "" {
+		t.Errorf("no differences should be found, but: %q, %v", diff, err)
+	}
+
+	// the URLs are restored in the local files when disabled
+	if err := ki.SetLinks(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PullNotes(ctx, dir, "", 0, false, 2, OrphanIgnore); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if got := read(t, "C# 100%/design-v2.md"); got != remote2 {
+		t.Errorf("the local content should be the same as the remote:\n  got:    %q\n  expect: %q", got, remote2)
+	}
+}
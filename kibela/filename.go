@@ -0,0 +1,114 @@
+package kibela
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/xerrors"
+)
+
+// FilenameTemplate is the template of the filenames of notes. "{id}" is replaced
+// with the note number and "{slug}" with the slug of the title.
+type FilenameTemplate string
+
+// Default templates
+const (
+	// FilenameID names files like "370.md"
+	FilenameID FilenameTemplate = "{id}.md"
+	// FilenameIDSlug names files like "370-hello-world.md"
+	FilenameIDSlug FilenameTemplate = "{id}-{slug}.md"
+)
+
+var templateVar = regexp.MustCompile(`\{[^}]*\}`)
+
+// ParseFilenameTemplate parses the filename template. The empty template means the
+// default of the layout.
+func ParseFilenameTemplate(s string) (FilenameTemplate, error) {
+	if s == "" {
+		return "", nil
+	}
+	if !strings.HasSuffix(s, ".md") || strings.ContainsAny(s, `/\`) {
+		return "", fmt.Errorf("invalid filename template (must be a filename ending with .md): %s", s)
+	}
+	vars := templateVar.FindAllString(s, -1)
+	if len(vars) == 0 {
+		return "", fmt.Errorf("invalid filename template (must have {id} or {slug}): %s", s)
+	}
+	for _, v := range vars {
+		if v != "{id}" && v != "{slug}" {
+			return "", fmt.Errorf("invalid filename template (unknown %s): %s", v, s)
+		}
+	}
+	return FilenameTemplate(s), nil
+}
+
+// SetFilenameTemplate sets the filename template of the sync directory. Existing
+// files are renamed by the next pull.
+func (ki *Kibela) SetFilenameTemplate(dir string, t FilenameTemplate) error {
+	st, err := ki.syncState(dir)
+	if err != nil {
+		return xerrors.Errorf("failed to SetFilenameTemplate: %w", err)
+	}
+	return st.updateSettings(func() bool {
+		if st.Filename == t {
+			return false
+		}
+		st.Filename = t
+		return true
+	})
+}
+
+// expand returns the filename of the note. The filename by FilenameID is used when
+// the title has no letters for the slug.
+func (t FilenameTemplate) expand(num int, title string) string {
+	slug := slugify(title)
+	if slug == "" && strings.Contains(string(t), "{slug}") {
+		t = FilenameID
+	}
+	return strings.NewReplacer("{id}", strconv.Itoa(num), "{slug}", slug).Replace(string(t))
+}
+
+const maxSlugLen = 50
+
+// slugify makes the slug of the title by joining the words of letters and digits with
+// "-". Letters other than ASCII, like Japanese, are kept as they are, and full-width
+// ASCII characters are folded. The slug is up to maxSlugLen characters.
+func slugify(title string) string {
+	var (
+		b   strings.Builder
+		n   int
+		sep bool
+	)
+	for _, r := range title {
+		r = unicode.ToLower(foldWidth(r))
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r) {
+			sep = true
+			continue
+		}
+		if sep && n > 0 {
+			if n+2 > maxSlugLen {
+				break
+			}
+			b.WriteByte('-')
+			n++
+		}
+		sep = false
+		if n+1 > maxSlugLen {
+			break
+		}
+		b.WriteRune(r)
+		n++
+	}
+	return b.String()
+}
+
+// foldWidth folds the full-width ASCII character to ASCII
+func foldWidth(r rune) rune {
+	if r >= '！' && r <= '～' {
+		return r - '！' + '!'
+	}
+	return r
+}
@@ -0,0 +1,75 @@
+package kibela
+
+import "testing"
+
+func TestParseFilenameTemplate(t *testing.T) {
+	testCases := []struct {
+		input  string
+		hasErr bool
+	}{
+		{input: ""},
+		{input: "{id}.md"},
+		{input: "{id}-{slug}.md"},
+		{input: "{slug}.md"},
+		{input: "note-{id}.md"},
+		{input: "{id}.txt", hasErr: true},
+		{input: "{group}/{id}.md", hasErr: true},
+		{input: "{title}.md", hasErr: true},
+		{input: "note.md", hasErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := ParseFilenameTemplate(tc.input)
+		if tc.hasErr {
+			if err == nil {
+				t.Errorf("%q: error should be occurred, but got: %q", tc.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: error should be nil, but: %s", tc.input, err)
+		}
+		if string(got) != tc.input {
+			t.Errorf("%q: got: %q", tc.input, got)
+		}
+	}
+}
+
+func TestFilenameTemplate_expand(t *testing.T) {
+	testCases := []struct {
+		template FilenameTemplate
+		title    string
+		expect   string
+	}{
+		{FilenameID, "Hello World", "370.md"},
+		{FilenameIDSlug, "Hello World", "370-hello-world.md"},
+		{"{slug}.md", "設計レビュー: 検索 API", "設計レビュー-検索-api.md"},
+		{"{slug}.md", "!!!", "370.md"},
+		{FilenameIDSlug, "", "370.md"},
+	}
+	for _, tc := range testCases {
+		if got := tc.template.expand(370, tc.title); got != tc.expect {
+			t.Errorf("%q.expand(%q) = %q, expect: %q", tc.template, tc.title, got, tc.expect)
+		}
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	testCases := []struct {
+		input, expect string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  --Go 1.12--  ", "go-1-12"},
+		{"日本語", "日本語"},
+		{"週報 2019-10", "週報-2019-10"},
+		{"「議事録」定例ミーティング（10月）", "議事録-定例ミーティング-10月"},
+		{"ＡＰＩ　設計", "api-設計"},
+		{"ガ", "ガ"},
+		{"aaaaaaaaaa aaaaaaaaaa aaaaaaaaaa aaaaaaaaaa aaaaaaaaa bbb", "aaaaaaaaaa-aaaaaaaaaa-aaaaaaaaaa-aaaaaaaaaa-aaaaaa"},
+		{"あいうえおかきくけこさしすせそたちつてとなにぬねのはひふへほまみむめもやゆよらりるれろわをんアイウエオ", "あいうえおかきくけこさしすせそたちつてとなにぬねのはひふへほまみむめもやゆよらりるれろわをんアイウエ"},
+	}
+	for _, tc := range testCases {
+		if got := slugify(tc.input); got != tc.expect {
+			t.Errorf("slugify(%q) = %q, expect: %q", tc.input, got, tc.expect)
+		}
+	}
+}
@@ -2,9 +2,7 @@ package kibela
 
 import (
 	"context"
-	"encoding/json"
 
-	"github.com/konifar/kibelasync/client"
 	"golang.org/x/xerrors"
 )
 
@@ -12,7 +10,7 @@ import (
 type Folder struct {
 	ID       `json:"id"`
 	FullName string `json:"fullName"`
-	Group    Group  `json:group`
+	Group    Group  `json:"group"`
 }
 
 type Folders struct {
@@ -20,18 +18,10 @@ type Folders struct {
 }
 
 func (ki *Kibela) getFolderCount(ctx context.Context) (int, error) {
-	data, err := ki.cli.Do(ctx, &client.Payload{Query: totalFolderCountQuery})
+	res, err := ki.doTotalFolderCount(ctx)
 	if err != nil {
 		return 0, xerrors.Errorf("failed to ki.getFolderCount: %w", err)
 	}
-	var res struct {
-		Folders struct {
-			TotalCount int `json:"totalCount"`
-		} `json:"folders"`
-	}
-	if err := json.Unmarshal(data, &res); err != nil {
-		return 0, xerrors.Errorf("failed to ki.getNotesCount: %w", err)
-	}
 	return res.Folders.TotalCount, nil
 }
 
@@ -40,16 +30,10 @@ func (ki *Kibela) getFolders(ctx context.Context) ([]*Folder, error) {
 	if err != nil {
 		return nil, xerrors.Errorf("failed to getFolders: %w", err)
 	}
-	data, err := ki.cli.Do(ctx, &client.Payload{Query: listFolderQuery(num)})
+	res, err := ki.doListFolder(ctx, &listFolderVariables{First: num})
 	if err != nil {
 		return nil, xerrors.Errorf("failed to ki.getFolders: %w", err)
 	}
-	var res struct {
-		Folders `json:"folders"`
-	}
-	if err := json.Unmarshal(data, &res); err != nil {
-		return nil, xerrors.Errorf("failed to ki.getFolders: %w", err)
-	}
 	return res.Folders.Nodes, nil
 }
 
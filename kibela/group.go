@@ -2,10 +2,8 @@ package kibela
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
-	"github.com/konifar/kibelasync/client"
 	"golang.org/x/xerrors"
 )
 
@@ -16,18 +14,10 @@ type Group struct {
 }
 
 func (ki *Kibela) getGroupCount(ctx context.Context) (int, error) {
-	data, err := ki.cli.Do(ctx, &client.Payload{Query: totalGroupCountQuery})
+	res, err := ki.doTotalGroupCount(ctx)
 	if err != nil {
 		return 0, xerrors.Errorf("failed to ki.getGroupCount: %w", err)
 	}
-	var res struct {
-		Groups struct {
-			TotalCount int `json:"totalCount"`
-		} `json:"groups"`
-	}
-	if err := json.Unmarshal(data, &res); err != nil {
-		return 0, xerrors.Errorf("failed to ki.getNotesCount: %w", err)
-	}
 	return res.Groups.TotalCount, nil
 }
 
@@ -36,18 +26,10 @@ func (ki *Kibela) getGroups(ctx context.Context) ([]*Group, error) {
 	if err != nil {
 		return nil, xerrors.Errorf("failed to getGroups: %w", err)
 	}
-	data, err := ki.cli.Do(ctx, &client.Payload{Query: listGroupQuery(num)})
+	res, err := ki.doListGroup(ctx, &listGroupVariables{First: num})
 	if err != nil {
 		return nil, xerrors.Errorf("failed to ki.getGroups: %w", err)
 	}
-	var res struct {
-		Groups struct {
-			Nodes []*Group `json:"nodes"`
-		} `json:"groups"`
-	}
-	if err := json.Unmarshal(data, &res); err != nil {
-		return nil, xerrors.Errorf("failed to ki.getNotesCount: %w", err)
-	}
 	return res.Groups.Nodes, nil
 }
 
@@ -3,6 +3,7 @@ package kibela
 import (
 	"encoding/base64"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -56,3 +57,132 @@ func (i ID) Number() (int, error) {
 	}
 	return num, nil
 }
+
+const kibelaDomain = ".kibe.la"
+
+// parseID parses the identifier of a note or a comment, which is one of the followings.
+//
+//   - a note number like "370"
+//   - a base64 encoded ID like "QmxvZy8zNzA"
+//   - a note URL like "https://{team}.kibe.la/notes/370" or "https://{team}.kibe.la/@{account}/382"
+//   - a comment URL like "https://{team}.kibe.la/notes/370#comment_123"
+//
+// The ID of the comment is returned for comment URLs. The team of URLs must match
+// the team unless the team is empty.
+func parseID(arg, team string) (ID, error) {
+	if num, err := strconv.Atoi(arg); err == nil && num > 0 {
+		return newID(idTypeBlog, num), nil
+	}
+	if u, err := url.Parse(arg); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		note, comment, err := parseURL(u, team)
+		if err != nil {
+			return "", err
+		}
+		if !comment.Empty() {
+			return comment, nil
+		}
+		return note, nil
+	}
+	id := ID(strings.TrimRight(arg, "="))
+	switch id.Type() {
+	case idTypeBlog, idTypeComment, idTypeUser:
+		if _, err := id.Number(); err == nil {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("invalid note (must be a number, an ID or a URL of the note): %s", arg)
+}
+
+// parseURL parses the note URL and returns the IDs of the note and the comment
+// specified by the fragment like "#comment_123"
+func parseURL(u *url.URL, team string) (note, comment ID, err error) {
+	if !strings.HasSuffix(u.Hostname(), kibelaDomain) {
+		return "", "", fmt.Errorf("not a URL of Kibela: %s", u)
+	}
+	if urlTeam := strings.TrimSuffix(u.Hostname(), kibelaDomain); team != "" && urlTeam != team {
+		return "", "", fmt.Errorf("the URL is of the team %q, not %q: %s", urlTeam, team, u)
+	}
+	// "/notes/{num}" or "/@{account}/{num}"
+	stuff := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(stuff) != 2 || (stuff[0] != "notes" && !strings.HasPrefix(stuff[0], "@")) {
+		return "", "", fmt.Errorf("not a URL of a note: %s", u)
+	}
+	num, err := strconv.Atoi(stuff[1])
+	if err != nil {
+		return "", "", fmt.Errorf("not a URL of a note: %s", u)
+	}
+	note = newID(idTypeBlog, num)
+	if strings.HasPrefix(u.Fragment, "comment_") {
+		num, err := strconv.Atoi(strings.TrimPrefix(u.Fragment, "comment_"))
+		if err != nil {
+			return "", "", fmt.Errorf("invalid comment in the URL: %s", u)
+		}
+		comment = newID(idTypeComment, num)
+	}
+	return note, comment, nil
+}
+
+// resolveNote resolves the argument specifying a note into its ID. The argument is a
+// Markdown file like "notes/370.md", whose number is taken by noteNumberOf, or one
+// parsed by parseID. Comment URLs are resolved into their notes. The fpath is
+// returned only for the Markdown file.
+func (ki *Kibela) resolveNote(arg string) (id ID, fpath string, err error) {
+	if strings.HasSuffix(arg, ".md") {
+		num, err := noteNumberOf(arg)
+		if err != nil {
+			return "", "", err
+		}
+		return newID(idTypeBlog, num), arg, nil
+	}
+	if u, err := url.Parse(arg); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		note, _, err := parseURL(u, ki.team)
+		return note, "", err
+	}
+	id, err = parseID(arg, ki.team)
+	if err != nil {
+		return "", "", err
+	}
+	if id.Type() != idTypeBlog {
+		return "", "", fmt.Errorf("not a note: %s (%s)", arg, id)
+	}
+	return id, "", nil
+}
+
+// resolveComment resolves the argument specifying a comment into its ID. The argument
+// is a comment number like "123", a base64 encoded ID or a comment URL like
+// "https://{team}.kibe.la/notes/370#comment_123".
+func (ki *Kibela) resolveComment(arg string) (ID, error) {
+	if num, err := strconv.Atoi(arg); err == nil && num > 0 {
+		return newID(idTypeComment, num), nil
+	}
+	id, err := parseID(arg, ki.team)
+	if err != nil {
+		return "", fmt.Errorf("invalid comment (must be a number, an ID or a URL of the comment): %s", arg)
+	}
+	if id.Type() != idTypeComment {
+		return "", fmt.Errorf("not a comment: %s (%s)", arg, id)
+	}
+	return id, nil
+}
+
+// LocalPath returns the path of the local Markdown file of the note in the dir. The
+// argument is a Markdown file, a note number, an ID or a URL of the note, and the
+// Markdown file is returned as it is.
+func (ki *Kibela) LocalPath(dir, arg string) (string, error) {
+	id, fpath, err := ki.resolveNote(arg)
+	if err != nil {
+		return "", err
+	}
+	if fpath != "" {
+		return fpath, nil
+	}
+	num, err := id.Number()
+	if err != nil {
+		return "", err
+	}
+	st, err := ki.syncState(dir)
+	if err != nil {
+		return "", err
+	}
+	return st.localPath(num), nil
+}
@@ -27,3 +27,112 @@ func TestID(t *testing.T) {
 		t.Errorf("id.Number() = %d, expect: %d", num, 366)
 	}
 }
+
+func TestParseID(t *testing.T) {
+	testCases := []struct {
+		input  string
+		expect string
+		hasErr bool
+	}{
+		{input: "370", expect: "Blog/370"},
+		{input: "QmxvZy8zNzA", expect: "Blog/370"},
+		{input: "QmxvZy8zNzA=", expect: "Blog/370"},
+		{input: "Q29tbWVudC8xMjM", expect: "Comment/123"},
+		{input: "https://example.kibe.la/notes/370", expect: "Blog/370"},
+		{input: "https://example.kibe.la/@Songmu/382", expect: "Blog/382"},
+		{input: "https://example.kibe.la/notes/370/", expect: "Blog/370"},
+		{input: "https://example.kibe.la/notes/370#comment_123", expect: "Comment/123"},
+		{input: "https://other.kibe.la/notes/370", hasErr: true},
+		{input: "https://example.kibe.la/groups/370", hasErr: true},
+		{input: "https://example.kibe.la/notes/370#comment_x", hasErr: true},
+		{input: "https://example.com/notes/370", hasErr: true},
+		{input: "R3JvdXAvMQ", hasErr: true},
+		{input: "-1", hasErr: true},
+		{input: "hello", hasErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			id, err := parseID(tc.input, "example")
+			if tc.hasErr {
+				if err == nil {
+					t.Errorf("error should be occurred, but got: %s", id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error should be nil, but: %s", err)
+			}
+			if id.String() != tc.expect {
+				t.Errorf("got: %s, expect: %s", id, tc.expect)
+			}
+		})
+	}
+}
+
+func TestKibela_resolveNote(t *testing.T) {
+	ki := &Kibela{team: "example"}
+	testCases := []struct {
+		input  string
+		num    int
+		fpath  string
+		hasErr bool
+	}{
+		{input: "370", num: 370},
+		{input: "notes/370.md", num: 370, fpath: "notes/370.md"},
+		{input: "https://example.kibe.la/notes/370#comment_123", num: 370},
+		{input: "Q29tbWVudC8xMjM", hasErr: true},
+		{input: "notes/hello.md", hasErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			id, fpath, err := ki.resolveNote(tc.input)
+			if tc.hasErr {
+				if err == nil {
+					t.Errorf("error should be occurred, but got: %s", id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error should be nil, but: %s", err)
+			}
+			if num, _ := id.Number(); num != tc.num || fpath != tc.fpath {
+				t.Errorf("got: (%d, %q), expect: (%d, %q)", num, fpath, tc.num, tc.fpath)
+			}
+		})
+	}
+}
+
+func TestKibela_resolveComment(t *testing.T) {
+	ki := &Kibela{team: "example"}
+	testCases := []struct {
+		input  string
+		expect string
+		hasErr bool
+	}{
+		{input: "123", expect: "Comment/123"},
+		{input: "Q29tbWVudC8xMjM", expect: "Comment/123"},
+		{input: "https://example.kibe.la/notes/370#comment_123", expect: "Comment/123"},
+		{input: "https://example.kibe.la/@Songmu/370#comment_123", expect: "Comment/123"},
+		{input: "https://example.kibe.la/notes/370", hasErr: true},
+		{input: "https://other.kibe.la/notes/370#comment_123", hasErr: true},
+		{input: "QmxvZy8zNzA", hasErr: true},
+		{input: "0", hasErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			id, err := ki.resolveComment(tc.input)
+			if tc.hasErr {
+				if err == nil {
+					t.Errorf("error should be occurred, but got: %s", id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error should be nil, but: %s", err)
+			}
+			if id.String() != tc.expect {
+				t.Errorf("got: %s, expect: %s", id, tc.expect)
+			}
+		})
+	}
+}
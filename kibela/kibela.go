@@ -4,15 +4,18 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/konifar/kibelasync/client"
 	"golang.org/x/xerrors"
 )
 
 const (
-	envKibelaDIR   = "KIBELA_DIR"
-	envKibelaTEAM  = "KIBELA_TEAM"
-	envKibelaTOKEN = "KIBELA_TOKEN"
+	envKibelaDIR      = "KIBELA_DIR"
+	envKibelaTEAM     = "KIBELA_TEAM"
+	envKibelaTOKEN    = "KIBELA_TOKEN"
+	envKibelaENDPOINT = "KIBELA_ENDPOINT"
+	envKibelaTIMEOUT  = "KIBELA_TIMEOUT"
 )
 
 var defaultDir = "notes"
@@ -29,6 +32,8 @@ type Kibela struct {
 	cli *client.Client
 
 	team string
+	// defaultGroups are the groups of notes published without groups
+	defaultGroups []string
 
 	groups     map[string]ID
 	groupsErr  error
@@ -37,24 +42,60 @@ type Kibela struct {
 	folders     map[string]ID
 	foldersErr  error
 	foldersOnce sync.Once
+
+	states   map[string]*syncState
+	statesMu sync.Mutex
+}
+
+// New returns new Kibela client with the profile loaded by LoadProfile(""). The options
+// are applied after the ones specified by KIBELA_ENDPOINT and KIBELA_TIMEOUT env values.
+func New(ver string, opts ...client.Option) (*Kibela, error) {
+	p, err := LoadProfile("")
+	if err != nil {
+		return nil, xerrors.Errorf("failed to kibela.New: %w", err)
+	}
+	return NewWithProfile(ver, p, opts...)
 }
 
-// New returns new Kibela client
-func New(ver string) (*Kibela, error) {
-	token := os.Getenv(envKibelaTOKEN)
+// NewWithProfile returns new Kibela client for the team of the profile. The options
+// are applied after the ones specified by KIBELA_ENDPOINT and KIBELA_TIMEOUT env values.
+func NewWithProfile(ver string, p *Profile, opts ...client.Option) (*Kibela, error) {
+	if p.Team == "" {
+		return nil, fmt.Errorf("set team name by KIBELA_TEAM env value or team of the profile in the config file")
+	}
+	token, err := p.resolveToken()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to kibela.New: %w", err)
+	}
 	if token == "" {
-		return nil, fmt.Errorf("set token by KIBELA_TOKEN env value")
+		return nil, fmt.Errorf("set token by KIBELA_TOKEN or KIBELA_TOKEN_COMMAND env value, or token or token_command of the profile in the config file")
 	}
-	team := os.Getenv(envKibelaTEAM)
-	if team == "" {
-		return nil, fmt.Errorf("set team name by KIBELA_TEAM env value")
+	envOpts, err := optionsFromEnv()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to kibela.New: %w", err)
 	}
-	cli, err := client.New(ver, team, token)
+	cli, err := client.New(ver, p.Team, token, append(envOpts, opts...)...)
 	if err != nil {
 		return nil, xerrors.Errorf("failed to kibela.New: %w", err)
 	}
 	return &Kibela{
-		cli:  cli,
-		team: team,
+		cli:           cli,
+		team:          p.Team,
+		defaultGroups: p.Groups,
 	}, nil
 }
+
+func optionsFromEnv() ([]client.Option, error) {
+	var opts []client.Option
+	if endpoint := os.Getenv(envKibelaENDPOINT); endpoint != "" {
+		opts = append(opts, client.WithEndpoint(endpoint))
+	}
+	if timeout := os.Getenv(envKibelaTIMEOUT); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid %s: %w", envKibelaTIMEOUT, err)
+		}
+		opts = append(opts, client.WithTimeout(d))
+	}
+	return opts, nil
+}
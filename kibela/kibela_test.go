@@ -35,6 +35,27 @@ func (td *testDoer) Do(req *http.Request) (*http.Response, error) {
 
 var _ client.Doer = (*testDoer)(nil)
 
+// doerFunc responds by the function, which receives the request body containing
+// the GraphQL query and variables, so that it can be used concurrently
+type doerFunc func(body string) string
+
+func (df doerFunc) Do(req *http.Request) (*http.Response, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		Header:     make(http.Header),
+		Close:      true,
+		Body:       ioutil.NopCloser(strings.NewReader(df(string(body)))),
+		Request:    req,
+	}, nil
+}
+
 func newClient(responseTexts []string) *client.Client {
 	return client.Test(&testDoer{responseTexts: responseTexts})
 }
@@ -0,0 +1,199 @@
+package kibelatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/konifar/kibelasync/internal/graphql"
+)
+
+// object is a GraphQL object type resolved by field names
+type object interface {
+	typeName() string
+	// resolve returns a scalar value, an object, a list of objects or nil
+	resolve(s *Server, name string, args map[string]interface{}) (interface{}, error)
+}
+
+// errUnknownField is returned by resolvers for fields which don't exist on the type
+var errUnknownField = fmt.Errorf("unknown field")
+
+type queryError struct {
+	Message    string                 `json:"message"`
+	Locations  []location             `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func locations(pos graphql.Position) []location {
+	return []location{{Line: pos.Line, Column: pos.Column}}
+}
+
+func (e *queryError) Error() string {
+	return e.Message
+}
+
+func toQueryError(err error) *queryError {
+	switch e := err.(type) {
+	case *queryError:
+		return e
+	case *graphql.SyntaxError:
+		return &queryError{
+			Message:    e.Message,
+			Locations:  locations(e.Pos),
+			Extensions: map[string]interface{}{"code": "PARSE_ERROR"},
+		}
+	}
+	return &queryError{Message: err.Error()}
+}
+
+// orderedMap is a JSON object keeping the order of keys as selected in queries
+type orderedMap []keyValue
+
+type keyValue struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON for encoding/json
+func (m orderedMap) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, kv := range m {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(kv.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(kv.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type executor struct {
+	s    *Server
+	vars map[string]interface{}
+}
+
+func (s *Server) execute(req *request) (interface{}, error) {
+	doc, err := graphql.Parse(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	op, err := doc.Operation(req.OperationName)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]interface{}, len(op.VariableDefinitions))
+	for _, def := range op.VariableDefinitions {
+		v, ok := req.Variables[def.Name]
+		if !ok && def.Default != nil {
+			if v, err = def.Default.Resolve(nil); err != nil {
+				return nil, err
+			}
+		}
+		if v == nil && def.Type.NonNull {
+			return nil, &queryError{
+				Message:   fmt.Sprintf("Variable $%s of type %s was provided invalid value", def.Name, def.Type),
+				Locations: locations(def.Pos),
+			}
+		}
+		vars[def.Name] = v
+	}
+
+	ex := &executor{s: s, vars: vars}
+	var root object = queryRoot{}
+	if op.Type == graphql.Mutation {
+		root = mutationRoot{}
+	}
+	return ex.selectFields(root, op.SelectionSet, nil)
+}
+
+func (ex *executor) selectFields(obj object, fields []*graphql.Field, path []interface{}) (orderedMap, error) {
+	m := make(orderedMap, 0, len(fields))
+	for _, f := range fields {
+		fpath := append(path[:len(path):len(path)], f.ResponseKey())
+		args := make(map[string]interface{}, len(f.Arguments))
+		for _, arg := range f.Arguments {
+			for _, name := range arg.Value.Variables() {
+				if _, ok := ex.vars[name]; !ok {
+					return nil, ex.errorf(f, fpath, "Variable $%s is used by anonymous query but not declared", name)
+				}
+			}
+			v, err := arg.Value.Resolve(ex.vars)
+			if err != nil {
+				return nil, ex.errorf(f, fpath, "%s", err)
+			}
+			args[arg.Name] = v
+		}
+		v, err := obj.resolve(ex.s, f.Name, args)
+		if err == errUnknownField {
+			return nil, ex.errorf(f, fpath, "Field '%s' doesn't exist on type '%s'", f.Name, obj.typeName())
+		}
+		if err != nil {
+			if qe, ok := err.(*queryError); ok {
+				qe.Locations = locations(f.Pos)
+				qe.Path = fpath
+				return nil, qe
+			}
+			return nil, ex.errorf(f, fpath, "%s", err)
+		}
+		v, err = ex.complete(f, v, fpath)
+		if err != nil {
+			return nil, err
+		}
+		m = append(m, keyValue{f.ResponseKey(), v})
+	}
+	return m, nil
+}
+
+func (ex *executor) complete(f *graphql.Field, v interface{}, path []interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case object:
+		if len(f.SelectionSet) == 0 {
+			return nil, ex.errorf(f, path, "Field '%s' of type '%s' must have a selection of subfields", f.Name, v.typeName())
+		}
+		return ex.selectFields(v, f.SelectionSet, path)
+	case []object:
+		list := make([]interface{}, len(v))
+		for i, o := range v {
+			if len(f.SelectionSet) == 0 {
+				return nil, ex.errorf(f, path, "Field '%s' of type '[%s]' must have a selection of subfields", f.Name, o.typeName())
+			}
+			item, err := ex.selectFields(o, f.SelectionSet, append(path[:len(path):len(path)], i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	}
+	if len(f.SelectionSet) > 0 {
+		return nil, ex.errorf(f, path, "Selections can't be made on scalars (field '%s')", f.Name)
+	}
+	return v, nil
+}
+
+func (ex *executor) errorf(f *graphql.Field, path []interface{}, format string, args ...interface{}) error {
+	return &queryError{
+		Message:   fmt.Sprintf(format, args...),
+		Locations: locations(f.Pos),
+		Path:      path,
+	}
+}
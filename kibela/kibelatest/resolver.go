@@ -0,0 +1,804 @@
+package kibelatest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"mime"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+func formatTime(t time.Time) string {
+	return t.Format(timeFormat)
+}
+
+type queryRoot struct{}
+
+func (queryRoot) typeName() string { return "Query" }
+
+func (queryRoot) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "notes":
+		return s.resolveNotes(args)
+	case "note":
+		id, err := argID(args, "id", typeNote)
+		if err != nil {
+			return nil, err
+		}
+		n := s.findNote(id)
+		if n == nil {
+			return nil, notFound("Note", args["id"])
+		}
+		return noteObject{n}, nil
+	case "groups":
+		objs := make([]object, len(s.groups))
+		for i, g := range s.groups {
+			objs[i] = groupObject{g}
+		}
+		return paginate("Group", objs, args)
+	case "folders":
+		objs := make([]object, len(s.folders))
+		for i, f := range s.folders {
+			objs[i] = folderObject{f}
+		}
+		return paginate("Folder", objs, args)
+	case "comment":
+		id, err := argID(args, "id", typeComment)
+		if err != nil {
+			return nil, err
+		}
+		c := s.findComment(id)
+		if c == nil {
+			return nil, notFound("Comment", args["id"])
+		}
+		return commentObject{c}, nil
+	case "budget":
+		return budgetObject{}, nil
+	}
+	return nil, errUnknownField
+}
+
+func (s *Server) resolveNotes(args map[string]interface{}) (interface{}, error) {
+	var notes []*Note
+	if args["folderId"] != nil {
+		folderNum, err := argID(args, "folderId", typeFolder)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range s.notes {
+			for _, f := range n.Folders {
+				if f.Number == folderNum {
+					notes = append(notes, n)
+					break
+				}
+			}
+		}
+	} else {
+		notes = append(notes, s.notes...)
+	}
+
+	field, direction := "PUBLISHED_AT", "DESC"
+	if orderBy, ok := args["orderBy"].(map[string]interface{}); ok {
+		if f, ok := orderBy["field"].(string); ok {
+			field = f
+		}
+		if d, ok := orderBy["direction"].(string); ok {
+			direction = d
+		}
+	}
+	var key func(n *Note) time.Time
+	switch field {
+	case "PUBLISHED_AT":
+		key = func(n *Note) time.Time { return n.PublishedAt }
+	case "CONTENT_UPDATED_AT":
+		key = func(n *Note) time.Time { return n.ContentUpdatedAt }
+	default:
+		return nil, fmt.Errorf("Argument 'field' on InputObject 'NoteOrder' has an invalid value (%s)", field)
+	}
+	if direction != "ASC" && direction != "DESC" {
+		return nil, fmt.Errorf("Argument 'direction' on InputObject 'NoteOrder' has an invalid value (%s)", direction)
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		ti, tj := key(notes[i]), key(notes[j])
+		if ti.Equal(tj) {
+			ti, tj = time.Unix(int64(notes[i].Number), 0), time.Unix(int64(notes[j].Number), 0)
+		}
+		if direction == "ASC" {
+			return ti.Before(tj)
+		}
+		return ti.After(tj)
+	})
+
+	objs := make([]object, len(notes))
+	for i, n := range notes {
+		objs[i] = noteObject{n}
+	}
+	return paginate("Note", objs, args)
+}
+
+type mutationRoot struct{}
+
+func (mutationRoot) typeName() string { return "Mutation" }
+
+func (mutationRoot) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	var fn func(map[string]interface{}) (interface{}, error)
+	switch name {
+	case "createNote":
+		fn = s.createNote
+	case "updateNote":
+		fn = s.updateNote
+	case "deleteNote":
+		fn = s.deleteNote
+	case "createComment":
+		fn = s.createComment
+	case "updateComment":
+		fn = s.updateComment
+	case "deleteComment":
+		fn = s.deleteComment
+	case "uploadAttachment":
+		fn = s.uploadAttachment
+	default:
+		return nil, errUnknownField
+	}
+	input, ok := args["input"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Argument 'input' on Field '%s' is required", name)
+	}
+	return fn(input)
+}
+
+func (s *Server) createNote(input map[string]interface{}) (interface{}, error) {
+	n := &Note{Author: s.Me}
+	if err := s.applyNoteInput(n, input); err != nil {
+		return nil, err
+	}
+	n.Number = s.nextNumber(typeNote)
+	now := s.now()
+	n.PublishedAt, n.UpdatedAt, n.ContentUpdatedAt = now, now, now
+	s.notes = append(s.notes, n)
+	return payloadObject{"CreateNotePayload", n, input["clientMutationId"]}, nil
+}
+
+func (s *Server) updateNote(input map[string]interface{}) (interface{}, error) {
+	num, err := argID(input, "id", typeNote)
+	if err != nil {
+		return nil, err
+	}
+	n := s.findNote(num)
+	if n == nil {
+		return nil, notFound("Note", input["id"])
+	}
+	base, ok := input["baseNote"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("baseNote is required")
+	}
+	newNote, ok := input["newNote"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("newNote is required")
+	}
+	if !s.matchNoteInput(n, base) {
+		return nil, &queryError{
+			Message:    "The note has been updated by someone else since the baseNote",
+			Extensions: map[string]interface{}{"code": "CONFLICT"},
+		}
+	}
+	updated := *n
+	if err := s.applyNoteInput(&updated, newNote); err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if updated.Title != n.Title || updated.Content != n.Content {
+		updated.ContentUpdatedAt = now
+	}
+	updated.UpdatedAt = now
+	*n = updated
+	return payloadObject{"UpdateNotePayload", n, input["clientMutationId"]}, nil
+}
+
+func (s *Server) deleteNote(input map[string]interface{}) (interface{}, error) {
+	num, err := argID(input, "id", typeNote)
+	if err != nil {
+		return nil, err
+	}
+	n := s.removeNote(num)
+	if n == nil {
+		return nil, notFound("Note", input["id"])
+	}
+	return payloadObject{"DeleteNotePayload", n, input["clientMutationId"]}, nil
+}
+
+func (s *Server) createComment(input map[string]interface{}) (interface{}, error) {
+	num, err := argID(input, "commentableId", typeNote)
+	if err != nil {
+		return nil, err
+	}
+	n := s.findNote(num)
+	if n == nil {
+		return nil, notFound("Note", input["commentableId"])
+	}
+	content := str(input["content"])
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("Content can't be blank")
+	}
+	now := s.now()
+	c := &Comment{
+		Number:      s.nextNumber(typeComment),
+		Note:        n,
+		Author:      s.Me,
+		Content:     content,
+		PublishedAt: now,
+		UpdatedAt:   now,
+	}
+	s.comments = append(s.comments, c)
+	return commentPayloadObject{"CreateCommentPayload", c, input["clientMutationId"]}, nil
+}
+
+func (s *Server) updateComment(input map[string]interface{}) (interface{}, error) {
+	num, err := argID(input, "id", typeComment)
+	if err != nil {
+		return nil, err
+	}
+	c := s.findComment(num)
+	if c == nil {
+		return nil, notFound("Comment", input["id"])
+	}
+	content := str(input["content"])
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("Content can't be blank")
+	}
+	c.Content = content
+	c.UpdatedAt = s.now()
+	return commentPayloadObject{"UpdateCommentPayload", c, input["clientMutationId"]}, nil
+}
+
+func (s *Server) deleteComment(input map[string]interface{}) (interface{}, error) {
+	num, err := argID(input, "id", typeComment)
+	if err != nil {
+		return nil, err
+	}
+	c := s.removeComment(num)
+	if c == nil {
+		return nil, notFound("Comment", input["id"])
+	}
+	return commentPayloadObject{"DeleteCommentPayload", c, input["clientMutationId"]}, nil
+}
+
+// matchNoteInput reports whether the note is the same as the baseNote
+func (s *Server) matchNoteInput(n *Note, input map[string]interface{}) bool {
+	if str(input["title"]) != n.Title ||
+		strings.TrimSpace(str(input["content"])) != strings.TrimSpace(n.Content) ||
+		input["coediting"] != n.CoEditing {
+		return false
+	}
+	var want, got []string
+	for _, g := range n.Groups {
+		want = append(want, g.ID())
+	}
+	ids, _ := input["groupIds"].([]interface{})
+	for _, id := range ids {
+		got = append(got, str(id))
+	}
+	sort.Strings(want)
+	sort.Strings(got)
+	return strings.Join(want, ",") == strings.Join(got, ",")
+}
+
+func (s *Server) applyNoteInput(n *Note, input map[string]interface{}) error {
+	title := str(input["title"])
+	if strings.TrimSpace(title) == "" {
+		return fmt.Errorf("Title can't be blank")
+	}
+	n.Title = title
+	n.Content = str(input["content"])
+	n.CoEditing, _ = input["coediting"].(bool)
+
+	ids, _ := input["groupIds"].([]interface{})
+	if len(ids) == 0 {
+		return fmt.Errorf("Groups can't be blank")
+	}
+	n.Groups = nil
+	for _, id := range ids {
+		num, err := argID(map[string]interface{}{"groupIds": id}, "groupIds", typeGroup)
+		if err != nil {
+			return err
+		}
+		g := s.findGroup(num)
+		if g == nil {
+			return notFound("Group", id)
+		}
+		n.Groups = append(n.Groups, g)
+	}
+	folders, err := s.folderInput(input["folders"])
+	if err != nil {
+		return err
+	}
+	n.Folders = folders
+	return nil
+}
+
+// folderInput accepts both of a list of `{groupId, folderName}` as Kibela defines and
+// a folder connection `{nodes: [{id, fullName, group: {id}}]}` as kibelasync sends.
+// Folders that don't exist are created.
+func (s *Server) folderInput(v interface{}) ([]*Folder, error) {
+	var items []interface{}
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		items = v
+	case map[string]interface{}:
+		items, _ = v["nodes"].([]interface{})
+	default:
+		return nil, fmt.Errorf("invalid folders: %v", v)
+	}
+	var folders []*Folder
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid folder: %v", item)
+		}
+		if id := str(m["id"]); id != "" {
+			num, err := argID(m, "id", typeFolder)
+			if err != nil {
+				return nil, err
+			}
+			f := s.findFolder(num)
+			if f == nil {
+				return nil, notFound("Folder", id)
+			}
+			folders = append(folders, f)
+			continue
+		}
+		groupID, name := str(m["groupId"]), str(m["folderName"])
+		if g, ok := m["group"].(map[string]interface{}); ok {
+			groupID, name = str(g["id"]), str(m["fullName"])
+		}
+		num, err := argID(map[string]interface{}{"groupId": groupID}, "groupId", typeGroup)
+		if err != nil {
+			return nil, err
+		}
+		g := s.findGroup(num)
+		if g == nil {
+			return nil, notFound("Group", groupID)
+		}
+		var found *Folder
+		for _, f := range s.folders {
+			if f.Group == g && f.FullName == name {
+				found = f
+				break
+			}
+		}
+		if found == nil {
+			found = s.addFolder(g, name)
+		}
+		folders = append(folders, found)
+	}
+	return folders, nil
+}
+
+func (s *Server) uploadAttachment(input map[string]interface{}) (interface{}, error) {
+	name := str(input["name"])
+	if name == "" {
+		return nil, fmt.Errorf("Name can't be blank")
+	}
+	data, err := base64.StdEncoding.DecodeString(str(input["data"]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid data: %s", err)
+	}
+	a := &Attachment{
+		Number:      s.nextNumber(typeAttachment),
+		Name:        name,
+		ContentType: mime.TypeByExtension(path.Ext(name)),
+		Data:        data,
+	}
+	s.attachments = append(s.attachments, a)
+	return attachmentPayloadObject{"UploadAttachmentPayload", a, input["clientMutationId"]}, nil
+}
+
+type payloadObject struct {
+	name             string
+	note             *Note
+	clientMutationID interface{}
+}
+
+func (p payloadObject) typeName() string { return p.name }
+
+func (p payloadObject) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "note":
+		return noteObject{p.note}, nil
+	case "clientMutationId":
+		return p.clientMutationID, nil
+	}
+	return nil, errUnknownField
+}
+
+type commentPayloadObject struct {
+	name             string
+	comment          *Comment
+	clientMutationID interface{}
+}
+
+func (p commentPayloadObject) typeName() string { return p.name }
+
+func (p commentPayloadObject) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "comment":
+		return commentObject{p.comment}, nil
+	case "clientMutationId":
+		return p.clientMutationID, nil
+	}
+	return nil, errUnknownField
+}
+
+type attachmentPayloadObject struct {
+	name             string
+	attachment       *Attachment
+	clientMutationID interface{}
+}
+
+func (p attachmentPayloadObject) typeName() string { return p.name }
+
+func (p attachmentPayloadObject) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "attachment":
+		return attachmentObject{p.attachment}, nil
+	case "clientMutationId":
+		return p.clientMutationID, nil
+	}
+	return nil, errUnknownField
+}
+
+type noteObject struct{ *Note }
+
+func (noteObject) typeName() string { return "Note" }
+
+func (n noteObject) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "id":
+		return n.ID(), nil
+	case "title":
+		return n.Title, nil
+	case "content":
+		return n.Content, nil
+	case "contentHtml":
+		return "<p>" + html.EscapeString(n.Content) + "</p>", nil
+	case "contentSummaryHtml":
+		return summary(n.Content), nil
+	case "coediting":
+		return n.CoEditing, nil
+	case "path":
+		return fmt.Sprintf("/notes/%d", n.Number), nil
+	case "url":
+		return fmt.Sprintf("https://%s.kibe.la/notes/%d", s.Team, n.Number), nil
+	case "author":
+		return userObject{n.Author}, nil
+	case "groups":
+		objs := make([]object, len(n.Groups))
+		for i, g := range n.Groups {
+			objs[i] = groupObject{g}
+		}
+		return objs, nil
+	case "folders":
+		objs := make([]object, len(n.Folders))
+		for i, f := range n.Folders {
+			objs[i] = folderObject{f}
+		}
+		return paginate("Folder", objs, args)
+	case "comments":
+		var objs []object
+		for _, c := range s.comments {
+			if c.Note == n.Note {
+				objs = append(objs, commentObject{c})
+			}
+		}
+		return paginate("Comment", objs, args)
+	case "publishedAt":
+		return formatTime(n.PublishedAt), nil
+	case "updatedAt":
+		return formatTime(n.UpdatedAt), nil
+	case "contentUpdatedAt":
+		return formatTime(n.ContentUpdatedAt), nil
+	}
+	return nil, errUnknownField
+}
+
+type groupObject struct{ *Group }
+
+func (groupObject) typeName() string { return "Group" }
+
+func (g groupObject) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "id":
+		return g.ID(), nil
+	case "name":
+		return g.Name, nil
+	}
+	return nil, errUnknownField
+}
+
+type folderObject struct{ *Folder }
+
+func (folderObject) typeName() string { return "Folder" }
+
+func (f folderObject) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "id":
+		return f.ID(), nil
+	case "fullName":
+		return f.FullName, nil
+	case "name":
+		return f.FullName[strings.LastIndex(f.FullName, "/")+1:], nil
+	case "group":
+		return groupObject{f.Group}, nil
+	}
+	return nil, errUnknownField
+}
+
+type userObject struct{ *User }
+
+func (userObject) typeName() string { return "User" }
+
+func (u userObject) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "id":
+		return u.ID(), nil
+	case "account":
+		return u.Account, nil
+	}
+	return nil, errUnknownField
+}
+
+type commentObject struct{ *Comment }
+
+func (commentObject) typeName() string { return "Comment" }
+
+func (c commentObject) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "id":
+		return c.ID(), nil
+	case "content":
+		return c.Content, nil
+	case "contentHtml":
+		return "<p>" + html.EscapeString(c.Content) + "</p>", nil
+	case "contentSummaryHtml":
+		return summary(c.Content), nil
+	case "author":
+		return userObject{c.Author}, nil
+	case "path":
+		return fmt.Sprintf("/notes/%d#comment_%d", c.Note.Number, c.Number), nil
+	case "url":
+		return fmt.Sprintf("https://%s.kibe.la/notes/%d#comment_%d", s.Team, c.Note.Number, c.Number), nil
+	case "publishedAt":
+		return formatTime(c.PublishedAt), nil
+	case "updatedAt":
+		return formatTime(c.UpdatedAt), nil
+	}
+	return nil, errUnknownField
+}
+
+type attachmentObject struct{ *Attachment }
+
+func (attachmentObject) typeName() string { return "Attachment" }
+
+func (a attachmentObject) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "id":
+		return a.ID(), nil
+	case "name":
+		return a.Name, nil
+	case "path":
+		return a.Path(), nil
+	case "url":
+		return fmt.Sprintf("https://%s.kibe.la%s", s.Team, a.Path()), nil
+	}
+	return nil, errUnknownField
+}
+
+// budgetObject reports the budget enough not to be throttled
+type budgetObject struct{}
+
+func (budgetObject) typeName() string { return "Budget" }
+
+func (budgetObject) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "cost":
+		return "1", nil
+	case "consumed":
+		return "1", nil
+	case "remaining":
+		return "1000000", nil
+	}
+	return nil, errUnknownField
+}
+
+// connection is a Relay style connection
+type connection struct {
+	name    string
+	nodes   []object
+	cursors []string
+	total   int
+	hasNext bool
+	hasPrev bool
+}
+
+func (c *connection) typeName() string { return c.name + "Connection" }
+
+func (c *connection) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "totalCount":
+		return c.total, nil
+	case "nodes":
+		return c.nodes, nil
+	case "edges":
+		edges := make([]object, len(c.nodes))
+		for i, n := range c.nodes {
+			edges[i] = &edge{name: c.name, node: n, cursor: c.cursors[i]}
+		}
+		return edges, nil
+	case "pageInfo":
+		return &pageInfo{c}, nil
+	}
+	return nil, errUnknownField
+}
+
+type edge struct {
+	name   string
+	node   object
+	cursor string
+}
+
+func (e *edge) typeName() string { return e.name + "Edge" }
+
+func (e *edge) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "node":
+		return e.node, nil
+	case "cursor":
+		return e.cursor, nil
+	}
+	return nil, errUnknownField
+}
+
+type pageInfo struct {
+	c *connection
+}
+
+func (p *pageInfo) typeName() string { return "PageInfo" }
+
+func (p *pageInfo) resolve(s *Server, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "hasNextPage":
+		return p.c.hasNext, nil
+	case "hasPreviousPage":
+		return p.c.hasPrev, nil
+	case "startCursor", "endCursor":
+		if len(p.c.cursors) == 0 {
+			return nil, nil
+		}
+		if name == "startCursor" {
+			return p.c.cursors[0], nil
+		}
+		return p.c.cursors[len(p.c.cursors)-1], nil
+	}
+	return nil, errUnknownField
+}
+
+// encodeCursor encodes the 1-based index in the same way as Kibela, e.g. 7 to "Nw"
+func encodeCursor(i int) string {
+	return base64.RawStdEncoding.EncodeToString([]byte(strconv.Itoa(i)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	b, err := base64.RawStdEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor: %q", cursor)
+	}
+	i, err := strconv.Atoi(string(b))
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor: %q", cursor)
+	}
+	return i, nil
+}
+
+// paginate slices the objects by first, after, last and before arguments
+func paginate(name string, objs []object, args map[string]interface{}) (*connection, error) {
+	start, end := 0, len(objs)
+	if after, ok := args["after"].(string); ok {
+		i, err := decodeCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		if i > start {
+			start = i
+		}
+	}
+	if before, ok := args["before"].(string); ok {
+		i, err := decodeCursor(before)
+		if err != nil {
+			return nil, err
+		}
+		if i-1 < end {
+			end = i - 1
+		}
+	}
+	if start > end {
+		start = end
+	}
+	first, hasFirst, err := argInt(args, "first")
+	if err != nil {
+		return nil, err
+	}
+	last, hasLast, err := argInt(args, "last")
+	if err != nil {
+		return nil, err
+	}
+	c := &connection{name: name, total: len(objs)}
+	if hasFirst && end-start > first {
+		end = start + first
+		c.hasNext = true
+	}
+	if hasLast && end-start > last {
+		start = end - last
+		c.hasPrev = true
+	}
+	for i := start; i < end; i++ {
+		c.nodes = append(c.nodes, objs[i])
+		c.cursors = append(c.cursors, encodeCursor(i+1))
+	}
+	return c, nil
+}
+
+func argInt(args map[string]interface{}, name string) (int, bool, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return 0, false, nil
+	}
+	f, ok := v.(float64)
+	if !ok || f != float64(int(f)) || f < 0 {
+		return 0, false, fmt.Errorf("Argument '%s' has an invalid value (%v). Expected type 'Int'", name, v)
+	}
+	return int(f), true, nil
+}
+
+func argID(args map[string]interface{}, name, typ string) (int, error) {
+	id, ok := args[name].(string)
+	if !ok {
+		return 0, fmt.Errorf("Argument '%s' has an invalid value (%v). Expected type 'ID!'", name, args[name])
+	}
+	t, num, err := DecodeID(id)
+	if err != nil || t != typ {
+		return 0, &queryError{
+			Message:    fmt.Sprintf("Invalid ID %q for %s", id, typ),
+			Extensions: map[string]interface{}{"code": "NOT_FOUND"},
+		}
+	}
+	return num, nil
+}
+
+func notFound(typ string, id interface{}) error {
+	return &queryError{
+		Message:    fmt.Sprintf("%s not found: %v", typ, id),
+		Extensions: map[string]interface{}{"code": "NOT_FOUND"},
+	}
+}
+
+func str(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// summary imitates contentSummaryHtml by the first 100 characters of the content
+func summary(content string) string {
+	r := []rune(strings.Join(strings.Fields(content), " "))
+	if len(r) > 100 {
+		r = r[:100]
+	}
+	return html.EscapeString(string(r))
+}
@@ -0,0 +1,495 @@
+// Package kibelatest provides an in-process fake Kibela GraphQL server for testing.
+//
+// The server holds notes, groups, folders, comments, users and attachments in memory and answers
+// the subset of Kibela API issued by kibelasync. Unknown fields and malformed queries
+// are rejected with GraphQL errors, so that tests can catch invalid queries.
+//
+//	ts := kibelatest.NewServer()
+//	defer ts.Close()
+//	home := ts.AddGroup("Home")
+//	ts.AddNote(&kibelatest.Note{Title: "hello", Content: "world", Groups: []*kibelatest.Group{home}})
+//	cli, _ := client.New("test", ts.Team, ts.Token, client.WithEndpoint(ts.Endpoint()))
+package kibelatest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a fake Kibela GraphQL server
+type Server struct {
+	*httptest.Server
+
+	// Team is the team name used for URLs of notes
+	Team string
+	// Token is the access token required in the Authorization header.
+	// Authorization isn't checked when it is empty.
+	Token string
+	// Me is the user who sends requests. It becomes the author of created notes.
+	Me *User
+	// Now returns the current time. time.Now is used by default.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	lastTime time.Time
+	seq      map[string]int
+	users    []*User
+	groups   []*Group
+	folders  []*Folder
+	notes    []*Note
+	comments []*Comment
+	// attachments are served at "/attachments/{number}"
+	attachments []*Attachment
+}
+
+// User is a user of the fake server
+type User struct {
+	Number  int
+	Account string
+}
+
+// ID returns the GraphQL ID
+func (u *User) ID() string {
+	return EncodeID(typeUser, u.Number)
+}
+
+// Group is a group of the fake server
+type Group struct {
+	Number int
+	Name   string
+}
+
+// ID returns the GraphQL ID
+func (g *Group) ID() string {
+	return EncodeID(typeGroup, g.Number)
+}
+
+// Folder is a folder of the fake server
+type Folder struct {
+	Number   int
+	Group    *Group
+	FullName string
+}
+
+// ID returns the GraphQL ID
+func (f *Folder) ID() string {
+	return EncodeID(typeFolder, f.Number)
+}
+
+// Note is a note of the fake server
+type Note struct {
+	Number           int
+	Title            string
+	Content          string
+	CoEditing        bool
+	Author           *User
+	Groups           []*Group
+	Folders          []*Folder
+	PublishedAt      time.Time
+	UpdatedAt        time.Time
+	ContentUpdatedAt time.Time
+}
+
+// ID returns the GraphQL ID
+func (n *Note) ID() string {
+	return EncodeID(typeNote, n.Number)
+}
+
+// Comment is a comment of the fake server
+type Comment struct {
+	Number      int
+	Note        *Note
+	Author      *User
+	Content     string
+	PublishedAt time.Time
+	UpdatedAt   time.Time
+}
+
+// ID returns the GraphQL ID
+func (c *Comment) ID() string {
+	return EncodeID(typeComment, c.Number)
+}
+
+// Attachment is an uploaded file of the fake server
+type Attachment struct {
+	Number      int
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// ID returns the GraphQL ID
+func (a *Attachment) ID() string {
+	return EncodeID(typeAttachment, a.Number)
+}
+
+// Path returns the path of the attachment referenced in the contents of notes
+func (a *Attachment) Path() string {
+	return fmt.Sprintf("/attachments/%d", a.Number)
+}
+
+const (
+	typeUser       = "User"
+	typeGroup      = "Group"
+	typeFolder     = "Folder"
+	typeNote       = "Blog"
+	typeComment    = "Comment"
+	typeAttachment = "Attachment"
+)
+
+// EncodeID encodes the GraphQL ID in the same way as Kibela, e.g. "Blog/1" to "QmxvZy8x"
+func EncodeID(typ string, num int) string {
+	return base64.RawStdEncoding.EncodeToString([]byte(fmt.Sprintf("%s/%d", typ, num)))
+}
+
+// DecodeID decodes the GraphQL ID
+func DecodeID(id string) (typ string, num int, err error) {
+	b, err := base64.RawStdEncoding.DecodeString(id)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid id: %q", id)
+	}
+	stuff := strings.Split(string(b), "/")
+	if len(stuff) != 2 {
+		return "", 0, fmt.Errorf("invalid id: %q", id)
+	}
+	num, err = strconv.Atoi(stuff[1])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid id: %q", id)
+	}
+	return stuff[0], num, nil
+}
+
+// NewServer starts and returns a new fake server. The caller should call Close when finished.
+func NewServer() *Server {
+	s := &Server{
+		Team:  "kibelatest",
+		Token: "kibelatest-token",
+		seq:   make(map[string]int),
+	}
+	s.Me = s.AddUser("kibelatest")
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Endpoint returns the endpoint URL of the API
+func (s *Server) Endpoint() string {
+	return s.URL + "/api/v1"
+}
+
+func (s *Server) nextNumber(typ string) int {
+	s.seq[typ]++
+	return s.seq[typ]
+}
+
+// now returns the current time truncated in milliseconds like Kibela. It is
+// guaranteed to be monotonically increasing to order updates strictly.
+func (s *Server) now() time.Time {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	t := now().Truncate(time.Millisecond)
+	if !t.After(s.lastTime) {
+		t = s.lastTime.Add(time.Millisecond)
+	}
+	s.lastTime = t
+	return t
+}
+
+// AddUser adds a user
+func (s *Server) AddUser(account string) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := &User{Number: s.nextNumber(typeUser), Account: account}
+	s.users = append(s.users, u)
+	return u
+}
+
+// AddGroup adds a group
+func (s *Server) AddGroup(name string) *Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := &Group{Number: s.nextNumber(typeGroup), Name: name}
+	s.groups = append(s.groups, g)
+	return g
+}
+
+// AddFolder adds a folder in the group
+func (s *Server) AddFolder(g *Group, fullName string) *Folder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addFolder(g, fullName)
+}
+
+func (s *Server) addFolder(g *Group, fullName string) *Folder {
+	f := &Folder{Number: s.nextNumber(typeFolder), Group: g, FullName: fullName}
+	s.folders = append(s.folders, f)
+	return f
+}
+
+// AddNote adds the note. The Number is assigned, and the Author and zero times are
+// filled with Me and the current time.
+func (s *Server) AddNote(n *Note) *Note {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n.Number = s.nextNumber(typeNote)
+	if n.Author == nil {
+		n.Author = s.Me
+	}
+	now := s.now()
+	for _, t := range []*time.Time{&n.PublishedAt, &n.UpdatedAt, &n.ContentUpdatedAt} {
+		if t.IsZero() {
+			*t = now
+		}
+	}
+	s.notes = append(s.notes, n)
+	return n
+}
+
+// UpdateNote updates the note by the function as someone else edits it on the web,
+// and bumps the updatedAt. The contentUpdatedAt is bumped only when the title or the
+// content is changed, so moving notes to other folders doesn't bump it like Kibela.
+func (s *Server) UpdateNote(num int, fn func(*Note)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.findNote(num)
+	if n == nil {
+		return fmt.Errorf("note %d not found", num)
+	}
+	title, content := n.Title, n.Content
+	fn(n)
+	n.UpdatedAt = s.now()
+	if n.Title != title || n.Content != content {
+		n.ContentUpdatedAt = n.UpdatedAt
+	}
+	return nil
+}
+
+// DeleteNote deletes the note as someone else deletes it on the web
+func (s *Server) DeleteNote(num int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.removeNote(num) == nil {
+		return fmt.Errorf("note %d not found", num)
+	}
+	return nil
+}
+
+func (s *Server) removeNote(num int) *Note {
+	for i, n := range s.notes {
+		if n.Number == num {
+			s.notes = append(s.notes[:i], s.notes[i+1:]...)
+			return n
+		}
+	}
+	return nil
+}
+
+// AddComment adds a comment to the note
+func (s *Server) AddComment(n *Note, author *User, content string) *Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if author == nil {
+		author = s.Me
+	}
+	now := s.now()
+	c := &Comment{
+		Number:      s.nextNumber(typeComment),
+		Note:        n,
+		Author:      author,
+		Content:     content,
+		PublishedAt: now,
+		UpdatedAt:   now,
+	}
+	s.comments = append(s.comments, c)
+	return c
+}
+
+// AddAttachment adds the attachment served at its Path
+func (s *Server) AddAttachment(name, contentType string, data []byte) *Attachment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := &Attachment{
+		Number:      s.nextNumber(typeAttachment),
+		Name:        name,
+		ContentType: contentType,
+		Data:        data,
+	}
+	s.attachments = append(s.attachments, a)
+	return a
+}
+
+// Note returns a copy of the note
+func (s *Server) Note(num int) (Note, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.findNote(num)
+	if n == nil {
+		return Note{}, false
+	}
+	return *n, true
+}
+
+// Comment returns a copy of the comment
+func (s *Server) Comment(num int) (Comment, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.findComment(num)
+	if c == nil {
+		return Comment{}, false
+	}
+	return *c, true
+}
+
+// Attachments returns copies of all the attachments
+func (s *Server) Attachments() []Attachment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attachments := make([]Attachment, len(s.attachments))
+	for i, a := range s.attachments {
+		attachments[i] = *a
+	}
+	return attachments
+}
+
+// Notes returns copies of all the notes
+func (s *Server) Notes() []Note {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	notes := make([]Note, len(s.notes))
+	for i, n := range s.notes {
+		notes[i] = *n
+	}
+	return notes
+}
+
+func (s *Server) findNote(num int) *Note {
+	for _, n := range s.notes {
+		if n.Number == num {
+			return n
+		}
+	}
+	return nil
+}
+
+func (s *Server) findGroup(num int) *Group {
+	for _, g := range s.groups {
+		if g.Number == num {
+			return g
+		}
+	}
+	return nil
+}
+
+func (s *Server) findFolder(num int) *Folder {
+	for _, f := range s.folders {
+		if f.Number == num {
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *Server) removeComment(num int) *Comment {
+	for i, c := range s.comments {
+		if c.Number == num {
+			s.comments = append(s.comments[:i], s.comments[i+1:]...)
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *Server) findAttachment(num int) *Attachment {
+	for _, a := range s.attachments {
+		if a.Number == num {
+			return a
+		}
+	}
+	return nil
+}
+
+func (s *Server) findComment(num int) *Comment {
+	for _, c := range s.comments {
+		if c.Number == num {
+			return c
+		}
+	}
+	return nil
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+type response struct {
+	Data   interface{}   `json:"data"`
+	Errors []*queryError `json:"errors,omitempty"`
+}
+
+// ServeHTTP handles GraphQL requests and downloads of attachments
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/attachments/") {
+		s.serveAttachment(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	data, err := s.execute(&req)
+	s.mu.Unlock()
+
+	resp := &response{Data: data}
+	if err != nil {
+		resp.Data = nil
+		resp.Errors = []*queryError{toQueryError(err)}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) serveAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	num, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/attachments/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	a := s.findAttachment(num)
+	s.mu.Unlock()
+	if a == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", a.ContentType)
+	if a.Name != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+	}
+	w.Write(a.Data)
+}
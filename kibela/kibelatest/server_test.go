@@ -0,0 +1,271 @@
+package kibelatest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func post(t *testing.T, ts *Server, query string, vars map[string]interface{}) (map[string]interface{}, []map[string]interface{}) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": vars})
+	req, _ := http.NewRequest(http.MethodPost, ts.Endpoint(), bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+ts.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var res struct {
+		Data   map[string]interface{}   `json:"data"`
+		Errors []map[string]interface{} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return res.Data, res.Errors
+}
+
+func newTestServer() (*Server, *Group) {
+	ts := NewServer()
+	base := time.Date(2019, 6, 23, 17, 0, 0, 0, time.UTC)
+	ts.Now = func() time.Time { return base }
+	home := ts.AddGroup("Home")
+	for _, title := range []string{"one", "two", "three"} {
+		ts.AddNote(&Note{Title: title, Content: title + "!", Groups: []*Group{home}})
+	}
+	return ts, home
+}
+
+func TestServer_notes(t *testing.T) {
+	ts, _ := newTestServer()
+	defer ts.Close()
+
+	query := `query($after: String) {
+  notes(first: 2, after: $after, orderBy: {field: PUBLISHED_AT, direction: ASC}) {
+    totalCount
+    edges { node { title updatedAt } cursor }
+    pageInfo { hasNextPage }
+  }
+}`
+	data, errs := post(t, ts, query, nil)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	expect := map[string]interface{}{
+		"notes": map[string]interface{}{
+			"totalCount": 3.0,
+			"edges": []interface{}{
+				map[string]interface{}{
+					"node":   map[string]interface{}{"title": "one", "updatedAt": "2019-06-23T17:00:00.000Z"},
+					"cursor": "MQ",
+				},
+				map[string]interface{}{
+					"node":   map[string]interface{}{"title": "two", "updatedAt": "2019-06-23T17:00:00.001Z"},
+					"cursor": "Mg",
+				},
+			},
+			"pageInfo": map[string]interface{}{"hasNextPage": true},
+		},
+	}
+	if !reflect.DeepEqual(data, expect) {
+		t.Errorf("got: %#v\nexpect: %#v", data, expect)
+	}
+
+	data, _ = post(t, ts, query, map[string]interface{}{"after": "Mg"})
+	edges := data["notes"].(map[string]interface{})["edges"].([]interface{})
+	if len(edges) != 1 || edges[0].(map[string]interface{})["cursor"] != "Mw" {
+		t.Errorf("unexpected second page: %#v", edges)
+	}
+}
+
+func TestServer_errors(t *testing.T) {
+	ts, _ := newTestServer()
+	defer ts.Close()
+
+	testCases := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"unknown field", `{ notes { nodes { unknown } } }`, "Field 'unknown' doesn't exist on type 'Note'"},
+		{"scalar selection", `{ note(id: "QmxvZy8x") { title { x } } }`, "Selections can't be made on scalars"},
+		{"missing selection", `{ note(id: "QmxvZy8x") { author } }`, "must have a selection of subfields"},
+		{"not found", `{ note(id: "QmxvZy85OQ") { title } }`, "Note not found"},
+		{"syntax error", `{ notes {`, "got EOF"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, errs := post(t, ts, tc.query, nil)
+			if data != nil {
+				t.Errorf("data should be null, but: %v", data)
+			}
+			if len(errs) != 1 || !strings.Contains(errs[0]["message"].(string), tc.want) {
+				t.Errorf("error should contain %q, but: %v", tc.want, errs)
+			}
+		})
+	}
+}
+
+func TestServer_updateNote(t *testing.T) {
+	ts, home := newTestServer()
+	defer ts.Close()
+
+	mutation := `mutation($id: ID!, $baseNote: NoteInput!, $newNote: NoteInput!) {
+  updateNote(input: {id: $id, baseNote: $baseNote, newNote: $newNote, draft: false}) {
+    note { title author { account } }
+  }
+}`
+	input := func(title, content string) map[string]interface{} {
+		return map[string]interface{}{
+			"title":     title,
+			"content":   content,
+			"groupIds":  []string{home.ID()},
+			"coediting": false,
+		}
+	}
+	vars := map[string]interface{}{
+		"id":       EncodeID("Blog", 1),
+		"baseNote": input("one", "one!\n"),
+		"newNote":  input("one", "updated\n"),
+	}
+	if _, errs := post(t, ts, mutation, vars); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	n, _ := ts.Note(1)
+	if n.Content != "updated\n" || !n.UpdatedAt.After(n.PublishedAt) {
+		t.Errorf("the note should be updated, but: %#v", n)
+	}
+
+	// the baseNote is stale now
+	_, errs := post(t, ts, mutation, vars)
+	if len(errs) != 1 || errs[0]["extensions"].(map[string]interface{})["code"] != "CONFLICT" {
+		t.Errorf("conflict should be detected, but: %v", errs)
+	}
+}
+
+func TestServer_comments(t *testing.T) {
+	ts, _ := newTestServer()
+	defer ts.Close()
+
+	data, errs := post(t, ts, `mutation($id: ID!) {
+  createComment(input: {commentableId: $id, content: "LGTM"}) { comment { id url } }
+}`, map[string]interface{}{"id": EncodeID("Blog", 2)})
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	expect := map[string]interface{}{
+		"createComment": map[string]interface{}{
+			"comment": map[string]interface{}{
+				"id":  EncodeID("Comment", 1),
+				"url": "https://kibelatest.kibe.la/notes/2#comment_1",
+			},
+		},
+	}
+	if !reflect.DeepEqual(data, expect) {
+		t.Errorf("got: %#v\nexpect: %#v", data, expect)
+	}
+
+	vars := map[string]interface{}{"id": EncodeID("Comment", 1)}
+	if _, errs := post(t, ts, `mutation($id: ID!) {
+  updateComment(input: {id: $id, content: "LGTM!"}) { comment { id } }
+}`, vars); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if c, _ := ts.Comment(1); c.Content != "LGTM!" {
+		t.Errorf("the comment should be updated, but: %q", c.Content)
+	}
+
+	deleteComment := `mutation($id: ID!) { deleteComment(input: {id: $id}) { comment { id } } }`
+	if _, errs := post(t, ts, deleteComment, vars); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if _, ok := ts.Comment(1); ok {
+		t.Error("the comment should be deleted")
+	}
+	if _, errs := post(t, ts, deleteComment, vars); len(errs) != 1 {
+		t.Errorf("deleted comment should not be found, but: %v", errs)
+	}
+}
+
+func TestServer_unauthorized(t *testing.T) {
+	ts := NewServer()
+	defer ts.Close()
+	resp, err := http.Post(ts.Endpoint(), "application/json", strings.NewReader(`{"query":"{ budget { cost } }"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status should be 401, but: %d", resp.StatusCode)
+	}
+}
+
+func TestServer_attachments(t *testing.T) {
+	ts := NewServer()
+	defer ts.Close()
+	a := ts.AddAttachment("image.png", "image/png", []byte("PNG"))
+
+	get := func(path, token string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	resp := get(a.Path(), ts.Token)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "PNG" {
+		t.Errorf("body = %q, expect: %q", body, "PNG")
+	}
+	if cd := resp.Header.Get("Content-Disposition"); cd != `attachment; filename=image.png` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	data, errs := post(t, ts, `mutation($name: String!, $data: Blob!) {
+  uploadAttachment(input: {name: $name, data: $data, kind: GENERAL}) { attachment { id path } }
+}`, map[string]interface{}{"name": "diagram.png", "data": base64.StdEncoding.EncodeToString([]byte("PNG2"))})
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	expect := map[string]interface{}{
+		"uploadAttachment": map[string]interface{}{
+			"attachment": map[string]interface{}{
+				"id":   EncodeID("Attachment", 2),
+				"path": "/attachments/2",
+			},
+		},
+	}
+	if !reflect.DeepEqual(data, expect) {
+		t.Errorf("got: %#v\nexpect: %#v", data, expect)
+	}
+	if as := ts.Attachments(); len(as) != 2 || string(as[1].Data) != "PNG2" || as[1].ContentType != "image/png" {
+		t.Errorf("the attachment should be uploaded, but: %+v", as)
+	}
+
+	for _, tc := range []struct {
+		path, token string
+		status      int
+	}{
+		{a.Path(), "", http.StatusUnauthorized},
+		{"/attachments/3", ts.Token, http.StatusNotFound},
+	} {
+		resp := get(tc.path, tc.token)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("status of %s should be %d, but: %d", tc.path, tc.status, resp.StatusCode)
+		}
+	}
+}
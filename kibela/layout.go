@@ -0,0 +1,364 @@
+package kibela
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+)
+
+// Layout is the layout of the Markdown files in a sync directory
+type Layout string
+
+// Layouts
+const (
+	// LayoutFlat places notes at "{dir}/{filename}"
+	LayoutFlat Layout = "flat"
+	// LayoutFolder places notes at "{dir}/{group}/{folder full name}/{filename}"
+	// following the folder tree of Kibela. Notes not in folders are placed in the
+	// directory of their first group.
+	LayoutFolder Layout = "folder"
+)
+
+// ParseLayout parses the layout name. The empty name means LayoutFlat.
+func ParseLayout(s string) (Layout, error) {
+	switch l := Layout(s); l {
+	case "":
+		return LayoutFlat, nil
+	case LayoutFlat, LayoutFolder:
+		return l, nil
+	}
+	return "", fmt.Errorf("invalid layout (must be flat or folder): %s", s)
+}
+
+// SetLayout sets the layout of the sync directory. Existing files are moved by the
+// next pull.
+func (ki *Kibela) SetLayout(dir string, l Layout) error {
+	st, err := ki.syncState(dir)
+	if err != nil {
+		return xerrors.Errorf("failed to SetLayout: %w", err)
+	}
+	return st.updateSettings(func() bool {
+		if st.Layout == l || (st.Layout == "" && l == LayoutFlat) {
+			return false
+		}
+		st.Layout = l
+		return true
+	})
+}
+
+// relPath returns the path of the MD relative to the sync directory by the layout and
+// the filename template
+func (l Layout) relPath(m *MD, t FilenameTemplate) (string, error) {
+	num, err := m.ID.Number()
+	if err != nil {
+		return "", err
+	}
+	fname := t.expand(num, m.FrontMatter.Title)
+	if l != LayoutFolder {
+		return fname, nil
+	}
+	var elems []string
+	if fo := m.FrontMatter.Folders.Nodes; len(fo) > 0 && fo[0] != nil {
+		elems = append(elems, fo[0].Group.Name)
+		elems = append(elems, strings.Split(fo[0].FullName, "/")...)
+	} else if len(m.FrontMatter.Groups) > 0 {
+		elems = append(elems, m.FrontMatter.Groups[0])
+	}
+	var dirs []string
+	for _, e := range elems {
+		if e = sanitizePathElem(e); e != "" {
+			dirs = append(dirs, e)
+		}
+	}
+	return filepath.Join(append(dirs, fname)...), nil
+}
+
+var invalidPathChars = regexp.MustCompile(`[/\\:*?"<>|\x00-\x1f]+`)
+
+// sanitizePathElem makes the name of a group or a folder safe as a path element
+func sanitizePathElem(s string) string {
+	s = strings.TrimSpace(invalidPathChars.ReplaceAllString(s, "_"))
+	// avoid hidden directories, ".." and the metadata directory
+	return strings.TrimLeft(s, ".")
+}
+
+// findSyncDir returns the sync directory which the file belongs to. It is the
+// directory of the file, or the nearest ancestor directory in the folder layout.
+func findSyncDir(fpath string) string {
+	dir := filepath.Dir(fpath)
+	if _, err := os.Stat(filepath.Join(dir, syncMetaDir)); err == nil {
+		return dir
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	for d := filepath.Dir(abs); ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, syncMetaDir)); err == nil {
+			if st, err := loadSyncState(d); err == nil && st.layout() == LayoutFolder {
+				if rel, err := filepath.Rel(abs, d); err == nil {
+					return filepath.Join(dir, rel)
+				}
+				return d
+			}
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
+
+// noteNumberOf returns the number of the note of the Markdown file, which is taken
+// from the "id" field of the frontmatter or the filename like "123.md". Filenames
+// like "123-slug.md" are not trusted without the "id" field, because unpublished
+// files may be named like "2020-plan.md".
+func noteNumberOf(fpath string) (int, error) {
+	if num, err := noteNumberFromFilename(fpath); err == nil {
+		return num, nil
+	}
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return 0, err
+	}
+	b = bytes.ReplaceAll(b, []byte("\r"), nil)
+	contents := bytes.SplitN(b, []byte("---\n"), 3)
+	if len(contents) == 3 && len(contents[0]) == 0 {
+		var meta struct {
+			ID int `yaml:"id"`
+		}
+		if err := yaml.Unmarshal(contents[1], &meta); err == nil && meta.ID > 0 {
+			return meta.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid filename (must be [0-9]+.md or have the id in the frontmatter): %s", filepath.Base(fpath))
+}
+
+// localFiles returns the Markdown files in the sync directory. Hidden directories and
+// nested sync directories, e.g. of other teams, are skipped. Only the files directly
+// in the directory are returned for LayoutFlat.
+func (st *syncState) localFiles() ([]string, error) {
+	var files []string
+	err := filepath.Walk(st.dir, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if fpath == st.dir {
+				return nil
+			}
+			if fpath == filepath.Join(st.dir, attachmentsDir) {
+				return filepath.SkipDir
+			}
+			if st.layout() != LayoutFolder || strings.HasPrefix(fi.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(fpath, syncMetaDir)); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(fi.Name(), ".md") {
+			files = append(files, fpath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to list local files: %w", err)
+	}
+	return files, nil
+}
+
+// saveNote saves the remote note to the fpath, or the path decided by the layout when
+// the fpath is empty, and records the state. The previous local file of the note is
+// removed when the path has changed, e.g. the note was moved to another folder or
+// renamed.
+func (st *syncState) saveNote(n *Note, fpath string) (*MD, error) {
+	st.placeMu.Lock()
+	defer st.placeMu.Unlock()
+	m := n.toMD(st.dir)
+	if err := st.place(m, fpath); err != nil {
+		return nil, err
+	}
+	num, err := m.ID.Number()
+	if err != nil {
+		return nil, err
+	}
+	st.localize(m, st.uploadedFiles(num))
+	prev := st.localPath(num)
+	if err := m.write(); err != nil {
+		return nil, err
+	}
+	if err := st.record(m); err != nil {
+		return nil, err
+	}
+	if err := st.removeMoved(prev, m.filepath); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// place sets the path of the MD decided by the layout and the filename template
+// unless the fpath is specified. The note number is written to the "id" field of the
+// frontmatter when the filename isn't the number.
+func (st *syncState) place(m *MD, fpath string) error {
+	num, err := m.ID.Number()
+	if err != nil {
+		return err
+	}
+	if fpath == "" {
+		rel, err := st.layout().relPath(m, st.filename())
+		if err != nil {
+			return err
+		}
+		// the file being published may take its own path
+		if filepath.Join(st.dir, rel) != filepath.Clean(m.filepath) && st.taken(rel, num) {
+			rel = fmt.Sprintf("%s-%d.md", strings.TrimSuffix(rel, ".md"), num)
+		}
+		fpath = filepath.Join(st.dir, rel)
+	}
+	if filepath.Base(fpath) != fmt.Sprintf("%d.md", num) {
+		m.FrontMatter.ID = num
+	}
+	m.filepath = fpath
+	return nil
+}
+
+// taken reports whether the path is used by another note or an unpublished file, or
+// is named like another note number
+func (st *syncState) taken(rel string, num int) bool {
+	if n, err := noteNumberFromFilename(rel); err == nil {
+		return n != num
+	}
+	st.mu.Lock()
+	for n, ns := range st.Notes {
+		if n != num && ns.Path == filepath.ToSlash(rel) {
+			st.mu.Unlock()
+			return true
+		}
+	}
+	st.mu.Unlock()
+	fpath := filepath.Join(st.dir, rel)
+	if _, err := os.Stat(fpath); err != nil {
+		return false
+	}
+	n, err := noteNumberOf(fpath)
+	return err != nil || n != num
+}
+
+// relocate moves the unmodified local file of the note to the path decided by the
+// layout and the filename template, e.g. after they are changed, and rewrites the links
+// to the attachments for the new path or by the setting of the sync directory. The fetch
+// is called with the content linking to the attachments by the URLs before rewriting.
+// It returns the new path, or the empty string when the file isn't changed.
+func (st *syncState) relocate(num int, fetch func(content string) error) (string, error) {
+	st.placeMu.Lock()
+	defer st.placeMu.Unlock()
+	ns := st.get(num)
+	if ns == nil {
+		return "", nil
+	}
+	prev := st.localPath(num)
+	if _, err := os.Stat(prev); err != nil {
+		return "", nil
+	}
+	m, err := LoadMD(prev)
+	if err != nil {
+		return "", err
+	}
+	if m.hash() != ns.Hash {
+		// keep locally modified files where they are
+		return "", nil
+	}
+	m.dir = st.dir
+	content := st.remoteLinks(m, st.remoteAttachments(m, ns.AttachmentURLs), ns.NoteLinks)
+	content, err = st.remoteLocalFiles(m, content, func(_, ref string) (string, error) {
+		return ns.UploadedFiles[ref], nil
+	})
+	if err != nil {
+		return "", err
+	}
+	uploads := m.uploads
+	if err := fetch(content); err != nil {
+		return "", err
+	}
+	if err := st.place(m, ""); err != nil {
+		return "", err
+	}
+	// the relative paths of attachments follow the file, or are restored to the URLs
+	m.Content = content
+	st.localize(m, uploads)
+	if m.filepath == prev && m.hash() == ns.Hash {
+		return "", nil
+	}
+	if err := m.write(); err != nil {
+		return "", err
+	}
+	if err := st.record(m); err != nil {
+		return "", err
+	}
+	if err := st.removeMoved(prev, m.filepath); err != nil {
+		return "", err
+	}
+	return m.filepath, nil
+}
+
+// movedRemotely reports whether the local file of the note listed with its folders
+// and groups isn't in the directory decided by them. Notes without local files and
+// locally modified files, which are kept where they are, are not considered moved.
+func (st *syncState) movedRemotely(n *Note) bool {
+	if st.layout() != LayoutFolder {
+		return false
+	}
+	num, err := n.ID.Number()
+	if err != nil {
+		return false
+	}
+	ns := st.get(num)
+	if ns == nil {
+		return false
+	}
+	rel, err := st.layout().relPath(n.toMD(st.dir), st.filename())
+	if err != nil || path.Dir(filepath.ToSlash(rel)) == path.Dir(ns.Path) {
+		return false
+	}
+	modified, err := st.modifiedLocally(num, st.localPath(num))
+	return err == nil && !modified
+}
+
+// removeMoved removes the previous file of the note moved to the fpath and the
+// directories emptied by it. The sidecar file of the comments is moved together.
+func (st *syncState) removeMoved(prev, fpath string) error {
+	if filepath.Clean(prev) == filepath.Clean(fpath) {
+		return nil
+	}
+	if err := os.Remove(prev); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return xerrors.Errorf("failed to remove the moved file: %w", err)
+	}
+	log.Printf("moved %q to %q", prev, fpath)
+	if err := os.Rename(commentsPath(prev), commentsPath(fpath)); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("failed to move the comments: %w", err)
+	}
+	for d := filepath.Dir(prev); ; d = filepath.Dir(d) {
+		rel, err := filepath.Rel(st.dir, d)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			break
+		}
+		if os.Remove(d) != nil {
+			// not empty
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package kibela
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLayout_relPath(t *testing.T) {
+	home := Group{Name: "Home"}
+	testCases := []struct {
+		name     string
+		layout   Layout
+		filename FilenameTemplate
+		meta     Meta
+		expect   string
+	}{
+		{
+			name:     "flat",
+			layout:   LayoutFlat,
+			filename: FilenameID,
+			meta:     Meta{Title: "Hello World", Groups: []string{"Home"}},
+			expect:   "370.md",
+		},
+		{
+			name:     "flat slug",
+			layout:   LayoutFlat,
+			filename: "{slug}.md",
+			meta:     Meta{Title: "Hello World", Groups: []string{"Home"}},
+			expect:   "hello-world.md",
+		},
+		{
+			name:     "folder",
+			layout:   LayoutFolder,
+			filename: FilenameIDSlug,
+			meta: Meta{
+				Title:   "Hello World",
+				Groups:  []string{"Home"},
+				Folders: Folders{Nodes: []*Folder{{FullName: "Dev/Design docs", Group: home}}},
+			},
+			expect: "Home/Dev/Design docs/370-hello-world.md",
+		},
+		{
+			name:     "group",
+			layout:   LayoutFolder,
+			filename: FilenameIDSlug,
+			meta:     Meta{Title: "Hello World", Groups: []string{"Home", "Dev"}},
+			expect:   "Home/370-hello-world.md",
+		},
+		{
+			name:     "no groups",
+			layout:   LayoutFolder,
+			filename: FilenameIDSlug,
+			meta:     Meta{Title: "日本語"},
+			expect:   "370-日本語.md",
+		},
+		{
+			name:     "unsafe names",
+			layout:   LayoutFolder,
+			filename: FilenameIDSlug,
+			meta: Meta{
+				Title:   "a/b",
+				Folders: Folders{Nodes: []*Folder{{FullName: "../x:y/.kibelasync", Group: Group{Name: "Ho|me"}}}},
+			},
+			expect: "Ho_me/x_y/kibelasync/370-a-b.md",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &MD{ID: newID("Blog", 370), FrontMatter: &tc.meta}
+			got, err := tc.layout.relPath(m, tc.filename)
+			if err != nil {
+				t.Fatalf("error should be nil, but: %s", err)
+			}
+			if expect := filepath.FromSlash(tc.expect); got != expect {
+				t.Errorf("got: %q, expect: %q", got, expect)
+			}
+		})
+	}
+}
+
+func TestNoteNumberOf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kibelasync-layout-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name    string
+		content string
+		expect  int
+		hasErr  bool
+	}{
+		{name: "370.md", content: "---\ntitle: a\n---\n", expect: 370},
+		{name: "370-hello.md", content: "---\nid: 370\ntitle: a\n---\n", expect: 370},
+		{name: "hello.md", content: "---\r\nid: 370\r\ntitle: a\r\n---\r\n", expect: 370},
+		{name: "2019-plan.md", content: "---\ntitle: a\n---\n", hasErr: true},
+		{name: "plan.md", content: "no frontmatter\n", hasErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fpath := filepath.Join(dir, tc.name)
+			if err := ioutil.WriteFile(fpath, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := noteNumberOf(fpath)
+			if tc.hasErr {
+				if err == nil {
+					t.Errorf("error should be occurred, but got: %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error should be nil, but: %s", err)
+			}
+			if got != tc.expect {
+				t.Errorf("got: %d, expect: %d", got, tc.expect)
+			}
+		})
+	}
+}
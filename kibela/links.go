@@ -0,0 +1,223 @@
+package kibela
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// SetLinks enables or disables rewriting the links to notes of the team into the
+// relative paths of their local files by pull in the sync directory.
+func (ki *Kibela) SetLinks(dir string, enabled bool) error {
+	st, err := ki.syncState(dir)
+	if err != nil {
+		return xerrors.Errorf("failed to SetLinks: %w", err)
+	}
+	return st.updateSettings(func() bool {
+		if st.Links == enabled {
+			return false
+		}
+		st.Links = enabled
+		return true
+	})
+}
+
+// noteLinkReg matches the link targets to notes, which are like "/notes/123",
+// "/@Songmu/123" and "https://{team}.kibe.la/notes/123#comment_1"
+var noteLinkReg = regexp.MustCompile(`\A(?:https://([0-9A-Za-z-]+)\.kibe\.la)?/(?:notes|@[0-9A-Za-z_.-]+)/([0-9]+)(#\S*)?\z`)
+
+// noteLinkOf returns the number of the note of the team linked by the target, and the
+// URL and the fragment of the target
+func (st *syncState) noteLinkOf(target string) (num int, u, fragment string, ok bool) {
+	m := noteLinkReg.FindStringSubmatch(target)
+	if m == nil || m[1] != "" && m[1] != st.team {
+		return 0, "", "", false
+	}
+	num, err := strconv.Atoi(m[2])
+	if err != nil {
+		return 0, "", "", false
+	}
+	return num, strings.TrimSuffix(target, m[3]), m[3], true
+}
+
+// localizeLinks rewrites the links to the notes which have local files in the content
+// of the MD into the relative paths of the files. The URLs are remembered in the MD by
+// the paths to restore them exactly on push. When a note is linked by different URLs,
+// only the first form is rewritten.
+func (st *syncState) localizeLinks(m *MD) {
+	links := make(map[string]string)
+	// relative paths to the local files already in the content are kept as they are
+	var nums map[string]int
+	replaceLinkTargets(m.Content, func(target string) (string, error) {
+		if nums == nil {
+			nums = st.noteNumbersByPath()
+		}
+		ref, _ := splitFragment(target)
+		if _, ok := st.noteOfLocalLink(m, ref, nums); ok {
+			links[ref] = ref
+		}
+		return "", nil
+	})
+	urls := make(map[int]string)
+	m.Content, _ = replaceLinkTargets(m.Content, func(target string) (string, error) {
+		num, u, fragment, ok := st.noteLinkOf(target)
+		if !ok {
+			return "", nil
+		}
+		if prev, ok := urls[num]; ok && prev != u {
+			return "", nil
+		}
+		if st.get(num) == nil {
+			return "", nil
+		}
+		fpath := st.localPath(num)
+		if _, err := os.Stat(fpath); err != nil {
+			return "", nil
+		}
+		rel, err := relPathFrom(m.filepath, fpath)
+		if err != nil {
+			return "", nil
+		}
+		ref := escapeLinkPath(filepath.ToSlash(rel))
+		if prev, ok := links[ref]; ok && prev != u {
+			return "", nil
+		}
+		urls[num] = u
+		links[ref] = u
+		return ref + fragment, nil
+	})
+	m.links = links
+}
+
+func splitFragment(target string) (ref, fragment string) {
+	if i := strings.IndexByte(target, '#'); i >= 0 {
+		return target[:i], target[i:]
+	}
+	return target, ""
+}
+
+// noteOfLocalLink returns the number of the note whose local file is linked by the
+// relative path from the MD. The nums are the numbers of notes by the absolute paths.
+func (st *syncState) noteOfLocalLink(m *MD, ref string, nums map[string]int) (int, bool) {
+	p, err := unescapeLinkPath(ref)
+	if err != nil || !strings.HasSuffix(p, ".md") || strings.Contains(p, ":") || strings.HasPrefix(p, "/") {
+		return 0, false
+	}
+	abs, err := filepath.Abs(filepath.Join(filepath.Dir(m.filepath), filepath.FromSlash(p)))
+	if err != nil {
+		return 0, false
+	}
+	num, ok := nums[abs]
+	return num, ok
+}
+
+// escapeLinkPath escapes the characters which can't be in the targets of links. "#"
+// and "%" are escaped too not to be taken as a fragment or an escape on push.
+func escapeLinkPath(p string) string {
+	return strings.NewReplacer("%", "%25", "#", "%23", " ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E", `"`, "%22", "'", "%27").Replace(p)
+}
+
+// remoteLinks returns the content whose relative paths of the local files of notes
+// are restored to the URLs. The URLs remembered by localizeLinks are used, and
+// "https://{team}.kibe.la/notes/{id}" for new links. The URLs used are remembered
+// in the MD.
+func (st *syncState) remoteLinks(m *MD, content string, links map[string]string) string {
+	var nums map[string]int
+	used := make(map[string]string)
+	content, _ = replaceLinkTargets(content, func(target string) (string, error) {
+		ref, fragment := splitFragment(target)
+		if u, ok := lookupLink(links, ref); ok {
+			used[ref] = u
+			return u + fragment, nil
+		}
+		if nums == nil {
+			nums = st.noteNumbersByPath()
+		}
+		num, ok := st.noteOfLocalLink(m, ref, nums)
+		if !ok {
+			return "", nil
+		}
+		u := fmt.Sprintf("https://%s.kibe.la/notes/%d", st.team, num)
+		used[ref] = u
+		return u + fragment, nil
+	})
+	m.links = used
+	return content
+}
+
+// lookupLink returns the URL remembered for the relative path. The paths are compared
+// unescaped when the path isn't remembered as it is.
+func lookupLink(links map[string]string, ref string) (string, bool) {
+	if u, ok := links[ref]; ok {
+		return u, true
+	}
+	p, err := unescapeLinkPath(ref)
+	if err != nil {
+		return "", false
+	}
+	refs := make([]string, 0, len(links))
+	for r := range links {
+		refs = append(refs, r)
+	}
+	sort.Strings(refs)
+	for _, r := range refs {
+		if rp, err := unescapeLinkPath(r); err == nil && rp == p {
+			return links[r], true
+		}
+	}
+	return "", false
+}
+
+func unescapeLinkPath(ref string) (string, error) {
+	return url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(ref, "<"), ">"))
+}
+
+// noteNumbersByPath returns the numbers of the notes by the absolute paths of their
+// local files
+func (st *syncState) noteNumbersByPath() map[string]int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	nums := make(map[string]int, len(st.Notes))
+	for num, ns := range st.Notes {
+		if abs, err := filepath.Abs(filepath.Join(st.dir, filepath.FromSlash(ns.Path))); err == nil {
+			nums[abs] = num
+		}
+	}
+	return nums
+}
+
+// relinkNotes rewrites the links in the unmodified local files of every note if it is
+// enabled, since the files of the linked notes may have been pulled, moved or renamed
+func (ki *Kibela) relinkNotes(ctx context.Context, st *syncState) error {
+	if !st.links() {
+		return nil
+	}
+	st.mu.Lock()
+	nums := make([]int, 0, len(st.Notes))
+	for num := range st.Notes {
+		nums = append(nums, num)
+	}
+	st.mu.Unlock()
+	sort.Ints(nums)
+	for _, num := range nums {
+		fpath, err := st.relocate(num, func(content string) error {
+			return ki.downloadAttachments(ctx, st, content)
+		})
+		if err != nil {
+			return xerrors.Errorf("failed to relink notes: %w", err)
+		}
+		if fpath != "" {
+			log.Printf("rewrote links in %q", fpath)
+		}
+	}
+	return nil
+}
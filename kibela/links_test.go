@@ -0,0 +1,93 @@
+package kibela
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncState_localizeLinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kibelasync-links-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	st := &syncState{dir: dir, team: "example", Notes: map[int]*noteState{
+		1: {Path: "Home/1-hello.md"},
+		2: {Path: "Dev/Design/2-design.md"},
+		3: {Path: "Home/議事録 10月.md"},
+		4: {Path: "Home/4-missing.md"},
+		5: {Path: "C# 100%/5-sharp.md"},
+	}}
+	for _, num := range []int{1, 2, 3, 5} {
+		fpath := st.localPath(num)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		content string
+		expect  string
+	}{{
+		name:    "note URL",
+		content: "[design](https://example.kibe.la/notes/2)\n",
+		expect:  "[design](../Dev/Design/2-design.md)\n",
+	}, {
+		name:    "user path with fragment",
+		content: "[comment](/@Songmu/2#comment_3) [self](/notes/1)\n",
+		expect:  "[comment](../Dev/Design/2-design.md#comment_3) [self](1-hello.md)\n",
+	}, {
+		name:    "HTML and escaped path",
+		content: `<a href="https://example.kibe.la/notes/3">minutes</a>` + "\n",
+		expect:  `<a href="議事録%2010月.md">minutes</a>` + "\n",
+	}, {
+		name:    "sharp and percent in path",
+		content: "[sharp](/notes/5#top)\n",
+		expect:  "[sharp](../C%23%20100%25/5-sharp.md#top)\n",
+	}, {
+		name:    "different forms of the same note",
+		content: "[a](/notes/2) [b](https://example.kibe.la/notes/2) [c](/notes/2#top)\n",
+		expect:  "[a](../Dev/Design/2-design.md) [b](https://example.kibe.la/notes/2) [c](../Dev/Design/2-design.md#top)\n",
+	}, {
+		name:    "relative path already in the content",
+		content: "[a](../Dev/Design/2-design.md) [b](/notes/2)\n",
+		expect:  "[a](../Dev/Design/2-design.md) [b](/notes/2)\n",
+	}, {
+		name:    "not rewritten",
+		content: "[a](https://other.kibe.la/notes/2) [b](/notes/9) [c](/notes/4) [d](/notes/2?x=1) https://example.kibe.la/notes/2\n",
+		expect:  "[a](https://other.kibe.la/notes/2) [b](/notes/9) [c](/notes/4) [d](/notes/2?x=1) https://example.kibe.la/notes/2\n",
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &MD{Content: tc.content, filepath: st.localPath(1)}
+			st.localizeLinks(m)
+			if m.Content != tc.expect {
+				t.Errorf("localized:\n  got:    %q\n  expect: %q", m.Content, tc.expect)
+			}
+			// the round trip keeps the remote content byte-identical
+			if got := st.remoteLinks(m, m.Content, m.links); got != tc.content {
+				t.Errorf("round trip:\n  got:    %q\n  expect: %q", got, tc.content)
+			}
+		})
+	}
+
+	// new links to the local files are restored to the note URLs
+	m := &MD{Content: "[new](../Dev/Design/2-design.md#top) [x](../README.md)\n", filepath: st.localPath(1)}
+	expect := "[new](https://example.kibe.la/notes/2#top) [x](../README.md)\n"
+	if got := st.remoteLinks(m, m.Content, nil); got != expect {
+		t.Errorf("got: %q, expect: %q", got, expect)
+	}
+
+	// paths escaped differently are restored to the remembered URLs
+	m = &MD{Content: "[sharp](../C%23%20100%25/5-sharp.md)\n", filepath: st.localPath(1)}
+	links := map[string]string{"../C%23 100%25/5-sharp.md": "/@Songmu/5"}
+	if got, expect := st.remoteLinks(m, m.Content, links), "[sharp](/@Songmu/5)\n"; got != expect {
+		t.Errorf("got: %q, expect: %q", got, expect)
+	}
+}
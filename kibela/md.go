@@ -2,7 +2,8 @@ package kibela
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -15,7 +16,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/konifar/kibelasync/client"
 	"golang.org/x/xerrors"
 	"gopkg.in/yaml.v2"
 )
@@ -28,6 +28,13 @@ type MD struct {
 	UpdatedAt   time.Time
 
 	dir, filepath string
+	// attachments are the URLs of the attachments linked by the local paths
+	attachments map[int]string
+	// uploads are the paths of the attachments uploaded from the local files by the
+	// references
+	uploads map[string]string
+	// links are the URLs of the notes linked by the relative paths
+	links map[string]string
 }
 
 // NewMD returns new MD
@@ -54,10 +61,20 @@ func NewMD(fpath string, r io.Reader, title string, coEdit bool, dir string) (*M
 
 // Meta is a meta information of entry rendered as FrontMatter
 type Meta struct {
+	// ID is the number of the note, which is written in the folder layout
+	ID      int      `yaml:"id,omitempty"`
 	Title   string   `yaml:"title"`
 	Author  string   `yaml:"author,omitempty"`
 	Groups  []string `yaml:"groups,flow"`
 	Folders Folders  `yaml:"folders,omitempty"`
+	// Team is the team of the note in the working tree holding several teams
+	Team string `yaml:"team,omitempty"`
+}
+
+// copyLocalFields copies the fields which only local files have
+func (me *Meta) copyLocalFields(local *Meta) {
+	me.ID = local.ID
+	me.Team = local.Team
 }
 
 func (me *Meta) coediting() bool {
@@ -76,6 +93,15 @@ func (m *MD) fullContent() string {
 }
 
 func (m *MD) save() error {
+	if err := m.write(); err != nil {
+		return err
+	}
+	log.Printf("saved to %q", m.filepath)
+	return nil
+}
+
+// write saves the MD without logging
+func (m *MD) write() error {
 	stuff := strings.Split(m.ID.String(), "/")
 	if len(stuff) != 2 {
 		return fmt.Errorf("invalid id: %s", string(m.ID))
@@ -102,23 +128,91 @@ func (m *MD) save() error {
 			return xerrors.Errorf("failed to set mtime to Markdown: %w", err)
 		}
 	}
-	log.Printf("saved to %q", m.filepath)
+	if err := m.saveBase(); err != nil {
+		return xerrors.Errorf("failed to save Markdown: %w", err)
+	}
 	return nil
 }
 
-// LoadMD loads MD from file
-func LoadMD(fpath string) (*MD, error) {
-	fname := filepath.Base(fpath)
-	stuffs := strings.Split(fname, ".")
-	if len(stuffs) != 2 {
-		return nil, fmt.Errorf("invalid filename (must be [0-9]+.md): %s", fname)
+// The pristine copy of each note as it was at the last synchronization is stored
+// under the ".kibelasync/base" directory beside the Markdown file. It is used as
+// the base of the three-way merge when the remote note has diverged.
+const (
+	syncMetaDir = ".kibelasync"
+	baseDir     = "base"
+)
+
+// syncDir returns the sync directory which the MD belongs to
+func (m *MD) syncDir() string {
+	if m.dir != "" {
+		return m.dir
 	}
-	if stuffs[1] != "md" {
-		return nil, fmt.Errorf("invalid filename (must be [0-9]+.md): %s", fname)
+	return findSyncDir(m.filepath)
+}
+
+func (m *MD) basePath() (string, error) {
+	idNum, err := m.ID.Number()
+	if err != nil {
+		return "", err
 	}
-	num, err := strconv.Atoi(stuffs[0])
+	return filepath.Join(m.syncDir(), syncMetaDir, baseDir, fmt.Sprintf("%d.md", idNum)), nil
+}
+
+func (m *MD) saveBase() error {
+	basePath, err := m.basePath()
+	if err != nil {
+		return xerrors.Errorf("failed to saveBase: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(basePath), 0755); err != nil {
+		return xerrors.Errorf("failed to saveBase: %w", err)
+	}
+	if err := ioutil.WriteFile(basePath, []byte(m.fullContent()), 0644); err != nil {
+		return xerrors.Errorf("failed to saveBase: %w", err)
+	}
+	if !m.UpdatedAt.IsZero() {
+		if err := os.Chtimes(basePath, m.UpdatedAt, m.UpdatedAt); err != nil {
+			return xerrors.Errorf("failed to set mtime to base: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadBase loads the base snapshot of the MD. It returns nil without errors
+// when the snapshot doesn't exist, e.g. the note was pulled by older versions.
+func (m *MD) loadBase() (*MD, error) {
+	basePath, err := m.basePath()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to loadBase: %w", err)
+	}
+	f, err := os.Open(basePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, xerrors.Errorf("failed to loadBase: %w", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to loadBase: %w", err)
+	}
+	base := &MD{
+		ID:        m.ID,
+		UpdatedAt: fi.ModTime(),
+		filepath:  basePath,
+	}
+	if err := base.loadContentFromReader(f, true); err != nil {
+		return nil, xerrors.Errorf("failed to loadBase: %w", err)
+	}
+	return base, nil
+}
+
+// LoadMD loads MD from file. The note number is taken from the "id" field of the
+// frontmatter or the filename like "123.md".
+func LoadMD(fpath string) (*MD, error) {
+	num, err := noteNumberOf(fpath)
 	if err != nil {
-		return nil, fmt.Errorf("invalid filename (must be [0-9]+.md): %s", fname)
+		return nil, err
 	}
 
 	f, err := os.Open(fpath)
@@ -141,7 +235,31 @@ func LoadMD(fpath string) (*MD, error) {
 	return m, nil
 }
 
+func noteNumberFromFilename(fpath string) (int, error) {
+	fname := filepath.Base(fpath)
+	stuffs := strings.Split(fname, ".")
+	if len(stuffs) != 2 || stuffs[1] != "md" {
+		return 0, fmt.Errorf("invalid filename (must be [0-9]+.md): %s", fname)
+	}
+	num, err := strconv.Atoi(stuffs[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid filename (must be [0-9]+.md): %s", fname)
+	}
+	return num, nil
+}
+
+func (m *MD) hash() string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(m.fullContent())))
+}
+
 func (m *MD) loadContentFromReader(r io.Reader, forceFrontmatter bool) error {
+	return m.loadContent(r, forceFrontmatter, true)
+}
+
+// loadContent loads the frontmatter and the content. The first heading is taken as the
+// title when the frontmatter has no title if the withTitle is true, and kept in the
+// content otherwise. CRLFs and the BOM are removed.
+func (m *MD) loadContent(r io.Reader, forceFrontmatter, withTitle bool) error {
 	b, err := ioutil.ReadAll(r)
 	if err != nil {
 		return xerrors.Errorf("failed to load md: %w", err)
@@ -149,23 +267,30 @@ func (m *MD) loadContentFromReader(r io.Reader, forceFrontmatter bool) error {
 	if m.FrontMatter == nil {
 		m.FrontMatter = &Meta{}
 	}
-	str := strings.ReplaceAll(string(b), "\r", "")
+	str := strings.TrimPrefix(strings.ReplaceAll(string(b), "\r", ""), "\ufeff")
+	body := func(s string) {
+		if withTitle {
+			m.FrontMatter.Title, m.Content = detectTitle(s)
+		} else {
+			m.Content = strings.TrimSpace(s) + "\n"
+		}
+	}
 	contents := strings.SplitN(str, "---\n", 3)
 	if len(contents) == 3 && contents[0] == "" {
 		if err := yaml.Unmarshal([]byte(contents[1]), m.FrontMatter); err != nil {
 			if forceFrontmatter {
 				return xerrors.Errorf("invalid frontmatter: %w", err)
 			}
-			m.FrontMatter.Title, m.Content = detectTitle(string(b))
+			body(str)
 		} else {
 			if m.FrontMatter.Title == "" {
-				m.FrontMatter.Title, m.Content = detectTitle(contents[2])
+				body(contents[2])
 			} else {
 				m.Content = strings.TrimSpace(contents[2]) + "\n"
 			}
 		}
 	} else if !forceFrontmatter {
-		m.FrontMatter.Title, m.Content = detectTitle(string(b))
+		body(str)
 	} else {
 		return fmt.Errorf("invalid contents of md: %s", string(b))
 	}
@@ -213,17 +338,123 @@ func (m *MD) toNote() *Note {
 	}
 }
 
-// PushMD pushes MD to Kibela
+// ErrConflict is an error representing the local changes conflict with the remote ones
+var ErrConflict = errors.New("conflict")
+
+// PushMD pushes MD to Kibela. When the remote note has been updated since the last
+// synchronization, the local and remote changes are merged by using the base snapshot.
+// If the merge conflicts, conflict markers are written into the local file and the
+// push is refused with ErrConflict.
 func (ki *Kibela) PushMD(ctx context.Context, m *MD) error {
+	if hasConflictMarkers(m.fullContent()) {
+		return xerrors.Errorf("failed to pushMD: unresolved conflict markers in %q: %w", m.filepath, ErrConflict)
+	}
+	remoteNote, err := ki.getNote(ctx, m.ID)
+	if err != nil {
+		return xerrors.Errorf("failed to pushMD: %w", err)
+	}
+	remoteMD := remoteNote.toMD(m.dir)
+	remoteMD.filepath = m.filepath
+	remoteMD.FrontMatter.copyLocalFields(m.FrontMatter)
+	st, err := ki.syncState(m.syncDir())
+	if err != nil {
+		return xerrors.Errorf("failed to pushMD: %w", err)
+	}
+	num, err := m.ID.Number()
+	if err != nil {
+		return xerrors.Errorf("failed to pushMD: %w", err)
+	}
+	st.localize(remoteMD, st.uploadedFiles(num))
+
+	base, err := m.loadBase()
+	if err != nil {
+		return xerrors.Errorf("failed to pushMD: %w", err)
+	}
+	merged := false
+	if base != nil {
+		baseContent, remoteContent := base.fullContent(), remoteMD.fullContent()
+		if baseContent != remoteContent {
+			content, ok := merge3(baseContent, m.fullContent(), remoteContent)
+			if !ok {
+				if err := ioutil.WriteFile(m.filepath, []byte(content), 0644); err != nil {
+					return xerrors.Errorf("failed to pushMD while writing conflicts: %w", err)
+				}
+				// The local file contains the remote changes now, so the remote note
+				// becomes the base of the next push.
+				if err := remoteMD.saveBase(); err != nil {
+					return xerrors.Errorf("failed to pushMD: %w", err)
+				}
+				if err := ki.recordSync(remoteMD); err != nil {
+					return xerrors.Errorf("failed to pushMD: %w", err)
+				}
+				return xerrors.Errorf("failed to pushMD: merge conflicts in %q: %w", m.filepath, ErrConflict)
+			}
+			m.FrontMatter = nil
+			if err := m.loadContentFromReader(strings.NewReader(content), true); err != nil {
+				return xerrors.Errorf("failed to pushMD while loading merged content: %w", err)
+			}
+			log.Printf("merged remote changes into %q", m.filepath)
+			merged = true
+		}
+	}
+
 	n := m.toNote()
-	if err := ki.pushNote(ctx, n); err != nil {
+	if n.Content, err = ki.remoteContent(ctx, st, m); err != nil {
+		return xerrors.Errorf("failed to pushMD: %w", err)
+	}
+	if err := ki.pushNote(ctx, n, remoteNote); err != nil {
+		return xerrors.Errorf("failed to pushMD: %w", err)
+	}
+	m.UpdatedAt = n.UpdatedAt.Time
+	if merged {
+		if err := m.save(); err != nil {
+			return xerrors.Errorf("failed to pushMD: %w", err)
+		}
+	} else {
+		if err := os.Chtimes(m.filepath, m.UpdatedAt, m.UpdatedAt); err != nil {
+			return xerrors.Errorf("failed to pushMD: %w", err)
+		}
+		if err := m.saveBase(); err != nil {
+			return xerrors.Errorf("failed to pushMD: %w", err)
+		}
+	}
+	if err := ki.recordSync(m); err != nil {
 		return xerrors.Errorf("failed to pushMD: %w", err)
 	}
-	return os.Chtimes(m.filepath, n.UpdatedAt.Time, n.UpdatedAt.Time)
+	return nil
+}
+
+// DiffMD returns the unified diff from the remote note to the local MD, that is,
+// the changes which will be applied by pushing. It returns an empty string when
+// there are no differences.
+func (ki *Kibela) DiffMD(ctx context.Context, m *MD, wordDiff bool) (string, error) {
+	remoteNote, err := ki.getNote(ctx, m.ID)
+	if err != nil {
+		return "", xerrors.Errorf("failed to DiffMD: %w", err)
+	}
+	num, err := m.ID.Number()
+	if err != nil {
+		return "", xerrors.Errorf("failed to DiffMD: %w", err)
+	}
+	remoteMD := remoteNote.toMD(m.dir)
+	remoteMD.filepath = m.filepath
+	remoteMD.FrontMatter.copyLocalFields(m.FrontMatter)
+	st, err := ki.syncState(m.syncDir())
+	if err != nil {
+		return "", xerrors.Errorf("failed to DiffMD: %w", err)
+	}
+	st.localize(remoteMD, st.uploadedFiles(num))
+	return unifiedDiff(
+		fmt.Sprintf("remote/%d.md", num), filepath.ToSlash(m.filepath),
+		remoteMD.fullContent(), m.fullContent(), wordDiff), nil
 }
 
 // PublishMD publishes new MD to Kibela
+// The default groups of the profile are used when the MD has no groups.
 func (ki *Kibela) PublishMD(ctx context.Context, m *MD, save bool) error {
+	if len(m.FrontMatter.Groups) == 0 {
+		m.FrontMatter.Groups = ki.defaultGroups
+	}
 	groupIDs := make([]string, len(m.FrontMatter.Groups))
 	for i, g := range m.FrontMatter.Groups {
 		id, err := ki.fetchGroupID(ctx, g)
@@ -233,32 +464,28 @@ func (ki *Kibela) PublishMD(ctx context.Context, m *MD, save bool) error {
 		groupIDs[i] = string(id)
 	}
 	sort.Strings(groupIDs)
-	data, err := ki.cli.Do(ctx, &client.Payload{
-		Query: createNoteMutation,
-		Variables: struct {
-			Input *noteInput `json:"input"`
-		}{
-			Input: &noteInput{
-				Title:     m.FrontMatter.Title,
-				Content:   m.Content,
-				Folders:   m.FrontMatter.Folders,
-				CoEditing: m.FrontMatter.coediting(),
-				GroupIDs:  groupIDs,
-			},
+	st, err := ki.syncState(m.syncDir())
+	if err != nil {
+		return xerrors.Errorf("failed to publishMD: %w", err)
+	}
+	content, err := ki.remoteContent(ctx, st, m)
+	if err != nil {
+		return xerrors.Errorf("failed to publishMD: %w", err)
+	}
+	uploads := m.uploads
+	res, err := ki.doCreateNote(ctx, &createNoteVariables{
+		Input: &noteInput{
+			Title:     m.FrontMatter.Title,
+			Content:   content,
+			Folders:   m.FrontMatter.Folders,
+			CoEditing: m.FrontMatter.coediting(),
+			GroupIDs:  groupIDs,
 		},
 	})
 	if err != nil {
 		return xerrors.Errorf("failed to publishNote while accessing remote: %w", err)
 	}
-	var res struct {
-		CreateNote struct {
-			Note *Note `json:"note"`
-		} `json:"createNote"`
-	}
-	if err := json.Unmarshal(data, &res); err != nil {
-		return xerrors.Errorf("failed to ki.publishNote while unmarshaling response: %w", err)
-	}
-	if res.CreateNote.Note == nil {
+	if res.CreateNote == nil || res.CreateNote.Note == nil {
 		return xerrors.New("failed to publish to kibela on any reason. null createNote was returned")
 	}
 	n := res.CreateNote.Note
@@ -278,11 +505,19 @@ func (ki *Kibela) PublishMD(ctx context.Context, m *MD, save bool) error {
 		m.FrontMatter.Author = n.Author.Account
 	}
 	origFilePath := m.filepath
-	m.filepath = ""
+	if err := st.place(m, ""); err != nil {
+		return xerrors.Errorf("failed to publishMD. publish succeeded but failed to store file: %w", err)
+	}
+	// the links to the attachments are rewritten for the new path
+	m.Content = content
+	st.localize(m, uploads)
 	if err := m.save(); err != nil {
 		return xerrors.Errorf("failed to publishMD. publish succeeded but failed to store file: %w", err)
 	}
-	if origFilePath != "" {
+	if err := ki.recordSync(m); err != nil {
+		return xerrors.Errorf("failed to publishMD. publish succeeded but failed to record state: %w", err)
+	}
+	if origFilePath != "" && filepath.Clean(origFilePath) != filepath.Clean(m.filepath) {
 		if err := os.RemoveAll(origFilePath); err != nil {
 			return xerrors.Errorf("failed to publishMD while cleanup orginal MD: %w", err)
 		}
@@ -11,6 +11,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"golang.org/x/xerrors"
 )
 
 func newTestMD() *MD {
@@ -93,6 +95,16 @@ Go Go Go`,
 				Author: "dummy",
 			},
 		},
+	}, {
+		name:  "BOM and CRLF",
+		input: "\ufeff---\r\ntitle: Hello!!\r\n---\r\n\r\nGo Go Go\r\n",
+		expect: MD{
+			Content: "Go Go Go\n",
+			FrontMatter: &Meta{
+				Title:  "Hello!!",
+				Author: "dummy",
+			},
+		},
 	}, {
 		name:  "not frontmatter",
 		title: "Hello!!!",
@@ -155,21 +167,24 @@ const testMDPath = "testdata/notes/366.md"
 
 func TestMD_save(t *testing.T) {
 	m := newTestMD()
-	tmpf, err := ioutil.TempFile("", "")
+	tmpdir, err := ioutil.TempDir("", "kibelasync-")
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.RemoveAll(tmpf.Name())
-	tmpf.Close()
-	m.filepath = tmpf.Name()
+	defer os.RemoveAll(tmpdir)
+	m.filepath = filepath.Join(tmpdir, "366.md")
 	if err := m.save(); err != nil {
 		t.Errorf("error should be nil, but: %s", err)
 	}
-	out := readFile(t, tmpf.Name())
+	out := readFile(t, m.filepath)
 	expect := readFile(t, testMDPath)
 	if out != expect {
 		t.Errorf("out:\n%s\nexpect:\n%s\n", out, expect)
 	}
+	base := readFile(t, filepath.Join(tmpdir, ".kibelasync", "base", "366.md"))
+	if base != expect {
+		t.Errorf("base:\n%s\nexpect:\n%s\n", base, expect)
+	}
 }
 
 func TestLoadMD(t *testing.T) {
@@ -416,6 +431,119 @@ func TestKibela_PushMD(t *testing.T) {
 	}
 }
 
+const testRemoteNote707 = `{
+  "data": {
+    "note": {
+      "title": "たいとる！",
+      "content": %q,
+      "coediting": false,
+      "folders":{
+        "nodes": [{
+          "id": "1",
+          "fullName": "testtop/testsub1",
+          "group": {
+            "id": "R3JvdXAvMQ",
+            "name": "Public"
+          }
+        }]
+      },
+      "groups": [{
+        "name": "Home",
+        "id": "R3JvdXAvMQ"
+      }],
+      "author": {
+        "account": "Songmu"
+      },
+      "updatedAt": "2019-06-23T16:50:00.000+09:00"
+    }
+  }
+}`
+
+func setupPushMDTest(t *testing.T, localContent string) (tmpdir string, m *MD) {
+	t.Helper()
+	tmpdir, err := ioutil.TempDir("", "kibelasync-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseMD := "testdata/notes/707.md"
+	filePath := filepath.Join(tmpdir, "707.md")
+	basePath := filepath.Join(tmpdir, ".kibelasync", "base", "707.md")
+	if err := os.MkdirAll(filepath.Dir(basePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cp(baseMD, basePath); err != nil {
+		t.Fatal(err)
+	}
+	local := strings.Replace(readFile(t, baseMD), "Hello World!\nこんにちは!\n", localContent, 1)
+	if err := ioutil.WriteFile(filePath, []byte(local), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err = LoadMD(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpdir, m
+}
+
+func TestKibela_PushMD_merge(t *testing.T) {
+	expectUpdatedAt := "2019-06-23T16:54:09.447+09:00"
+	ki := testKibela(newClient([]string{
+		fmt.Sprintf(testRemoteNote707, "Hello World!\nこんにちは!\nremote line\n"),
+		fmt.Sprintf(`{
+  "data": {
+    "updateNote": {
+      "note": {
+        "updatedAt": "%s"
+      }
+    }
+  }
+}`, expectUpdatedAt)}))
+
+	tmpdir, m := setupPushMDTest(t, "Hello Kibela!\nこんにちは!\n")
+	defer os.RemoveAll(tmpdir)
+	if err := ki.PushMD(context.Background(), m); err != nil {
+		t.Errorf("error should be nil, but: %s", err)
+	}
+	expect := strings.Replace(readFile(t, "testdata/notes/707.md"),
+		"Hello World!\nこんにちは!\n", "Hello Kibela!\nこんにちは!\nremote line\n", 1)
+	if out := readFile(t, m.filepath); out != expect {
+		t.Errorf("\n   out:\n%s\nexpect:\n%s", out, expect)
+	}
+	if base := readFile(t, filepath.Join(tmpdir, ".kibelasync", "base", "707.md")); base != expect {
+		t.Errorf("\n  base:\n%s\nexpect:\n%s", base, expect)
+	}
+}
+
+func TestKibela_PushMD_conflict(t *testing.T) {
+	remoteContent := "Hello World!\nremote\n"
+	ki := testKibela(newClient([]string{fmt.Sprintf(testRemoteNote707, remoteContent)}))
+
+	tmpdir, m := setupPushMDTest(t, "Hello World!\nlocal\n")
+	defer os.RemoveAll(tmpdir)
+	err := ki.PushMD(context.Background(), m)
+	if !xerrors.Is(err, ErrConflict) {
+		t.Errorf("error should be ErrConflict, but: %v", err)
+	}
+	orig := readFile(t, "testdata/notes/707.md")
+	expect := strings.Replace(orig, "Hello World!\nこんにちは!\n",
+		"Hello World!\n<<<<<<< local\nlocal\n=======\nremote\n>>>>>>> remote\n", 1)
+	if out := readFile(t, m.filepath); out != expect {
+		t.Errorf("\n   out:\n%s\nexpect:\n%s", out, expect)
+	}
+	expectBase := strings.Replace(orig, "Hello World!\nこんにちは!\n", remoteContent, 1)
+	if base := readFile(t, filepath.Join(tmpdir, ".kibelasync", "base", "707.md")); base != expectBase {
+		t.Errorf("\n  base:\n%s\nexpect:\n%s", base, expectBase)
+	}
+
+	m, err = LoadMD(m.filepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ki.PushMD(context.Background(), m); !xerrors.Is(err, ErrConflict) {
+		t.Errorf("pushing unresolved file should be refused, but: %v", err)
+	}
+}
+
 func readFile(t *testing.T, f string) string {
 	t.Helper()
 	out, err := ioutil.ReadFile(f)
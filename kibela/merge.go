@@ -0,0 +1,88 @@
+package kibela
+
+import "strings"
+
+const (
+	conflictMarkerLocal  = "<<<<<<< local"
+	conflictMarkerSep    = "======="
+	conflictMarkerRemote = ">>>>>>> remote"
+)
+
+// merge3 merges the changes from base to local and from base to remote line by line
+// like diff3. When the both sides change the same lines differently, the conflicted
+// region is rendered with git-style conflict markers and ok will be false.
+func merge3(base, local, remote string) (merged string, ok bool) {
+	b, l, r := splitLines(base), splitLines(local), splitLines(remote)
+	ml, mr := matchIndexes(b, l), matchIndexes(b, r)
+
+	ok = true
+	out := &strings.Builder{}
+	writeLines := func(lines []string) {
+		for _, line := range lines {
+			out.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				out.WriteString("\n")
+			}
+		}
+	}
+	i, j, k := 0, 0, 0
+	for i < len(b) || j < len(l) || k < len(r) {
+		// stable chunk: lines unchanged on both sides
+		n := 0
+		for i+n < len(b) && ml[i+n] == j+n && mr[i+n] == k+n {
+			n++
+		}
+		if n > 0 {
+			writeLines(b[i : i+n])
+			i, j, k = i+n, j+n, k+n
+			continue
+		}
+
+		// unstable chunk: find the next base line which is kept on both sides
+		nextI, nextJ, nextK := i, len(l), len(r)
+		for ; nextI < len(b); nextI++ {
+			if ml[nextI] >= 0 && mr[nextI] >= 0 {
+				nextJ, nextK = ml[nextI], mr[nextI]
+				break
+			}
+		}
+		chunkB, chunkL, chunkR := b[i:nextI], l[j:nextJ], r[k:nextK]
+		switch {
+		case equalLines(chunkL, chunkB):
+			writeLines(chunkR)
+		case equalLines(chunkR, chunkB), equalLines(chunkL, chunkR):
+			writeLines(chunkL)
+		default:
+			ok = false
+			out.WriteString(conflictMarkerLocal + "\n")
+			writeLines(chunkL)
+			out.WriteString(conflictMarkerSep + "\n")
+			writeLines(chunkR)
+			out.WriteString(conflictMarkerRemote + "\n")
+		}
+		i, j, k = nextI, nextJ, nextK
+	}
+	return out.String(), ok
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func hasConflictMarkers(content string) bool {
+	for _, line := range splitLines(content) {
+		line = strings.TrimRight(line, "\n")
+		if line == conflictMarkerLocal || line == conflictMarkerRemote {
+			return true
+		}
+	}
+	return false
+}
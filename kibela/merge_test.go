@@ -0,0 +1,132 @@
+package kibela
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	testCases := []struct {
+		name                string
+		base, local, remote string
+		expect              string
+		expectOK            bool
+	}{{
+		name:     "no changes",
+		base:     "a\nb\nc\n",
+		local:    "a\nb\nc\n",
+		remote:   "a\nb\nc\n",
+		expect:   "a\nb\nc\n",
+		expectOK: true,
+	}, {
+		name:     "local only",
+		base:     "a\nb\nc\n",
+		local:    "a\nB\nc\n",
+		remote:   "a\nb\nc\n",
+		expect:   "a\nB\nc\n",
+		expectOK: true,
+	}, {
+		name:     "remote only",
+		base:     "a\nb\nc\n",
+		local:    "a\nb\nc\n",
+		remote:   "a\nb\nc\nd\n",
+		expect:   "a\nb\nc\nd\n",
+		expectOK: true,
+	}, {
+		name:     "both sides change different lines",
+		base:     "a\nb\nc\nd\ne\n",
+		local:    "A\nb\nc\nd\ne\n",
+		remote:   "a\nb\nc\nd\nE\nf\n",
+		expect:   "A\nb\nc\nd\nE\nf\n",
+		expectOK: true,
+	}, {
+		name:     "both sides change same lines identically",
+		base:     "a\nb\nc\n",
+		local:    "a\nX\nc\n",
+		remote:   "a\nX\nc\n",
+		expect:   "a\nX\nc\n",
+		expectOK: true,
+	}, {
+		name:     "both sides delete",
+		base:     "a\nb\nc\n",
+		local:    "a\nc\n",
+		remote:   "a\nc\n",
+		expect:   "a\nc\n",
+		expectOK: true,
+	}, {
+		name:   "conflict",
+		base:   "a\nb\nc\n",
+		local:  "a\nlocal\nc\n",
+		remote: "a\nremote\nc\n",
+		expect: `a
+<<<<<<< local
+local
+=======
+remote
+>>>>>>> remote
+c
+`,
+		expectOK: false,
+	}, {
+		name:   "conflict on insertion at end",
+		base:   "a\n",
+		local:  "a\nlocal\n",
+		remote: "a\nremote\n",
+		expect: `a
+<<<<<<< local
+local
+=======
+remote
+>>>>>>> remote
+`,
+		expectOK: false,
+	}, {
+		name:     "japanese",
+		base:     "こんにちは\n世界\n",
+		local:    "こんばんは\n世界\n",
+		remote:   "こんにちは\n世界\nさようなら\n",
+		expect:   "こんばんは\n世界\nさようなら\n",
+		expectOK: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, ok := merge3(tc.base, tc.local, tc.remote)
+			if ok != tc.expectOK {
+				t.Errorf("ok = %t, expect: %t", ok, tc.expectOK)
+			}
+			if out != tc.expect {
+				t.Errorf("out:\n%s\nexpect:\n%s", out, tc.expect)
+			}
+		})
+	}
+}
+
+func TestMerge3_large(t *testing.T) {
+	var base, local, remote strings.Builder
+	for i := 0; i < 4000; i++ {
+		fmt.Fprintf(&base, "line %d\n", i)
+		fmt.Fprintf(&local, "local %d\n", i)
+		fmt.Fprintf(&remote, "remote %d\n", i)
+	}
+	// the rewritten regions larger than maxDiffTokens become one conflict
+	out, ok := merge3("head\n"+base.String(), "head\n"+local.String(), "head\n"+remote.String())
+	if ok {
+		t.Errorf("ok should be false")
+	}
+	expect := "head\n" + conflictMarkerLocal + "\n" + local.String() +
+		conflictMarkerSep + "\n" + remote.String() + conflictMarkerRemote + "\n"
+	if out != expect {
+		t.Errorf("unexpected merge result: %.100q", out)
+	}
+}
+
+func TestHasConflictMarkers(t *testing.T) {
+	if hasConflictMarkers("a\n<<<<<<<\nb\n") {
+		t.Errorf("incomplete marker should not be detected")
+	}
+	if !hasConflictMarkers("a\n<<<<<<< local\nb\n=======\nc\n>>>>>>> remote\n") {
+		t.Errorf("conflict markers should be detected")
+	}
+}
@@ -38,3 +38,47 @@ const createNoteMutation = `mutation ($input: CreateNoteInput!) {
     }
   }
 }`
+
+const deleteNoteMutation = `mutation($id: ID!) {
+  deleteNote(input: {id: $id}) {
+    note {
+      id
+    }
+  }
+}`
+
+const createCommentMutation = `mutation($commentableId: ID!, $content: String!) {
+  createComment(input: {commentableId: $commentableId, content: $content}) {
+    comment {
+      id
+      url
+    }
+  }
+}`
+
+const updateCommentMutation = `mutation($id: ID!, $content: String!) {
+  updateComment(input: {id: $id, content: $content}) {
+    comment {
+      id
+      url
+    }
+  }
+}`
+
+const deleteCommentMutation = `mutation($id: ID!) {
+  deleteComment(input: {id: $id}) {
+    comment {
+      id
+      url
+    }
+  }
+}`
+
+const uploadAttachmentMutation = `mutation($name: String!, $data: Blob!) {
+  uploadAttachment(input: {name: $name, data: $data, kind: GENERAL}) {
+    attachment {
+      id
+      path
+    }
+  }
+}`
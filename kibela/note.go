@@ -2,18 +2,15 @@ package kibela
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/konifar/kibelasync/client"
 	"golang.org/x/xerrors"
 )
 
@@ -29,6 +26,11 @@ type Note struct {
 	UpdatedAt   Time     `json:"updatedAt"`
 	PublishedAt Time     `json:"publishedAt"`
 	Summary     string   `json:"summary"`
+	Comments    Comments `json:"comments"`
+
+	// moved is set when the note is listed since its local file isn't in the
+	// directory of its folder anymore
+	moved bool
 }
 
 func (n *Note) toMD(dir string) *MD {
@@ -55,18 +57,10 @@ func (n *Note) toMD(dir string) *MD {
 }
 
 func (ki *Kibela) getNotesCount(ctx context.Context, folderID ID) (int, error) {
-	data, err := ki.cli.Do(ctx, &client.Payload{Query: totalCountQuery(folderID)})
+	res, err := ki.doTotalCount(ctx, &totalCountVariables{FolderID: folderID})
 	if err != nil {
 		return 0, xerrors.Errorf("failed to ki.getNotesCount: %w", err)
 	}
-	var res struct {
-		Notes struct {
-			TotalCount int `json:"totalCount"`
-		} `json:"notes"`
-	}
-	if err := json.Unmarshal(data, &res); err != nil {
-		return 0, xerrors.Errorf("failed to ki.getNotesCount: %w", err)
-	}
 	return res.Notes.TotalCount, nil
 }
 
@@ -98,20 +92,8 @@ func (ki *Kibela) listNoteIDs(ctx context.Context, folderID ID, limit int) ([]*N
 				take = rest
 			}
 			rest = rest - take
-			data, err := ki.cli.Do(ctx, &client.Payload{
-				Query: listNotePaginateQuery(take, folderID, nextCursor, limit > 0)})
+			res, err := ki.doListNotePaginate(ctx, newNotesVariables(take, folderID, nextCursor, limit > 0))
 			if err != nil {
-				return nil, xerrors.Errorf("failed to ki.getGroups: %w", err)
-			}
-			var res struct {
-				Notes struct {
-					Edges []struct {
-						Node   *Note  `json:"node"`
-						Cursor string `json:"cursor"`
-					} `json:"edges"`
-				} `json:"notes"`
-			}
-			if err := json.Unmarshal(data, &res); err != nil {
 				return nil, xerrors.Errorf("failed to ki.listNoteIDs: %w", err)
 			}
 			if len(res.Notes.Edges) > 0 {
@@ -123,19 +105,71 @@ func (ki *Kibela) listNoteIDs(ctx context.Context, folderID ID, limit int) ([]*N
 		}
 		return notes, nil
 	}
-	data, err := ki.cli.Do(ctx, &client.Payload{Query: listNoteQuery(num, folderID, limit > 0)})
+	res, err := ki.doListNote(ctx, newNotesVariables(num, folderID, "", limit > 0))
 	if err != nil {
 		return nil, xerrors.Errorf("failed to ki.listNoteIDs: %w", err)
 	}
-	var res struct {
-		Notes struct {
-			Nodes []*Note `json:"nodes"`
-		} `json:"notes"`
+	return res.Notes.Nodes, nil
+}
+
+// notes are listed page by page in incremental pulls, since only a few notes
+// are expected to be updated since the last pull.
+const incrementalPageLimit = 100
+
+// listUpdatedNoteIDs lists notes updated after the since in descending order of
+// contentUpdatedAt. It stops paging when it crosses the since.
+func (ki *Kibela) listUpdatedNoteIDs(ctx context.Context, folderID ID, since time.Time) ([]*Note, error) {
+	var (
+		notes      []*Note
+		nextCursor string
+	)
+	for {
+		res, err := ki.doListNotePaginate(ctx, newNotesVariables(incrementalPageLimit, folderID, nextCursor, true))
+		if err != nil {
+			return nil, xerrors.Errorf("failed to ki.listUpdatedNoteIDs: %w", err)
+		}
+		for _, e := range res.Notes.Edges {
+			if !e.Node.UpdatedAt.After(since) {
+				return notes, nil
+			}
+			notes = append(notes, e.Node)
+		}
+		if len(res.Notes.Edges) < incrementalPageLimit {
+			return notes, nil
+		}
+		nextCursor = res.Notes.Edges[len(res.Notes.Edges)-1].Cursor
 	}
-	if err := json.Unmarshal(data, &res); err != nil {
-		return nil, xerrors.Errorf("failed to ki.getNotesCount: %w", err)
+}
+
+// 100 (base) + 9 (id, updatedAt, folder, group and groups, cursor) * 1000 = 9100
+const locationPageLimit = 1000
+
+// listMovedOrUpdatedNoteIDs lists notes updated after the since, and notes moved to other
+// folders or groups in the folder layout. Since moving notes doesn't change the
+// contentUpdatedAt, every note is listed with its folders and groups, which are compared
+// with the paths of the local files.
+func (ki *Kibela) listMovedOrUpdatedNoteIDs(ctx context.Context, st *syncState, folderID ID, since time.Time) ([]*Note, error) {
+	var (
+		notes      []*Note
+		nextCursor string
+	)
+	for {
+		res, err := ki.doListNoteLocationPaginate(ctx, newNotesVariables(locationPageLimit, folderID, nextCursor, false))
+		if err != nil {
+			return nil, xerrors.Errorf("failed to ki.listMovedOrUpdatedNoteIDs: %w", err)
+		}
+		for _, e := range res.Notes.Edges {
+			n := e.Node
+			n.moved = st.movedRemotely(n)
+			if n.moved || n.UpdatedAt.After(since) {
+				notes = append(notes, n)
+			}
+		}
+		if len(res.Notes.Edges) < locationPageLimit {
+			return notes, nil
+		}
+		nextCursor = res.Notes.Edges[len(res.Notes.Edges)-1].Cursor
 	}
-	return res.Notes.Nodes, nil
 }
 
 // GetNote gets kibela note
@@ -146,22 +180,27 @@ func (ki *Kibela) GetNote(ctx context.Context, num int) (*Note, error) {
 
 // OK
 func (ki *Kibela) getNote(ctx context.Context, id ID) (*Note, error) {
-	data, err := ki.cli.Do(ctx, &client.Payload{Query: getNoteQuery(id)})
+	res, err := ki.doGetNote(ctx, &getNoteVariables{ID: id})
 	if err != nil {
 		return nil, xerrors.Errorf("failed to ki.getNote: %w", err)
 	}
-	var res struct {
-		Note *Note `json:"note"`
-	}
-	if err := json.Unmarshal(data, &res); err != nil {
-		return nil, xerrors.Errorf("failed to ki.getNote: %w", err)
-	}
 	res.Note.ID = id
 	return res.Note, nil
 }
 
-// PullNotes pulls notes from Kibela
-func (ki *Kibela) PullNotes(ctx context.Context, dir, folder string, limit int) error {
+// PullNotes pulls notes from Kibela. When the previous pull recorded the watermark, the
+// newest updatedAt of the notes, it lists only the notes updated after the watermark
+// unless rescan is true. Since the notes are ordered by contentUpdatedAt in that case,
+// notes only whose metadata (e.g. groups or folders) are changed may be missed in
+// incremental pulls. Use rescan to pick up them. In the folder layout, the notes moved
+// to other folders or groups are listed too, so that their files are moved. The notes are fetched by the jobs
+// number of workers concurrently. Unless the orphan is OrphanIgnore, every note is
+// listed and the action is taken for the local files of notes which don't exist on
+// Kibela anymore. It can't be combined with the folder nor the limit.
+func (ki *Kibela) PullNotes(ctx context.Context, dir, folder string, limit int, rescan bool, jobs int, orphan OrphanAction) (err error) {
+	if orphan != OrphanIgnore && (folder != "" || limit > 0) {
+		return xerrors.New("failed to PullNotes: orphaned files can't be detected with the folder or the limit")
+	}
 	var folderID ID
 	if folder != "" {
 		var err error
@@ -170,44 +209,162 @@ func (ki *Kibela) PullNotes(ctx context.Context, dir, folder string, limit int)
 			return xerrors.Errorf("failed to PullNotes: %w", err)
 		}
 	}
-	notes, err := ki.listNoteIDs(ctx, folderID, limit)
+	st, err := ki.syncState(dir)
 	if err != nil {
 		return xerrors.Errorf("failed to pullNotes: %w", err)
 	}
-	for _, n := range notes {
-		localT := time.Time{}
-		idNum, err := n.ID.Number()
-		if err != nil {
-			return xerrors.Errorf("failed to pullNotes: %w", err)
-		}
-		mdFilePath := filepath.Join(dir, fmt.Sprintf("%d.md", idNum))
-		_, err = os.Stat(mdFilePath)
-		if err == nil {
-			localMD, err := LoadMD(mdFilePath)
-			if err != nil {
-				return xerrors.Errorf("failed to pullNotes: %w", err)
-			}
-			localT = localMD.UpdatedAt
+	defer func() {
+		if e := st.save(); e != nil && err == nil {
+			err = xerrors.Errorf("failed to pullNotes: %w", e)
 		}
-		if n.UpdatedAt.After(localT) {
-			allNote, err := ki.getNote(ctx, n.ID)
-			if err != nil {
-				return xerrors.Errorf("failed to pullNotes: %w", err)
-			}
-			if err := allNote.toMD(dir).save(); err != nil {
-				return xerrors.Errorf("failed to pullNotes: %w", err)
-			}
+	}()
+	var notes []*Note
+	watermark := st.watermark(folderID)
+	if limit == 0 && !rescan && orphan == OrphanIgnore && !watermark.IsZero() {
+		if st.layout() == LayoutFolder {
+			notes, err = ki.listMovedOrUpdatedNoteIDs(ctx, st, folderID, watermark)
 		} else {
-			log.Printf("skip %q (not modfied)\n", mdFilePath)
+			notes, err = ki.listUpdatedNoteIDs(ctx, folderID, watermark)
+		}
+	} else {
+		notes, err = ki.listNoteIDs(ctx, folderID, limit)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to pullNotes: %w", err)
+	}
+	newest := watermark
+	for _, n := range notes {
+		if n.UpdatedAt.After(newest) {
+			newest = n.UpdatedAt.Time
 		}
 	}
+	if err := ki.pullUpdatedNotes(ctx, dir, st, notes, jobs); err != nil {
+		return xerrors.Errorf("failed to pullNotes: %w", err)
+	}
+	if err := ki.relinkNotes(ctx, st); err != nil {
+		return xerrors.Errorf("failed to pullNotes: %w", err)
+	}
+	if err := ki.handleOrphans(dir, st, notes, orphan); err != nil {
+		return xerrors.Errorf("failed to pullNotes: %w", err)
+	}
+	// The watermark is advanced only when all the notes are listed and pulled
+	if limit == 0 {
+		st.setWatermark(folderID, newest)
+	}
 	return nil
 }
 
+// pullUpdatedNotes fetches and saves the notes updated after the last synchronization
+// with the jobs number of workers
+func (ki *Kibela) pullUpdatedNotes(ctx context.Context, dir string, st *syncState, notes []*Note, jobs int) error {
+	return runJobs(ctx, len(notes), jobs, func(ctx context.Context, i int) (string, error) {
+		return ki.pullIfUpdated(ctx, dir, st, notes[i])
+	})
+}
+
+// runJobs runs the fn for 0 to n-1 with the jobs number of workers, and logs the
+// messages returned by the fn in order. When an error occurs, the rest are canceled
+// and the first error is returned. The error of the ctx is returned when it is canceled,
+// since the skipped jobs report no errors.
+func runJobs(ctx context.Context, n, jobs int, fn func(ctx context.Context, i int) (string, error)) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	parent := ctx
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var (
+		firstErr error
+		errOnce  sync.Once
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	logs := make([]chan string, n)
+	for i := range logs {
+		logs[i] = make(chan string, 1)
+	}
+	go func() {
+		sem := make(chan struct{}, jobs)
+		for i := 0; i < n; i++ {
+			sem <- struct{}{}
+			go func(i int) {
+				defer func() { <-sem }()
+				defer close(logs[i])
+				if ctx.Err() != nil {
+					return
+				}
+				msg, err := fn(ctx, i)
+				if err != nil {
+					fail(err)
+					return
+				}
+				if msg != "" {
+					logs[i] <- msg
+				}
+			}(i)
+		}
+	}()
+	for _, l := range logs {
+		if msg, ok := <-l; ok {
+			log.Print(msg)
+		}
+	}
+	if firstErr == nil {
+		return parent.Err()
+	}
+	return firstErr
+}
+
+func (ki *Kibela) pullIfUpdated(ctx context.Context, dir string, st *syncState, n *Note) (string, error) {
+	idNum, err := n.ID.Number()
+	if err != nil {
+		return "", xerrors.Errorf("failed to pullIfUpdated: %w", err)
+	}
+	mdFilePath := st.localPath(idNum)
+	localT, err := st.lastUpdatedAt(idNum, mdFilePath)
+	if err != nil {
+		return "", xerrors.Errorf("failed to pullIfUpdated: %w", err)
+	}
+	if !n.UpdatedAt.After(localT) && !n.moved {
+		moved, err := st.relocate(idNum, func(content string) error {
+			return ki.downloadAttachments(ctx, st, content)
+		})
+		if err != nil {
+			return "", xerrors.Errorf("failed to pullIfUpdated: %w", err)
+		}
+		if moved != "" {
+			return fmt.Sprintf("relocated to %q", moved), nil
+		}
+		return fmt.Sprintf("skip %q (not modfied)\n", mdFilePath), nil
+	}
+	allNote, err := ki.getNote(ctx, n.ID)
+	if err != nil {
+		return "", xerrors.Errorf("failed to pullIfUpdated: %w", err)
+	}
+	if err := ki.downloadAttachments(ctx, st, allNote.Content); err != nil {
+		return "", xerrors.Errorf("failed to pullIfUpdated: %w", err)
+	}
+	m, err := st.saveNote(allNote, "")
+	if err != nil {
+		return "", xerrors.Errorf("failed to pullIfUpdated: %w", err)
+	}
+	return fmt.Sprintf("saved to %q", m.filepath), nil
+}
+
 const pullBundleLimit = 100
 
-// PullFullNotes pull full notes from Kibela
-func (ki *Kibela) PullFullNotes(ctx context.Context, dir, folder string, limit int) error {
+// PullFullNotes pull full notes from Kibela. Unless the orphan is OrphanIgnore, the
+// action is taken for the local files of notes which don't exist on Kibela anymore
+// like PullNotes. It can't be combined with the folder nor the limit.
+func (ki *Kibela) PullFullNotes(ctx context.Context, dir, folder string, limit int, orphan OrphanAction) (err error) {
+	if orphan != OrphanIgnore && (folder != "" || limit > 0) {
+		return xerrors.New("failed to PullFullNotes: orphaned files can't be detected with the folder or the limit")
+	}
 	var folderID ID
 	if folder != "" {
 		var err error
@@ -216,6 +373,15 @@ func (ki *Kibela) PullFullNotes(ctx context.Context, dir, folder string, limit i
 			return xerrors.Errorf("failed to PullFullNotes: %w", err)
 		}
 	}
+	st, err := ki.syncState(dir)
+	if err != nil {
+		return xerrors.Errorf("failed to ki.pullFullNotes: %w", err)
+	}
+	defer func() {
+		if e := st.save(); e != nil && err == nil {
+			err = xerrors.Errorf("failed to ki.pullFullNotes: %w", e)
+		}
+	}()
 	num, err := ki.getNotesCount(ctx, folderID)
 	if err != nil {
 		return xerrors.Errorf("failed to ki.pullFullNotes: %w", err)
@@ -225,84 +391,81 @@ func (ki *Kibela) PullFullNotes(ctx context.Context, dir, folder string, limit i
 	}
 	nextCursor := ""
 	rest := num
+	notes := make([]*Note, 0, num)
 	for rest > 0 {
 		take := pullBundleLimit
 		if take > rest {
 			take = rest
 		}
 		rest = rest - take
-		data, err := ki.cli.Do(ctx, &client.Payload{
-			Query: listFullNotePaginateQuery(take, folderID, nextCursor, limit > 0)})
+		res, err := ki.doListFullNotePaginate(ctx, newNotesVariables(take, folderID, nextCursor, limit > 0))
 		if err != nil {
 			return xerrors.Errorf("failed to ki.pullFullNotes: %w", err)
 		}
-		var res struct {
-			Notes struct {
-				Edges []struct {
-					Node   *Note  `json:"node"`
-					Cursor string `json:"cursor"`
-				} `json:"edges"`
-			} `json:"notes"`
-		}
-		if err := json.Unmarshal(data, &res); err != nil {
-			return xerrors.Errorf("failed to ki.pullFullNotes: %w", err)
-		}
 		if len(res.Notes.Edges) > 0 {
 			nextCursor = res.Notes.Edges[len(res.Notes.Edges)-1].Cursor
 		}
 		for _, e := range res.Notes.Edges {
-			if err := e.Node.toMD(dir).save(); err != nil {
+			if err := ki.downloadAttachments(ctx, st, e.Node.Content); err != nil {
+				return xerrors.Errorf("failed to ki.pullFullNotes: %w", err)
+			}
+			m, err := st.saveNote(e.Node, "")
+			if err != nil {
 				return xerrors.Errorf("failed to pullFullNotes while saving md: %w", err)
 			}
+			log.Printf("saved to %q", m.filepath)
+			notes = append(notes, e.Node)
 		}
 	}
+	if err := ki.relinkNotes(ctx, st); err != nil {
+		return xerrors.Errorf("failed to ki.pullFullNotes: %w", err)
+	}
+	if err := ki.handleOrphans(dir, st, notes, orphan); err != nil {
+		return xerrors.Errorf("failed to ki.pullFullNotes: %w", err)
+	}
 	return nil
 }
 
-// PullNote pulls a single note
+// PullNote pulls a single note specified by the Markdown file, the number, the ID or
+// the URL of the note
 func (ki *Kibela) PullNote(ctx context.Context, dir, arg string) error {
-	var (
-		id     ID
-		isFile bool
-	)
-	num, err := strconv.Atoi(arg)
-	if err == nil {
-		id = newID(idTypeBlog, num)
-	} else {
-		fname := filepath.Base(arg)
-		stuffs := strings.Split(fname, ".")
-		if len(stuffs) != 2 {
-			return xerrors.Errorf("failed to pullNote: invalid filename (must be a number or [0-9]+.md): %s", fname)
-		}
-		if stuffs[1] != "md" {
-			return xerrors.Errorf("failed to pullNote: invalid filename (must be a number or [0-9]+.md): %s", fname)
-		}
-		num, err := strconv.Atoi(stuffs[0])
-		if err != nil {
-			return xerrors.Errorf("failed to pullNote: invalid filename (must be a number or [0-9]+.md): %s", fname)
-		}
-		isFile = true
-		id = newID(idTypeBlog, num)
+	id, fpath, err := ki.resolveNote(arg)
+	if err != nil {
+		return xerrors.Errorf("failed to pullNote: %w", err)
 	}
+	return ki.pullNote(ctx, dir, id, fpath)
+}
+
+// pullNote fetches the note and saves it to fpath. The path decided by the layout of
+// the dir is used when the fpath is empty.
+func (ki *Kibela) pullNote(ctx context.Context, dir string, id ID, fpath string) error {
 	n, err := ki.getNote(ctx, id)
 	if err != nil {
 		return xerrors.Errorf("failed to pullNote while getNote(%s): %w", id, err)
 	}
-	m := n.toMD(dir)
-	if isFile {
-		m.filepath = arg
+	if fpath != "" {
+		dir = findSyncDir(fpath)
 	}
-	if err := m.save(); err != nil {
-		return xerrors.Errorf("failed to pullNote while m.save: %w", err)
+	st, err := ki.syncState(dir)
+	if err != nil {
+		return xerrors.Errorf("failed to pullNote: %w", err)
 	}
-	return nil
-}
-
-func (ki *Kibela) pushNote(ctx context.Context, n *Note) error {
-	remoteNote, err := ki.getNote(ctx, n.ID)
+	if num, err := id.Number(); err == nil && filepath.Clean(fpath) == st.localPath(num) {
+		// the tracked file is renamed by the title or moved by the folder
+		fpath = ""
+	}
+	if err := ki.downloadAttachments(ctx, st, n.Content); err != nil {
+		return xerrors.Errorf("failed to pullNote: %w", err)
+	}
+	m, err := st.saveNote(n, fpath)
 	if err != nil {
-		return xerrors.Errorf("failed to pushNote: %w", err)
+		return xerrors.Errorf("failed to pullNote while saving md: %w", err)
 	}
+	log.Printf("saved to %q", m.filepath)
+	return st.save()
+}
+
+func (ki *Kibela) pushNote(ctx context.Context, n, remoteNote *Note) error {
 	groupMap := make(map[string]ID)
 	for _, g := range remoteNote.Groups {
 		groupMap[g.Name] = g.ID
@@ -330,30 +493,15 @@ func (ki *Kibela) pushNote(ctx context.Context, n *Note) error {
 		n.UpdatedAt = remoteNote.UpdatedAt
 		return nil
 	}
-	data, err := ki.cli.Do(ctx, &client.Payload{
-		Query: updateNoteMutation,
-		Variables: struct {
-			ID       ID         `json:"id"`
-			BaseNote *noteInput `json:"baseNote"`
-			NewNote  *noteInput `json:"newNote"`
-		}{
-			ID:       n.ID,
-			BaseNote: baseNote,
-			NewNote:  newNote,
-		},
+	res, err := ki.doUpdateNote(ctx, &updateNoteVariables{
+		ID:       n.ID,
+		BaseNote: baseNote,
+		NewNote:  newNote,
 	})
 	if err != nil {
 		return xerrors.Errorf("failed to pushNote while accessing remote: %w", err)
 	}
-	var res struct {
-		UpdateNote struct {
-			Note *Note `json:"note"`
-		} `json:"updateNote"`
-	}
-	if err := json.Unmarshal(data, &res); err != nil {
-		return xerrors.Errorf("failed to ki.pushNote while unmarshaling response: %w", err)
-	}
-	if res.UpdateNote.Note == nil {
+	if res.UpdateNote == nil || res.UpdateNote.Note == nil {
 		return xerrors.New("failed to update kibela on any reason. null updateNote was returned")
 	}
 	n.Author.Account = res.UpdateNote.Note.Author.Account
@@ -4,9 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
+
+	"github.com/konifar/kibelasync/client"
 )
 
 func TestNoteUnmarshalJSON(t *testing.T) {
@@ -90,3 +96,120 @@ func TestKibela_getNotesCount(t *testing.T) {
 		t.Errorf("out: %d, expect: %d", cnt, expect)
 	}
 }
+
+func TestKibela_listUpdatedNoteIDs(t *testing.T) {
+	td := &testDoer{responseTexts: []string{`{
+  "data": {
+    "notes": {
+      "edges": [{
+        "node": {"id": "QmxvZy8zNzA", "updatedAt": "2019-06-23T17:40:09.969+09:00"},
+        "cursor": "MQ"
+      }, {
+        "node": {"id": "QmxvZy8zNzE", "updatedAt": "2019-06-23T17:39:47.433+09:00"},
+        "cursor": "Mg"
+      }, {
+        "node": {"id": "QmxvZy8zNjg", "updatedAt": "2019-06-23T17:39:41.751+09:00"},
+        "cursor": "Mw"
+      }]
+    }
+  }
+}`}}
+	ki := testKibela(client.Test(td))
+	watermark := mustTime("2019-06-23T17:39:41.751+09:00")
+	notes, err := ki.listUpdatedNoteIDs(context.Background(), "", watermark.Time)
+	if err != nil {
+		t.Errorf("error should be nil, but: %s", err)
+	}
+	if len(notes) != 2 {
+		t.Errorf("len(notes) = %d, expect: 2", len(notes))
+	}
+	if td.cursor != 1 {
+		t.Errorf("it should stop paging after crossing the watermark, but requested %d times", td.cursor)
+	}
+}
+
+func TestKibela_pullUpdatedNotes(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "kibelasync-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var notes []*Note
+	for num := 1; num <= 10; num++ {
+		notes = append(notes, &Note{
+			ID:        newID(idTypeBlog, num),
+			UpdatedAt: mustTime("2019-06-23T17:39:41.751+09:00"),
+		})
+	}
+	failed := string(newID(idTypeBlog, 7))
+	var mu sync.Mutex
+	requested := 0
+	ki := testKibela(client.Test(doerFunc(func(body string) string {
+		mu.Lock()
+		requested++
+		mu.Unlock()
+		if strings.Contains(body, failed) {
+			return `{"errors": [{"message": "error!"}]}`
+		}
+		return `{
+  "data": {
+    "note": {
+      "title": "title",
+      "content": "content",
+      "coediting": true,
+      "groups": [{"name": "Home", "id": "R3JvdXAvMQ"}],
+      "updatedAt": "2019-06-23T17:39:41.751+09:00"
+    }
+  }
+}`
+	})))
+	st, err := ki.syncState(tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ki.pullUpdatedNotes(context.Background(), tmpdir, st, notes[:5], 3); err != nil {
+		t.Errorf("error should be nil, but: %s", err)
+	}
+	for num := 1; num <= 5; num++ {
+		if _, err := os.Stat(filepath.Join(tmpdir, fmt.Sprintf("%d.md", num))); err != nil {
+			t.Errorf("%d.md should be pulled, but: %s", num, err)
+		}
+		if st.get(num) == nil {
+			t.Errorf("state of %d should be recorded", num)
+		}
+	}
+
+	err = ki.pullUpdatedNotes(context.Background(), tmpdir, st, notes, 3)
+	if err == nil || !strings.Contains(err.Error(), "error!") {
+		t.Errorf("error should be occurred, but: %v", err)
+	}
+	// 5 notes are skipped as not modified, so only the rest are requested
+	if requested > 10 {
+		t.Errorf("requested = %d, expect <= 10", requested)
+	}
+}
+
+func TestRunJobs_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		mu  sync.Mutex
+		ran []int
+	)
+	err := runJobs(ctx, 10, 1, func(ctx context.Context, i int) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, i)
+		if i == 2 {
+			cancel()
+		}
+		return "", nil
+	})
+	if err != context.Canceled {
+		t.Errorf("error should be context.Canceled, but: %v", err)
+	}
+	if len(ran) == 10 {
+		t.Error("the rest of the jobs should be skipped")
+	}
+}
@@ -0,0 +1,563 @@
+// Code generated by kibelagen. DO NOT EDIT.
+
+package kibela
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/konifar/kibelasync/client"
+)
+
+type totalCountVariables struct {
+	FolderID ID `json:"folderId,omitempty"`
+}
+
+type totalCountData struct {
+	Notes *totalCountNotes `json:"notes"`
+}
+
+type totalCountNotes struct {
+	TotalCount int `json:"totalCount"`
+}
+
+// doTotalCount sends totalCountQuery
+func (ki *Kibela) doTotalCount(ctx context.Context, vars *totalCountVariables) (*totalCountData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     totalCountQuery,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res totalCountData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type getNoteVariables struct {
+	ID ID `json:"id"`
+}
+
+type getNoteData struct {
+	Note *Note `json:"note"`
+}
+
+// doGetNote sends getNoteQuery
+func (ki *Kibela) doGetNote(ctx context.Context, vars *getNoteVariables) (*getNoteData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     getNoteQuery,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res getNoteData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type listNoteData struct {
+	Notes *listNoteNotes `json:"notes"`
+}
+
+type listNoteNotes struct {
+	Nodes []*Note `json:"nodes"`
+}
+
+// doListNote sends listNoteQuery
+func (ki *Kibela) doListNote(ctx context.Context, vars *notesVariables) (*listNoteData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     listNoteQuery,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res listNoteData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type listNotePaginateData struct {
+	Notes *listNotePaginateNotes `json:"notes"`
+}
+
+type listNotePaginateNotes struct {
+	Edges []*listNotePaginateNotesEdges `json:"edges"`
+}
+
+type listNotePaginateNotesEdges struct {
+	Node   *Note  `json:"node"`
+	Cursor string `json:"cursor"`
+}
+
+// doListNotePaginate sends listNotePaginateQuery
+func (ki *Kibela) doListNotePaginate(ctx context.Context, vars *notesVariables) (*listNotePaginateData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     listNotePaginateQuery,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res listNotePaginateData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type listNoteLocationPaginateData struct {
+	Notes *listNoteLocationPaginateNotes `json:"notes"`
+}
+
+type listNoteLocationPaginateNotes struct {
+	Edges []*listNoteLocationPaginateNotesEdges `json:"edges"`
+}
+
+type listNoteLocationPaginateNotesEdges struct {
+	Node   *Note  `json:"node"`
+	Cursor string `json:"cursor"`
+}
+
+// doListNoteLocationPaginate sends listNoteLocationPaginateQuery
+func (ki *Kibela) doListNoteLocationPaginate(ctx context.Context, vars *notesVariables) (*listNoteLocationPaginateData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     listNoteLocationPaginateQuery,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res listNoteLocationPaginateData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type listFullNotePaginateData struct {
+	Notes *listFullNotePaginateNotes `json:"notes"`
+}
+
+type listFullNotePaginateNotes struct {
+	Edges []*listFullNotePaginateNotesEdges `json:"edges"`
+}
+
+type listFullNotePaginateNotesEdges struct {
+	Node   *Note  `json:"node"`
+	Cursor string `json:"cursor"`
+}
+
+// doListFullNotePaginate sends listFullNotePaginateQuery
+func (ki *Kibela) doListFullNotePaginate(ctx context.Context, vars *notesVariables) (*listFullNotePaginateData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     listFullNotePaginateQuery,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res listFullNotePaginateData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type totalGroupCountData struct {
+	Groups *totalGroupCountGroups `json:"groups"`
+}
+
+type totalGroupCountGroups struct {
+	TotalCount int `json:"totalCount"`
+}
+
+// doTotalGroupCount sends totalGroupCountQuery
+func (ki *Kibela) doTotalGroupCount(ctx context.Context) (*totalGroupCountData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query: totalGroupCountQuery,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res totalGroupCountData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type listGroupVariables struct {
+	First int `json:"first"`
+}
+
+type listGroupData struct {
+	Groups *listGroupGroups `json:"groups"`
+}
+
+type listGroupGroups struct {
+	Nodes []*Group `json:"nodes"`
+}
+
+// doListGroup sends listGroupQuery
+func (ki *Kibela) doListGroup(ctx context.Context, vars *listGroupVariables) (*listGroupData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     listGroupQuery,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res listGroupData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type totalFolderCountData struct {
+	Folders *totalFolderCountFolders `json:"folders"`
+}
+
+type totalFolderCountFolders struct {
+	TotalCount int `json:"totalCount"`
+}
+
+// doTotalFolderCount sends totalFolderCountQuery
+func (ki *Kibela) doTotalFolderCount(ctx context.Context) (*totalFolderCountData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query: totalFolderCountQuery,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res totalFolderCountData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type listFolderVariables struct {
+	First int `json:"first"`
+}
+
+type listFolderData struct {
+	Folders *listFolderFolders `json:"folders"`
+}
+
+type listFolderFolders struct {
+	Nodes []*Folder `json:"nodes"`
+}
+
+// doListFolder sends listFolderQuery
+func (ki *Kibela) doListFolder(ctx context.Context, vars *listFolderVariables) (*listFolderData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     listFolderQuery,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res listFolderData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type listNoteCommentStatsData struct {
+	Notes *listNoteCommentStatsNotes `json:"notes"`
+}
+
+type listNoteCommentStatsNotes struct {
+	PageInfo *listNoteCommentStatsNotesPageInfo `json:"pageInfo"`
+	Nodes    []*Note                            `json:"nodes"`
+}
+
+type listNoteCommentStatsNotesPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+// doListNoteCommentStats sends listNoteCommentStatsQuery
+func (ki *Kibela) doListNoteCommentStats(ctx context.Context, vars *notesVariables) (*listNoteCommentStatsData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     listNoteCommentStatsQuery,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res listNoteCommentStatsData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type listNoteCommentsVariables struct {
+	ID    ID     `json:"id"`
+	First int    `json:"first"`
+	After string `json:"after,omitempty"`
+}
+
+type listNoteCommentsData struct {
+	Note *Note `json:"note"`
+}
+
+// doListNoteComments sends listNoteCommentsQuery
+func (ki *Kibela) doListNoteComments(ctx context.Context, vars *listNoteCommentsVariables) (*listNoteCommentsData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     listNoteCommentsQuery,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res listNoteCommentsData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type getCommentVariables struct {
+	ID ID `json:"id"`
+}
+
+type getCommentData struct {
+	Comment *Comment `json:"comment"`
+}
+
+// doGetComment sends getCommentQuery
+func (ki *Kibela) doGetComment(ctx context.Context, vars *getCommentVariables) (*getCommentData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     getCommentQuery,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res getCommentData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type updateNoteVariables struct {
+	ID       ID         `json:"id"`
+	BaseNote *noteInput `json:"baseNote"`
+	NewNote  *noteInput `json:"newNote"`
+}
+
+type updateNoteData struct {
+	UpdateNote *updateNoteUpdateNote `json:"updateNote"`
+}
+
+type updateNoteUpdateNote struct {
+	Note *Note `json:"note"`
+}
+
+// doUpdateNote sends updateNoteMutation
+func (ki *Kibela) doUpdateNote(ctx context.Context, vars *updateNoteVariables) (*updateNoteData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:      updateNoteMutation,
+		Variables:  vars,
+		Idempotent: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res updateNoteData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type createNoteVariables struct {
+	Input *noteInput `json:"input"`
+}
+
+type createNoteData struct {
+	CreateNote *createNoteCreateNote `json:"createNote"`
+}
+
+type createNoteCreateNote struct {
+	Note *Note `json:"note"`
+}
+
+// doCreateNote sends createNoteMutation
+func (ki *Kibela) doCreateNote(ctx context.Context, vars *createNoteVariables) (*createNoteData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     createNoteMutation,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res createNoteData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type deleteNoteVariables struct {
+	ID ID `json:"id"`
+}
+
+type deleteNoteData struct {
+	DeleteNote *deleteNoteDeleteNote `json:"deleteNote"`
+}
+
+type deleteNoteDeleteNote struct {
+	Note *Note `json:"note"`
+}
+
+// doDeleteNote sends deleteNoteMutation
+func (ki *Kibela) doDeleteNote(ctx context.Context, vars *deleteNoteVariables) (*deleteNoteData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     deleteNoteMutation,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res deleteNoteData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type createCommentVariables struct {
+	CommentableID ID     `json:"commentableId"`
+	Content       string `json:"content"`
+}
+
+type createCommentData struct {
+	CreateComment *createCommentCreateComment `json:"createComment"`
+}
+
+type createCommentCreateComment struct {
+	Comment *Comment `json:"comment"`
+}
+
+// doCreateComment sends createCommentMutation
+func (ki *Kibela) doCreateComment(ctx context.Context, vars *createCommentVariables) (*createCommentData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     createCommentMutation,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res createCommentData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type updateCommentVariables struct {
+	ID      ID     `json:"id"`
+	Content string `json:"content"`
+}
+
+type updateCommentData struct {
+	UpdateComment *updateCommentUpdateComment `json:"updateComment"`
+}
+
+type updateCommentUpdateComment struct {
+	Comment *Comment `json:"comment"`
+}
+
+// doUpdateComment sends updateCommentMutation
+func (ki *Kibela) doUpdateComment(ctx context.Context, vars *updateCommentVariables) (*updateCommentData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:      updateCommentMutation,
+		Variables:  vars,
+		Idempotent: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res updateCommentData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type deleteCommentVariables struct {
+	ID ID `json:"id"`
+}
+
+type deleteCommentData struct {
+	DeleteComment *deleteCommentDeleteComment `json:"deleteComment"`
+}
+
+type deleteCommentDeleteComment struct {
+	Comment *Comment `json:"comment"`
+}
+
+// doDeleteComment sends deleteCommentMutation
+func (ki *Kibela) doDeleteComment(ctx context.Context, vars *deleteCommentVariables) (*deleteCommentData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     deleteCommentMutation,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res deleteCommentData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type uploadAttachmentVariables struct {
+	Name string `json:"name"`
+	Data string `json:"data"`
+}
+
+type uploadAttachmentData struct {
+	UploadAttachment *uploadAttachmentUploadAttachment `json:"uploadAttachment"`
+}
+
+type uploadAttachmentUploadAttachment struct {
+	Attachment *uploadAttachmentUploadAttachmentAttachment `json:"attachment"`
+}
+
+type uploadAttachmentUploadAttachmentAttachment struct {
+	ID   ID     `json:"id"`
+	Path string `json:"path"`
+}
+
+// doUploadAttachment sends uploadAttachmentMutation
+func (ki *Kibela) doUploadAttachment(ctx context.Context, vars *uploadAttachmentVariables) (*uploadAttachmentData, error) {
+	data, err := ki.cli.Do(ctx, &client.Payload{
+		Query:     uploadAttachmentMutation,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res uploadAttachmentData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
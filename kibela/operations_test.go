@@ -0,0 +1,29 @@
+package kibela
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/konifar/kibelasync/internal/kibelagen"
+)
+
+// TestOperations validates queries and mutations against schema.graphql and checks
+// that operations_gen.go is up to date
+func TestOperations(t *testing.T) {
+	c, err := kibelagen.LoadConfig("kibelagen.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := c.Generate()
+	if err != nil {
+		t.Fatalf("invalid operations: %s", err)
+	}
+	current, err := ioutil.ReadFile(c.OutputPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, current) {
+		t.Errorf("%s is out of date. run `go generate ./...`", c.OutputPath())
+	}
+}
@@ -0,0 +1,82 @@
+package kibela
+
+import (
+	"fmt"
+	"log"
+
+	"golang.org/x/xerrors"
+)
+
+// OrphanAction is the action taken by PullNotes for the local files of notes which
+// are deleted or made inaccessible on Kibela
+type OrphanAction string
+
+// OrphanActions
+const (
+	// OrphanIgnore doesn't look for orphaned files
+	OrphanIgnore OrphanAction = ""
+	// OrphanReport logs orphaned files
+	OrphanReport OrphanAction = "report"
+	// OrphanTrash moves orphaned files into the ".trash" directory
+	OrphanTrash OrphanAction = "trash"
+	// OrphanDelete removes orphaned files. Files modified locally since the last
+	// synchronization are moved into the ".trash" directory instead.
+	OrphanDelete OrphanAction = "delete"
+)
+
+// ParseOrphanAction parses the action name
+func ParseOrphanAction(s string) (OrphanAction, error) {
+	switch a := OrphanAction(s); a {
+	case OrphanIgnore, OrphanReport, OrphanTrash, OrphanDelete:
+		return a, nil
+	}
+	return OrphanIgnore, fmt.Errorf("invalid orphan action (must be report, trash or delete): %s", s)
+}
+
+// handleOrphans takes the action for the Markdown files in the dir whose notes are
+// not in the remoteNotes, which must be the all notes of the team.
+func (ki *Kibela) handleOrphans(dir string, st *syncState, remoteNotes []*Note, action OrphanAction) error {
+	if action == OrphanIgnore {
+		return nil
+	}
+	remotes := make(map[int]bool, len(remoteNotes))
+	for _, n := range remoteNotes {
+		num, err := n.ID.Number()
+		if err != nil {
+			return xerrors.Errorf("failed to handleOrphans: %w", err)
+		}
+		remotes[num] = true
+	}
+	files, err := st.localFiles()
+	if err != nil {
+		return xerrors.Errorf("failed to handleOrphans: %w", err)
+	}
+	for _, fpath := range files {
+		num, err := noteNumberOf(fpath)
+		if err != nil || remotes[num] {
+			// unpublished files are not orphans
+			continue
+		}
+		switch action {
+		case OrphanReport:
+			log.Printf("%q was deleted remotely", fpath)
+			continue
+		case OrphanTrash:
+			err = removeLocalNote(dir, num, fpath, true)
+		case OrphanDelete:
+			var modified bool
+			modified, err = st.modifiedLocally(num, fpath)
+			if err == nil {
+				if modified {
+					log.Printf("%q was modified locally", fpath)
+				}
+				err = removeLocalNote(dir, num, fpath, modified)
+			}
+		}
+		if err != nil {
+			return xerrors.Errorf("failed to handleOrphans: %w", err)
+		}
+		st.forget(num)
+	}
+	return nil
+}
@@ -1,25 +1,17 @@
 package kibela
 
-import (
-	"fmt"
-	"strings"
-)
-
-func totalCountQuery(folderID ID) string {
-	query := ""
-	if !folderID.Empty() {
-		query = fmt.Sprintf(`(folderId: "%s")`, folderID.Raw())
-	}
-	return fmt.Sprintf(`{
-  notes%s {
+// Queries and mutations are validated against schema.graphql and typed operations
+// for them are generated into operations_gen.go.
+//go:generate go run ../internal/cmd/kibelagen -config kibelagen.yaml
+
+const totalCountQuery = `query($folderId: ID) {
+  notes(folderId: $folderId) {
     totalCount
   }
-}`, query)
-}
+}`
 
-func getNoteQuery(id ID) string {
-	return fmt.Sprintf(`{
-  note(id: "%s") {
+const getNoteQuery = `query($id: ID!) {
+  note(id: $id) {
     title
     content
     coediting
@@ -44,41 +36,43 @@ func getNoteQuery(id ID) string {
     publishedAt
     summary: contentSummaryHtml
   }
-}`, string(id))
-}
+}`
 
-func buildNotesArg(num int, folderID ID, cursor string, hasLimit bool) string {
-	var buf = &strings.Builder{}
+type noteOrder struct {
+	Field     string `json:"field"`
+	Direction string `json:"direction"`
+}
 
-	fmt.Fprintf(buf, "first: %d", num)
-	if cursor != "" {
-		// cursor is base64 encoded number. ex. "Nw" = 7
-		fmt.Fprintf(buf, ", after: %s", cursor)
-	}
-	if !folderID.Empty() {
-		fmt.Fprintf(buf, `, folderId: "%s"`, folderID.Raw())
-	}
+type notesVariables struct {
+	First int `json:"first"`
+	// After is a cursor, which is base64 encoded number. ex. "Nw" = 7
+	After    string     `json:"after,omitempty"`
+	FolderID ID         `json:"folderId,omitempty"`
+	OrderBy  *noteOrder `json:"orderBy"`
+}
 
+// ex. `{"first": 10, "after": "Nw", "orderBy": {"field": "PUBLISHED_AT", "direction": "DESC"}}`
+func newNotesVariables(num int, folderID ID, cursor string, hasLimit bool) *notesVariables {
 	ordering := "PUBLISHED_AT"
 	if hasLimit {
 		ordering = "CONTENT_UPDATED_AT"
 	}
-	fmt.Fprintf(buf, ", orderBy: {field: %s, direction: DESC}", ordering)
-
-	// ex. `first: 10, cursor: "Nw", orderBy: {field: PUBLISHED_AT, direction: DESC}`
-	return buf.String()
+	return &notesVariables{
+		First:    num,
+		After:    cursor,
+		FolderID: folderID,
+		OrderBy:  &noteOrder{Field: ordering, Direction: "DESC"},
+	}
 }
 
-func listNoteQuery(num int, folderID ID, hasLimit bool) string {
-	return fmt.Sprintf(`{
-  notes(%s) {
+const listNoteQuery = `query($first: Int!, $after: String, $folderId: ID, $orderBy: NoteOrder) {
+  notes(first: $first, after: $after, folderId: $folderId, orderBy: $orderBy) {
     nodes {
       id
       updatedAt
     }
   }
-}`, buildNotesArg(num, folderID, "", hasLimit))
-}
+}`
 
 /*
 	{
@@ -111,9 +105,8 @@ func listNoteQuery(num int, folderID ID, hasLimit bool) string {
 	  }
 	}
 */
-func listNotePaginateQuery(num int, folderID ID, cursor string, hasLimit bool) string {
-	return fmt.Sprintf(`{
-  notes(%s){
+const listNotePaginateQuery = `query($first: Int!, $after: String, $folderId: ID, $orderBy: NoteOrder) {
+  notes(first: $first, after: $after, folderId: $folderId, orderBy: $orderBy) {
     edges {
       node {
         id
@@ -122,23 +115,50 @@ func listNotePaginateQuery(num int, folderID ID, cursor string, hasLimit bool) s
       cursor
     }
   }
-}`, buildNotesArg(num, folderID, cursor, hasLimit))
-}
+}`
+
+// listNoteLocationPaginateQuery lists notes with their folders and groups, which
+// decide the paths of the local files in the folder layout
+const listNoteLocationPaginateQuery = `query($first: Int!, $after: String, $folderId: ID, $orderBy: NoteOrder) {
+  notes(first: $first, after: $after, folderId: $folderId, orderBy: $orderBy) {
+    edges {
+      node {
+        id
+        updatedAt
+        folders(first: 1) {
+          nodes {
+            fullName
+            group {
+              name
+            }
+          }
+        }
+        groups {
+          name
+        }
+      }
+      cursor
+    }
+  }
+}`
 
-func listFullNotePaginateQuery(num int, folderID ID, cursor string, hasLimit bool) string {
-	return fmt.Sprintf(`{
-  notes(%s){
+const listFullNotePaginateQuery = `query($first: Int!, $after: String, $folderId: ID, $orderBy: NoteOrder) {
+  notes(first: $first, after: $after, folderId: $folderId, orderBy: $orderBy) {
     edges {
       node {
         id
         title
         content
         coediting
-        folders {
-          after
-          before
-          first
-          last
+        folders(first: 1) {
+          nodes {
+            id
+            fullName
+            group {
+              id
+              name
+            }
+          }
         }
         groups {
           name
@@ -152,8 +172,7 @@ func listFullNotePaginateQuery(num int, folderID ID, cursor string, hasLimit boo
       cursor
     }
   }
-}`, buildNotesArg(num, folderID, cursor, hasLimit))
-}
+}`
 
 const totalGroupCountQuery = `{
   groups {
@@ -161,16 +180,14 @@ const totalGroupCountQuery = `{
   }
 }`
 
-func listGroupQuery(num int) string {
-	return fmt.Sprintf(`{
-  groups(first: %d) {
+const listGroupQuery = `query($first: Int!) {
+  groups(first: $first) {
     nodes {
       id
       name
     }
   }
-}`, num)
-}
+}`
 
 const totalFolderCountQuery = `{
   folders {
@@ -178,20 +195,58 @@ const totalFolderCountQuery = `{
   }
 }`
 
-func listFolderQuery(num int) string {
-	return fmt.Sprintf(`{
-  folders(first: %d) {
+const listFolderQuery = `query($first: Int!) {
+  folders(first: $first) {
     nodes {
       id
       fullName
     }
   }
-}`, num)
-}
+}`
+
+// listNoteCommentStatsQuery lists the number of comments and the latest comment of
+// notes to decide which notes' comments are refreshed
+const listNoteCommentStatsQuery = `query($first: Int!, $after: String, $folderId: ID, $orderBy: NoteOrder) {
+  notes(first: $first, after: $after, folderId: $folderId, orderBy: $orderBy) {
+    pageInfo {
+      hasNextPage
+      endCursor
+    }
+    nodes {
+      id
+      comments(last: 1) {
+        totalCount
+        nodes {
+          publishedAt
+          updatedAt
+        }
+      }
+    }
+  }
+}`
 
-func getCommentQuery(id ID) string {
-	return fmt.Sprintf(`{
-  comment(id: "%s") {
+const listNoteCommentsQuery = `query($id: ID!, $first: Int!, $after: String) {
+  note(id: $id) {
+    comments(first: $first, after: $after) {
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+      nodes {
+        id
+        author {
+          account
+        }
+        content
+        publishedAt
+        updatedAt
+      }
+    }
+  }
+}`
+
+const getCommentQuery = `query($id: ID!) {
+  comment(id: $id) {
     author {
       account
     }
@@ -199,5 +254,4 @@ func getCommentQuery(id ID) string {
     publishedAt
     summary: contentSummaryHtml
   }
-}`, string(id))
-}
+}`
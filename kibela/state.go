@@ -0,0 +1,342 @@
+package kibela
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const stateFile = "state.json"
+
+// syncState is the record of the last synchronization of each note in a sync
+// directory. It is stored as ".kibelasync/state.json" in the directory and used to
+// decide freshness of the notes instead of mtimes of the files, which are easily
+// changed by editors, `git checkout`, `cp` and so on.
+type syncState struct {
+	Notes map[int]*noteState `json:"notes"`
+	// Watermarks are the newest updatedAt of the notes seen by the last pull per folder ID.
+	// The empty key is for the whole team.
+	Watermarks map[string]Time `json:"watermarks,omitempty"`
+	// Layout is the layout of the Markdown files in the directory
+	Layout Layout `json:"layout,omitempty"`
+	// Filename is the filename template. The empty template means the default of
+	// the layout.
+	Filename FilenameTemplate `json:"filename,omitempty"`
+	// Attachments is whether pull downloads the attachments referenced by notes
+	Attachments bool `json:"attachments,omitempty"`
+	// Links is whether pull rewrites the links to notes into the relative paths
+	Links bool `json:"links,omitempty"`
+	// Uploads are the paths of the attachments uploaded from local files by the SHA-256
+	// hashes of the files
+	Uploads map[string]string `json:"uploads,omitempty"`
+
+	dir  string
+	team string
+	mu   sync.Mutex
+	// placeMu serializes deciding paths and writing files of notes so that notes
+	// with the same slug don't take the same path
+	placeMu sync.Mutex
+}
+
+type noteState struct {
+	// Path is the file path relative to the sync directory
+	Path string `json:"path"`
+	// UpdatedAt is the updatedAt of the remote note at the last synchronization
+	UpdatedAt Time `json:"updatedAt"`
+	// Hash is the content hash of the Markdown at the last synchronization
+	Hash string `json:"hash"`
+	// Comments is the state of the comments pulled into the sidecar file
+	Comments *commentsState `json:"comments,omitempty"`
+	// AttachmentURLs are the URLs of the attachments rewritten into the local paths in
+	// the file by their numbers, which are restored on push
+	AttachmentURLs map[int]string `json:"attachmentURLs,omitempty"`
+	// UploadedFiles are the paths of the attachments uploaded from the local files by
+	// the references in the file, which are restored on pull
+	UploadedFiles map[string]string `json:"uploadedFiles,omitempty"`
+	// NoteLinks are the URLs of the notes linked by the relative paths in the file,
+	// which are restored on push
+	NoteLinks map[string]string `json:"noteLinks,omitempty"`
+}
+
+type commentsState struct {
+	// Count is the number of the comments
+	Count int `json:"count"`
+	// LatestAt is the latest time when the last comment is published or updated
+	LatestAt Time `json:"latestAt"`
+}
+
+func loadSyncState(dir string) (*syncState, error) {
+	st := &syncState{
+		Notes: make(map[int]*noteState),
+		dir:   dir,
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, syncMetaDir, stateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return st, nil
+		}
+		return nil, xerrors.Errorf("failed to loadSyncState: %w", err)
+	}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, xerrors.Errorf("failed to loadSyncState: %w", err)
+	}
+	if st.Notes == nil {
+		st.Notes = make(map[int]*noteState)
+	}
+	return st, nil
+}
+
+func (st *syncState) save() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("failed to save state: %w", err)
+	}
+	fpath := filepath.Join(st.dir, syncMetaDir, stateFile)
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return xerrors.Errorf("failed to save state: %w", err)
+	}
+	// write to the temporary file and rename it to avoid corrupting the state
+	tmp := fpath + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return xerrors.Errorf("failed to save state: %w", err)
+	}
+	if err := os.Rename(tmp, fpath); err != nil {
+		return xerrors.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
+
+// updateSettings changes the settings of the sync directory by the fn, which reports
+// whether they are changed, and saves the state. The watermarks are reset on changes,
+// so that the next pull lists every note and applies the settings to existing files.
+func (st *syncState) updateSettings(fn func() bool) error {
+	st.mu.Lock()
+	changed := fn()
+	if changed {
+		st.Watermarks = nil
+	}
+	st.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	return st.save()
+}
+
+func (st *syncState) layout() Layout {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.Layout == "" {
+		return LayoutFlat
+	}
+	return st.Layout
+}
+
+func (st *syncState) attachments() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.Attachments
+}
+
+func (st *syncState) links() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.Links
+}
+
+func (st *syncState) uploaded(hash string) string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.Uploads[hash]
+}
+
+func (st *syncState) setUploaded(hash, path string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.Uploads == nil {
+		st.Uploads = make(map[string]string)
+	}
+	st.Uploads[hash] = path
+}
+
+// uploadedFiles returns the references of the local files uploaded from the file of
+// the note at the last synchronization
+func (st *syncState) uploadedFiles(num int) map[string]string {
+	if ns := st.get(num); ns != nil {
+		return ns.UploadedFiles
+	}
+	return nil
+}
+
+// filename returns the filename template. The default is FilenameIDSlug for
+// LayoutFolder and FilenameID for LayoutFlat.
+func (st *syncState) filename() FilenameTemplate {
+	st.mu.Lock()
+	t := st.Filename
+	st.mu.Unlock()
+	if t != "" {
+		return t
+	}
+	if st.layout() == LayoutFolder {
+		return FilenameIDSlug
+	}
+	return FilenameID
+}
+
+func (st *syncState) get(num int) *noteState {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.Notes[num]
+}
+
+// record records the MD as synchronized with the remote note
+func (st *syncState) record(m *MD) error {
+	num, err := m.ID.Number()
+	if err != nil {
+		return xerrors.Errorf("failed to record state: %w", err)
+	}
+	rel, err := filepath.Rel(st.dir, m.filepath)
+	if err != nil {
+		return xerrors.Errorf("failed to record state: %w", err)
+	}
+	ns := &noteState{
+		Path:      filepath.ToSlash(rel),
+		UpdatedAt: Time{Time: m.UpdatedAt},
+		Hash:      m.hash(),
+	}
+	if len(m.attachments) > 0 {
+		ns.AttachmentURLs = m.attachments
+	}
+	if len(m.uploads) > 0 {
+		ns.UploadedFiles = m.uploads
+	}
+	if len(m.links) > 0 {
+		ns.NoteLinks = m.links
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if prev := st.Notes[num]; prev != nil {
+		ns.Comments = prev.Comments
+	}
+	st.Notes[num] = ns
+	return nil
+}
+
+// setComments records the state of the comments of the note
+func (st *syncState) setComments(num int, cs *commentsState) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if ns := st.Notes[num]; ns != nil {
+		ns.Comments = cs
+	}
+}
+
+// localPath returns the path of the local file of the note recorded in the state, or
+// the default path in the sync directory when it isn't recorded
+func (st *syncState) localPath(num int) string {
+	if ns := st.get(num); ns != nil {
+		return filepath.Join(st.dir, filepath.FromSlash(ns.Path))
+	}
+	return filepath.Join(st.dir, fmt.Sprintf("%d.md", num))
+}
+
+// lastUpdatedAt returns the updatedAt of the remote note at the last synchronization.
+// For the note which isn't recorded in the state, e.g. pulled by older versions,
+// mtime of the local file is used instead. It returns the zero time when the
+// local file doesn't exist.
+func (st *syncState) lastUpdatedAt(num int, fpath string) (time.Time, error) {
+	if ns := st.get(num); ns != nil {
+		if _, err := os.Stat(filepath.Join(st.dir, filepath.FromSlash(ns.Path))); err == nil {
+			return ns.UpdatedAt.Time, nil
+		}
+	}
+	if _, err := os.Stat(fpath); err != nil {
+		return time.Time{}, nil
+	}
+	m, err := LoadMD(fpath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return m.UpdatedAt, nil
+}
+
+// modifiedLocally reports whether the local file has been modified since the last
+// synchronization. The file is considered modified when neither the state nor the
+// base snapshot is available.
+func (st *syncState) modifiedLocally(num int, fpath string) (bool, error) {
+	m, err := LoadMD(fpath)
+	if err != nil {
+		return false, err
+	}
+	if ns := st.get(num); ns != nil {
+		return m.hash() != ns.Hash, nil
+	}
+	base, err := m.loadBase()
+	if err != nil {
+		return false, err
+	}
+	return base == nil || m.hash() != base.hash(), nil
+}
+
+func (st *syncState) watermark(folderID ID) time.Time {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.Watermarks[folderID.Raw()].Time
+}
+
+func (st *syncState) setWatermark(folderID ID, ti time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.Watermarks == nil {
+		st.Watermarks = make(map[string]Time)
+	}
+	if ti.After(st.Watermarks[folderID.Raw()].Time) {
+		st.Watermarks[folderID.Raw()] = Time{Time: ti}
+	}
+}
+
+func (st *syncState) forget(num int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.Notes, num)
+}
+
+// syncState returns the state of the dir. The state is loaded once per directory
+// and shared in the process.
+func (ki *Kibela) syncState(dir string) (*syncState, error) {
+	dir = filepath.Clean(dir)
+	ki.statesMu.Lock()
+	defer ki.statesMu.Unlock()
+	if st, ok := ki.states[dir]; ok {
+		return st, nil
+	}
+	st, err := loadSyncState(dir)
+	if err != nil {
+		return nil, err
+	}
+	st.team = ki.team
+	if ki.states == nil {
+		ki.states = make(map[string]*syncState)
+	}
+	ki.states[dir] = st
+	return st, nil
+}
+
+// recordSync records the MD to the state of its sync directory and saves the state
+func (ki *Kibela) recordSync(m *MD) error {
+	st, err := ki.syncState(m.syncDir())
+	if err != nil {
+		return err
+	}
+	if err := st.record(m); err != nil {
+		return err
+	}
+	return st.save()
+}
@@ -0,0 +1,118 @@
+package kibela
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncState(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "kibelasync-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	synced := mustTime("2019-06-23T16:54:09.447+09:00")
+	m := newTestMD()
+	m.UpdatedAt = synced.Time
+	m.filepath = filepath.Join(tmpdir, "366.md")
+	if err := m.save(); err != nil {
+		t.Fatal(err)
+	}
+	ki := &Kibela{}
+	if err := ki.recordSync(m); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+
+	st, err := loadSyncState(tmpdir)
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	ns := st.get(366)
+	if ns == nil {
+		t.Fatalf("state of 366 should be recorded")
+	}
+	if ns.Path != "366.md" || !ns.UpdatedAt.Equal(synced.Time) || ns.Hash != m.hash() {
+		t.Errorf("unexpected state: %+v", ns)
+	}
+
+	// touching files, e.g. by `git checkout`, should not affect the status
+	touched := synced.Add(time.Hour)
+	if err := os.Chtimes(m.filepath, touched, touched); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadMD(m.filepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := loaded.syncStatus(ns, synced.Time)
+	if err != nil {
+		t.Errorf("error should be nil, but: %s", err)
+	}
+	if status != StatusUpToDate {
+		t.Errorf("status = %s, expect: %s", status, StatusUpToDate)
+	}
+	lastUpdatedAt, err := st.lastUpdatedAt(366, m.filepath)
+	if err != nil {
+		t.Errorf("error should be nil, but: %s", err)
+	}
+	if !lastUpdatedAt.Equal(synced.Time) {
+		t.Errorf("lastUpdatedAt = %s, expect: %s", lastUpdatedAt, synced.Time)
+	}
+
+	if err := ioutil.WriteFile(m.filepath, []byte(m.fullContent()+"edited\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = LoadMD(m.filepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err = loaded.syncStatus(ns, synced.Time)
+	if err != nil {
+		t.Errorf("error should be nil, but: %s", err)
+	}
+	if status != StatusModifiedLocally {
+		t.Errorf("status = %s, expect: %s", status, StatusModifiedLocally)
+	}
+}
+
+func TestSyncState_updateSettings(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "kibelasync-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	ki := &Kibela{}
+	watermark := mustTime("2019-06-23T16:54:09.447+09:00").Time
+	st, err := ki.syncState(tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.setWatermark("", watermark)
+
+	// flat is the default layout
+	if err := ki.SetLayout(tmpdir, LayoutFlat); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if !st.watermark("").Equal(watermark) {
+		t.Error("the watermark should be kept without changes")
+	}
+
+	if err := ki.SetLayout(tmpdir, LayoutFolder); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if !st.watermark("").IsZero() {
+		t.Error("the watermark should be reset by changes")
+	}
+	saved, err := loadSyncState(tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.layout() != LayoutFolder {
+		t.Errorf("the layout should be saved, but: %s", saved.layout())
+	}
+}
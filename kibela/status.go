@@ -0,0 +1,151 @@
+package kibela
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// SyncStatus represents the synchronization state between a local file and a remote note
+type SyncStatus int
+
+// SyncStatuses
+const (
+	StatusUpToDate SyncStatus = iota
+	StatusModifiedLocally
+	StatusUpdatedRemotely
+	StatusConflict
+	StatusUnpublished
+	StatusDeletedRemotely
+	StatusNotPulled
+)
+
+func (s SyncStatus) String() string {
+	switch s {
+	case StatusUpToDate:
+		return "up to date"
+	case StatusModifiedLocally:
+		return "modified locally"
+	case StatusUpdatedRemotely:
+		return "updated remotely"
+	case StatusConflict:
+		return "conflict"
+	case StatusUnpublished:
+		return "new unpublished file"
+	case StatusDeletedRemotely:
+		return "deleted remotely"
+	case StatusNotPulled:
+		return "not pulled yet"
+	}
+	return fmt.Sprintf("SyncStatus(%d)", int(s))
+}
+
+// NoteStatus is the synchronization status of a note
+type NoteStatus struct {
+	Status SyncStatus
+	// Path is the local file path. It is empty when the status is StatusNotPulled.
+	Path string
+	// ID is the note ID. It is empty when the status is StatusUnpublished.
+	ID              ID
+	RemoteUpdatedAt time.Time
+}
+
+// Status compares the Markdown files in the dir with the notes on Kibela
+func (ki *Kibela) Status(ctx context.Context, dir string) ([]*NoteStatus, error) {
+	remoteNotes, err := ki.listNoteIDs(ctx, "", 0)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to Status: %w", err)
+	}
+	remotes := make(map[int]*Note, len(remoteNotes))
+	for _, n := range remoteNotes {
+		num, err := n.ID.Number()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to Status: %w", err)
+		}
+		remotes[num] = n
+	}
+
+	syncSt, err := ki.syncState(dir)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to Status: %w", err)
+	}
+	files, err := syncSt.localFiles()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to Status: %w", err)
+	}
+	var stats []*NoteStatus
+	for _, fpath := range files {
+		num, err := noteNumberOf(fpath)
+		if err != nil {
+			stats = append(stats, &NoteStatus{Status: StatusUnpublished, Path: fpath})
+			continue
+		}
+		m, err := LoadMD(fpath)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to Status: %w", err)
+		}
+		st := &NoteStatus{Path: fpath, ID: m.ID}
+		stats = append(stats, st)
+
+		remote, ok := remotes[num]
+		if !ok {
+			st.Status = StatusDeletedRemotely
+			continue
+		}
+		delete(remotes, num)
+		st.RemoteUpdatedAt = remote.UpdatedAt.Time
+		st.Status, err = m.syncStatus(syncSt.get(num), remote.UpdatedAt.Time)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to Status: %w", err)
+		}
+	}
+	for _, n := range remotes {
+		stats = append(stats, &NoteStatus{
+			Status:          StatusNotPulled,
+			ID:              n.ID,
+			RemoteUpdatedAt: n.UpdatedAt.Time,
+		})
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].Path != stats[j].Path {
+			return stats[i].Path < stats[j].Path
+		}
+		return stats[i].ID < stats[j].ID
+	})
+	return stats, nil
+}
+
+// syncStatus decides the status by the state at the last synchronization. As
+// fallbacks for the notes which aren't recorded in the state, the base snapshot
+// or the mtime set by MD.save are used.
+func (m *MD) syncStatus(ns *noteState, remoteUpdatedAt time.Time) (SyncStatus, error) {
+	var localModified, remoteUpdated bool
+	if ns != nil {
+		localModified = m.hash() != ns.Hash
+		remoteUpdated = remoteUpdatedAt.After(ns.UpdatedAt.Time)
+	} else {
+		base, err := m.loadBase()
+		if err != nil {
+			return StatusUpToDate, err
+		}
+		if base != nil {
+			localModified = m.hash() != base.hash()
+			remoteUpdated = remoteUpdatedAt.After(base.UpdatedAt)
+		} else {
+			localModified = m.UpdatedAt.After(remoteUpdatedAt)
+			remoteUpdated = remoteUpdatedAt.After(m.UpdatedAt)
+		}
+	}
+	switch {
+	case localModified && remoteUpdated:
+		return StatusConflict, nil
+	case localModified:
+		return StatusModifiedLocally, nil
+	case remoteUpdated:
+		return StatusUpdatedRemotely, nil
+	}
+	return StatusUpToDate, nil
+}
@@ -0,0 +1,81 @@
+package kibela
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKibela_Status(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "kibelasync-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	synced := mustTime("2019-06-23T16:54:09.447+09:00")
+	later := Time{Time: synced.Add(time.Hour)}
+	for num := 1; num <= 5; num++ {
+		m := newTestMD()
+		m.ID = newID(idTypeBlog, num)
+		m.UpdatedAt = synced.Time
+		m.filepath = filepath.Join(tmpdir, fmt.Sprintf("%d.md", num))
+		if err := m.save(); err != nil {
+			t.Fatal(err)
+		}
+		if num == 2 || num == 4 {
+			if err := ioutil.WriteFile(m.filepath, []byte(m.fullContent()+"edited\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, "draft.md"), []byte("# draft\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	remotes := []struct {
+		num       int
+		updatedAt Time
+	}{{1, synced}, {2, synced}, {3, later}, {4, later}, {6, later}}
+	nodes := make([]string, len(remotes))
+	for i, r := range remotes {
+		nodes[i] = fmt.Sprintf(`{"id": "%s", "updatedAt": "%s"}`,
+			string(newID(idTypeBlog, r.num)), r.updatedAt.Format(rfc3339Milli))
+	}
+	ki := testKibela(newClient([]string{
+		fmt.Sprintf(`{"data": {"notes": {"totalCount": %d}}}`, len(remotes)),
+		fmt.Sprintf(`{"data": {"notes": {"nodes": [%s]}}}`, strings.Join(nodes, ",")),
+	}))
+
+	stats, err := ki.Status(context.Background(), tmpdir)
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	out := make(map[string]SyncStatus, len(stats))
+	for _, st := range stats {
+		key := filepath.Base(st.Path)
+		if st.Path == "" {
+			num, _ := st.ID.Number()
+			key = fmt.Sprintf("#%d", num)
+		}
+		out[key] = st.Status
+	}
+	expect := map[string]SyncStatus{
+		"1.md":     StatusUpToDate,
+		"2.md":     StatusModifiedLocally,
+		"3.md":     StatusUpdatedRemotely,
+		"4.md":     StatusConflict,
+		"5.md":     StatusDeletedRemotely,
+		"draft.md": StatusUnpublished,
+		"#6":       StatusNotPulled,
+	}
+	if !reflect.DeepEqual(out, expect) {
+		t.Errorf("\n   out: %v\nexpect: %v", out, expect)
+	}
+}
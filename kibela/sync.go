@@ -0,0 +1,68 @@
+package kibela
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"golang.org/x/xerrors"
+)
+
+// Sync synchronizes the Markdown files in the dir with Kibela in one pass.
+// It pushes locally modified files, pulls remotely updated or new notes and publishes
+// new Markdown files. Conflicting changes are merged by the three-way merge as PushMD
+// does, and when the merge conflicts, the file is left with conflict markers and
+// reported by the returned error wrapping ErrConflict after processing all the files.
+func (ki *Kibela) Sync(ctx context.Context, dir string) error {
+	stats, err := ki.Status(ctx, dir)
+	if err != nil {
+		return xerrors.Errorf("failed to Sync: %w", err)
+	}
+	var conflicts []string
+	for _, st := range stats {
+		switch st.Status {
+		case StatusModifiedLocally, StatusConflict:
+			m, err := LoadMD(st.Path)
+			if err != nil {
+				return xerrors.Errorf("failed to Sync: %w", err)
+			}
+			if err := ki.PushMD(ctx, m); err != nil {
+				if xerrors.Is(err, ErrConflict) {
+					log.Printf("conflict %q", st.Path)
+					conflicts = append(conflicts, st.Path)
+					continue
+				}
+				return xerrors.Errorf("failed to Sync: %w", err)
+			}
+		case StatusUpdatedRemotely, StatusNotPulled:
+			if err := ki.pullNote(ctx, dir, st.ID, st.Path); err != nil {
+				return xerrors.Errorf("failed to Sync: %w", err)
+			}
+		case StatusUnpublished:
+			if err := ki.publishFile(ctx, dir, st.Path); err != nil {
+				return xerrors.Errorf("failed to Sync: %w", err)
+			}
+		case StatusDeletedRemotely:
+			log.Printf("%q was deleted remotely", st.Path)
+		}
+	}
+	if len(conflicts) > 0 {
+		return xerrors.Errorf("failed to Sync: %d file(s) have conflicts, resolve them and push again: %w",
+			len(conflicts), ErrConflict)
+	}
+	return nil
+}
+
+func (ki *Kibela) publishFile(ctx context.Context, dir, fpath string) error {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return xerrors.Errorf("failed to publishFile: %w", err)
+	}
+	defer f.Close()
+	m, err := NewMD(fpath, f, "", false, dir)
+	if err != nil {
+		return xerrors.Errorf("failed to publishFile: %q: %w", fpath, err)
+	}
+	f.Close()
+	return ki.PublishMD(ctx, m, true)
+}
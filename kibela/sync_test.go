@@ -0,0 +1,75 @@
+package kibela
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKibela_Sync(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "kibelasync-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	synced := mustTime("2019-06-23T16:50:00.000+09:00")
+	for num := 1; num <= 2; num++ {
+		m := newTestMD()
+		m.ID = newID(idTypeBlog, num)
+		m.UpdatedAt = synced.Time
+		m.filepath = filepath.Join(tmpdir, fmt.Sprintf("%d.md", num))
+		if err := m.save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 1.md: updated remotely, 2.md: modified locally
+	local2 := filepath.Join(tmpdir, "2.md")
+	edited := strings.Replace(readFile(t, local2), "Hello World!", "Hello Kibela!", 1)
+	if err := ioutil.WriteFile(local2, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	later := synced.Add(time.Hour).Format(rfc3339Milli)
+	remoteNote := func(content, updatedAt string) string {
+		return fmt.Sprintf(`{"data": {"note": {
+  "title": "たいとる！",
+  "content": %q,
+  "coediting": false,
+  "folders": {"nodes": [{"id": "1", "fullName": "testtop/testsub1", "group": {"id": "R3JvdXAvMQ", "name": "Public"}}]},
+  "groups": [{"name": "Public", "id": "R3JvdXAvMQ"}, {"name": "Hobby", "id": "R3JvdXAvMg"}],
+  "author": {"account": "Songmu"},
+  "updatedAt": %q
+}}}`, content, updatedAt)
+	}
+	ki := testKibela(newClient([]string{
+		`{"data": {"notes": {"totalCount": 2}}}`,
+		fmt.Sprintf(`{"data": {"notes": {"nodes": [{"id": %q, "updatedAt": %q}, {"id": %q, "updatedAt": %q}]}}}`,
+			string(newID(idTypeBlog, 1)), later, string(newID(idTypeBlog, 2)), synced.Format(rfc3339Milli)),
+		remoteNote("Remote updated!\n", later),
+		remoteNote("Hello World!\nこんにちは!\n", synced.Format(rfc3339Milli)),
+		fmt.Sprintf(`{"data": {"updateNote": {"note": {"author": {"account": "Songmu"}, "updatedAt": %q}}}}`, later),
+	}))
+
+	if err := ki.Sync(context.Background(), tmpdir); err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if out := readFile(t, filepath.Join(tmpdir, "1.md")); !strings.HasSuffix(out, "\nRemote updated!\n") {
+		t.Errorf("1.md should be pulled, but:\n%s", out)
+	}
+	if out := readFile(t, local2); out != edited {
+		t.Errorf("2.md should be kept, but:\n%s", out)
+	}
+	fi, err := os.Stat(local2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := synced.Add(time.Hour); !fi.ModTime().Equal(expect) {
+		t.Errorf("mtime of 2.md = %s, expect: %s", fi.ModTime(), expect)
+	}
+}
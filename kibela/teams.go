@@ -0,0 +1,205 @@
+package kibela
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/konifar/kibelasync/client"
+	"golang.org/x/xerrors"
+)
+
+// Teams holds Kibela clients of the teams in the profiles for the working tree
+// holding several teams side by side like "notes/{team}/{num}.md". Each team has
+// its own client.Client, so that the rate limits are independent.
+type Teams struct {
+	ver      string
+	opts     []client.Option
+	def      *Profile
+	profiles map[string]*Profile
+
+	mu      sync.Mutex
+	kibelas map[string]*Kibela
+}
+
+// NewTeams returns Teams of the profiles in the config files. The default profile,
+// which is usually loaded by LoadProfile, is used for its team and the empty team.
+func NewTeams(ver string, def *Profile, opts ...client.Option) (*Teams, error) {
+	c, err := loadConfig(configPaths()...)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to NewTeams: %w", err)
+	}
+	return newTeams(ver, def, c, opts...), nil
+}
+
+func newTeams(ver string, def *Profile, c *Config, opts ...client.Option) *Teams {
+	t := &Teams{
+		ver:      ver,
+		opts:     opts,
+		def:      def,
+		profiles: make(map[string]*Profile),
+		kibelas:  make(map[string]*Kibela),
+	}
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := c.Profiles[name]
+		if _, ok := t.profiles[p.Team]; p.Team != "" && !ok {
+			t.profiles[p.Team] = p
+		}
+	}
+	if def.Team != "" {
+		t.profiles[def.Team] = def
+	}
+	return t
+}
+
+// Names returns the sorted names of the teams
+func (t *Teams) Names() []string {
+	names := make([]string, 0, len(t.profiles))
+	for name := range t.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile returns the profile of the team, or nil when the team is unknown
+func (t *Teams) Profile(team string) *Profile {
+	return t.profiles[team]
+}
+
+// Kibela returns the Kibela client of the team. The empty team means the team of
+// the default profile.
+func (t *Teams) Kibela(team string) (*Kibela, error) {
+	if team == "" {
+		team = t.def.Team
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ki, ok := t.kibelas[team]; ok {
+		return ki, nil
+	}
+	p, ok := t.profiles[team]
+	if !ok {
+		if team != "" {
+			return nil, fmt.Errorf("no profile of the team %q in the config files", team)
+		}
+		// NewWithProfile reports the missing team
+		p = t.def
+	}
+	ki, err := NewWithProfile(t.ver, p, t.opts...)
+	if err != nil {
+		return nil, err
+	}
+	t.kibelas[team] = ki
+	return ki, nil
+}
+
+// TeamOf infers the team of the argument specifying a note or a directory. The team
+// is taken from the host of a note URL, the "team" field of the frontmatter or the
+// sync directory named by a known team of a Markdown file, or the name of the
+// directory. It returns the empty string, which means the default team, when the
+// team can't be inferred.
+func (t *Teams) TeamOf(arg string) (string, error) {
+	if u, err := url.Parse(arg); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		if strings.HasSuffix(u.Hostname(), kibelaDomain) {
+			return strings.TrimSuffix(u.Hostname(), kibelaDomain), nil
+		}
+		return "", nil
+	}
+	if fi, err := os.Stat(arg); err == nil && fi.IsDir() {
+		abs, err := filepath.Abs(arg)
+		if err != nil {
+			return "", xerrors.Errorf("failed to TeamOf: %w", err)
+		}
+		if base := filepath.Base(abs); t.profiles[base] != nil {
+			return base, nil
+		}
+		return "", nil
+	}
+	if !strings.HasSuffix(arg, ".md") {
+		return "", nil
+	}
+	// the file may not exist yet when pulling the note
+	team, err := teamOfFrontMatter(arg)
+	if err != nil {
+		return "", xerrors.Errorf("failed to TeamOf: %w", err)
+	}
+	if team != "" {
+		return team, nil
+	}
+	abs, err := filepath.Abs(findSyncDir(arg))
+	if err != nil {
+		return "", xerrors.Errorf("failed to TeamOf: %w", err)
+	}
+	if base := filepath.Base(abs); t.profiles[base] != nil {
+		return base, nil
+	}
+	return "", nil
+}
+
+// teamOfFrontMatter returns the "team" field of the frontmatter of the Markdown file,
+// or the empty string when the file doesn't exist
+func teamOfFrontMatter(fpath string) (string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer f.Close()
+	m := &MD{}
+	if err := m.loadContentFromReader(f, false); err != nil {
+		return "", err
+	}
+	return m.FrontMatter.Team, nil
+}
+
+// Dir returns the sync directory of the team in the dir, which is "{dir}/{team}". The
+// dir itself is used when it is named by the team already, or for the default team
+// unless "{dir}/{team}" exists, so that the working tree of a single team keeps working.
+func (t *Teams) Dir(dir, team string) string {
+	if team == "" {
+		team = t.def.Team
+	}
+	if team == "" || filepath.Base(dir) == team {
+		return dir
+	}
+	teamDir := filepath.Join(dir, team)
+	if team != t.def.Team {
+		return teamDir
+	}
+	if fi, err := os.Stat(teamDir); err == nil && fi.IsDir() {
+		return teamDir
+	}
+	return dir
+}
+
+// Resolve returns the Kibela client and the sync directory for the argument specifying
+// a note in the dir. The team is inferred from the argument by TeamOf, or from the dir
+// when the argument doesn't tell it. The argument may be empty.
+func (t *Teams) Resolve(dir, arg string) (*Kibela, string, error) {
+	team, err := t.TeamOf(arg)
+	if err != nil {
+		return nil, "", err
+	}
+	if team == "" {
+		if team, err = t.TeamOf(dir); err != nil {
+			return nil, "", err
+		}
+	}
+	ki, err := t.Kibela(team)
+	if err != nil {
+		return nil, "", err
+	}
+	return ki, t.Dir(dir, team), nil
+}
@@ -0,0 +1,101 @@
+package kibela
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testTeams() *Teams {
+	return newTeams("test", &Profile{Team: "example", Token: "token"}, &Config{
+		Profiles: map[string]*Profile{
+			"work":    {Team: "example", Token: "overridden"},
+			"private": {Team: "songmu", Token: "secret"},
+			"broken":  {Team: "broken"},
+		},
+	})
+}
+
+func TestTeams_Kibela(t *testing.T) {
+	teams := testTeams()
+	if got := teams.Names(); len(got) != 3 || got[0] != "broken" || got[1] != "example" || got[2] != "songmu" {
+		t.Errorf("unexpected names: %v", got)
+	}
+	def, err := teams.Kibela("")
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	ex, _ := teams.Kibela("example")
+	if def != ex || def.team != "example" {
+		t.Errorf("the default team should be example, but: %s", def.team)
+	}
+	private, err := teams.Kibela("songmu")
+	if err != nil {
+		t.Fatalf("error should be nil, but: %s", err)
+	}
+	if private == def || private.cli == def.cli || private.team != "songmu" {
+		t.Error("each team should have its own client")
+	}
+	if _, err := teams.Kibela("broken"); err == nil {
+		t.Error("error should be occurred for the profile without the token")
+	}
+	if _, err := teams.Kibela("unknown"); err == nil {
+		t.Error("error should be occurred for unknown teams")
+	}
+}
+
+func TestTeams_Resolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kibelasync-teams-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"1.md":         "---\ntitle: default\n---\n",
+		"songmu/2.md":  "---\ntitle: by location\n---\n",
+		"3.md":         "---\ntitle: by frontmatter\nteam: songmu\n---\n",
+		"other/new.md": "# by directory of the default\n",
+	}
+	for f, content := range files {
+		fpath := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	teams := testTeams()
+	testCases := []struct {
+		dir, arg      string
+		team, syncDir string
+	}{
+		{dir: dir, arg: filepath.Join(dir, "1.md"), team: "example", syncDir: dir},
+		{dir: dir, arg: filepath.Join(dir, "songmu/2.md"), team: "songmu", syncDir: filepath.Join(dir, "songmu")},
+		{dir: dir, arg: filepath.Join(dir, "3.md"), team: "songmu", syncDir: filepath.Join(dir, "songmu")},
+		{dir: dir, arg: filepath.Join(dir, "other/new.md"), team: "example", syncDir: dir},
+		{dir: dir, arg: filepath.Join(dir, "notes/370.md"), team: "example", syncDir: dir},
+		{dir: dir, arg: filepath.Join(dir, "songmu/370.md"), team: "songmu", syncDir: filepath.Join(dir, "songmu")},
+		{dir: dir, arg: "https://songmu.kibe.la/notes/2", team: "songmu", syncDir: filepath.Join(dir, "songmu")},
+		{dir: dir, arg: "1", team: "example", syncDir: dir},
+		{dir: filepath.Join(dir, "songmu"), arg: "2", team: "songmu", syncDir: filepath.Join(dir, "songmu")},
+		{dir: filepath.Join(dir, "songmu"), arg: "", team: "songmu", syncDir: filepath.Join(dir, "songmu")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.arg, func(t *testing.T) {
+			ki, syncDir, err := teams.Resolve(tc.dir, tc.arg)
+			if err != nil {
+				t.Fatalf("error should be nil, but: %s", err)
+			}
+			if ki.team != tc.team || syncDir != tc.syncDir {
+				t.Errorf("got: (%s, %s), expect: (%s, %s)", ki.team, syncDir, tc.team, tc.syncDir)
+			}
+		})
+	}
+
+	if _, _, err := teams.Resolve(dir, "https://unknown.kibe.la/notes/1"); err == nil {
+		t.Error("error should be occurred for unknown teams")
+	}
+}
@@ -0,0 +1,62 @@
+package kibela
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const envKibelaTOKENCOMMAND = "KIBELA_TOKEN_COMMAND"
+
+// tokenCache caches the tokens by the commands for the process lifetime
+var tokenCache = struct {
+	tokens map[string]string
+	mu     sync.Mutex
+}{tokens: make(map[string]string)}
+
+// resolveToken returns the token of the profile. When the token isn't specified, it
+// is obtained from the stdout of the token command run by the shell, like
+// credential helpers of git.
+func (p *Profile) resolveToken() (string, error) {
+	if p.Token != "" || p.TokenCommand == "" {
+		return p.Token, nil
+	}
+	tokenCache.mu.Lock()
+	defer tokenCache.mu.Unlock()
+	if token, ok := tokenCache.tokens[p.TokenCommand]; ok {
+		return token, nil
+	}
+	token, err := runTokenCommand(p.TokenCommand)
+	if err != nil {
+		return "", err
+	}
+	tokenCache.tokens[p.TokenCommand] = token
+	return token, nil
+}
+
+func runTokenCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/c", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("token command %q failed: %s", command, err)
+		}
+		return "", fmt.Errorf("token command %q failed: %s: %s", command, err, msg)
+	}
+	token := strings.TrimSpace(stdout.String())
+	if token == "" {
+		return "", fmt.Errorf("token command %q printed no token", command)
+	}
+	return token, nil
+}
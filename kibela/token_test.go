@@ -0,0 +1,59 @@
+package kibela
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestProfile_resolveToken(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("token commands in the test are for sh")
+	}
+	dir, err := ioutil.TempDir("", "kibelasync-token-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	counter := filepath.Join(dir, "counter")
+
+	p := &Profile{TokenCommand: "echo called >> " + counter + "; echo ' secret '"}
+	for i := 0; i < 2; i++ {
+		token, err := p.resolveToken()
+		if err != nil {
+			t.Fatalf("error should be nil, but: %s", err)
+		}
+		if token != "secret" {
+			t.Errorf("got: %q, expect: %q", token, "secret")
+		}
+	}
+	b, err := ioutil.ReadFile(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "called"); n != 1 {
+		t.Errorf("the command should be run once, but run %d times", n)
+	}
+
+	p = &Profile{Token: "token", TokenCommand: "exit 1"}
+	if token, err := p.resolveToken(); err != nil || token != "token" {
+		t.Errorf("the token should take precedence, but: %q, %v", token, err)
+	}
+
+	testCases := []struct {
+		command string
+		want    string
+	}{
+		{"echo oops >&2; exit 3", "exit status 3: oops"},
+		{"true", "printed no token"},
+	}
+	for _, tc := range testCases {
+		_, err := (&Profile{TokenCommand: tc.command}).resolveToken()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("error should contain %q, but: %v", tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package kibela
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// linkTargetReg matches the targets of Markdown links and images, and the src and
+// href attributes of HTML
+var linkTargetReg = regexp.MustCompile(`\]\((<[^>\n]*>|[^\s()<>]+)|\b(?:src|href)=(?:"([^"\n]*)"|'([^'\n]*)')`)
+
+// replaceLinkTargets replaces the targets of the links in the content with the ones
+// returned by the fn. The target is kept when the fn returns the empty string.
+func replaceLinkTargets(content string, fn func(target string) (string, error)) (string, error) {
+	var (
+		b    strings.Builder
+		last int
+	)
+	for _, loc := range linkTargetReg.FindAllStringSubmatchIndex(content, -1) {
+		start, end := -1, -1
+		for i := 2; i < len(loc); i += 2 {
+			if loc[i] >= 0 {
+				start, end = loc[i], loc[i+1]
+				break
+			}
+		}
+		if start < 0 {
+			continue
+		}
+		replaced, err := fn(content[start:end])
+		if err != nil {
+			return "", err
+		}
+		if replaced == "" {
+			continue
+		}
+		b.WriteString(content[last:start])
+		b.WriteString(replaced)
+		last = end
+	}
+	b.WriteString(content[last:])
+	return b.String(), nil
+}
+
+// localFileOf returns the path of the local file referenced from the Markdown file,
+// or the empty string when the reference isn't a relative path of an existing file
+// in the sync directory. Files outside of the sync directory, including the ones
+// linked by symbolic links, are never uploaded not to leak them to the team. The
+// metadata directory and Markdown files, which are links to notes, are excluded too.
+func (st *syncState) localFileOf(fpath, ref string) string {
+	ref = strings.TrimSuffix(strings.TrimPrefix(ref, "<"), ">")
+	if ref == "" || strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "#") ||
+		strings.Contains(ref, ":") || strings.HasSuffix(ref, ".md") {
+		return ""
+	}
+	if p, err := url.PathUnescape(ref); err == nil {
+		ref = p
+	}
+	f := filepath.Join(filepath.Dir(fpath), filepath.FromSlash(ref))
+	fi, err := os.Stat(f)
+	if err != nil || !fi.Mode().IsRegular() {
+		return ""
+	}
+	if !st.inSyncDir(f) {
+		return ""
+	}
+	return f
+}
+
+// inSyncDir reports whether the file resolves to a path in the sync directory other
+// than the metadata directory
+func (st *syncState) inSyncDir(fpath string) bool {
+	dir, err := filepath.EvalSymlinks(st.dir)
+	if err != nil {
+		return false
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return false
+	}
+	f, err := filepath.EvalSymlinks(fpath)
+	if err != nil {
+		return false
+	}
+	if f, err = filepath.Abs(f); err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, f)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	return rel != ".." && !strings.HasPrefix(rel, "../") &&
+		rel != syncMetaDir && !strings.HasPrefix(rel, syncMetaDir+"/")
+}
+
+// remoteLocalFiles returns the content whose references of the local files are replaced
+// with the paths of the attachments returned by the upload. The references are kept
+// when the upload returns the empty string. The references replaced are remembered in
+// the MD to restore them on pull.
+func (st *syncState) remoteLocalFiles(m *MD, content string, upload func(fpath, ref string) (string, error)) (string, error) {
+	uploads := make(map[string]string)
+	content, err := replaceLinkTargets(content, func(ref string) (string, error) {
+		fpath := st.localFileOf(m.filepath, ref)
+		if fpath == "" {
+			return "", nil
+		}
+		p, err := upload(fpath, ref)
+		if err != nil || p == "" {
+			return "", err
+		}
+		uploads[ref] = p
+		return p, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	m.uploads = uploads
+	return content, nil
+}
+
+// uploadFile uploads the file as an attachment and returns its path. Files uploaded
+// before are not uploaded again by the cache of the hashes of the files.
+func (ki *Kibela) uploadFile(ctx context.Context, st *syncState, fpath string) (string, error) {
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return "", xerrors.Errorf("failed to upload %q: %w", fpath, err)
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256(b))
+	if p := st.uploaded(hash); p != "" {
+		return p, nil
+	}
+	res, err := ki.doUploadAttachment(ctx, &uploadAttachmentVariables{
+		Name: filepath.Base(fpath),
+		Data: base64.StdEncoding.EncodeToString(b),
+	})
+	if err != nil {
+		return "", xerrors.Errorf("failed to upload %q while accessing remote: %w", fpath, err)
+	}
+	if res.UploadAttachment == nil || res.UploadAttachment.Attachment == nil {
+		return "", xerrors.Errorf("failed to upload %q on any reason. null uploadAttachment was returned", fpath)
+	}
+	p := res.UploadAttachment.Attachment.Path
+	log.Printf("uploaded %q to %s", fpath, p)
+	// the cache is saved at once not to upload the file again even if pushing fails
+	st.setUploaded(hash, p)
+	if err := st.save(); err != nil {
+		return "", xerrors.Errorf("failed to upload %q: %w", fpath, err)
+	}
+	return p, nil
+}
+
+// restoreLocalFiles rewrites the paths of the attachments uploaded from local files in
+// the content of the MD back to the references of the files, as long as the files
+// exist. The references restored are remembered in the MD.
+func (st *syncState) restoreLocalFiles(m *MD, uploads map[string]string) {
+	refs := make(map[string]string)
+	sorted := make([]string, 0, len(uploads))
+	for ref := range uploads {
+		sorted = append(sorted, ref)
+	}
+	// the first reference in order is used when files have the same attachment
+	sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+	for _, ref := range sorted {
+		if st.localFileOf(m.filepath, ref) != "" {
+			refs[uploads[ref]] = ref
+		}
+	}
+	restored := make(map[string]string)
+	var (
+		b    strings.Builder
+		last int
+	)
+	for _, r := range st.attachmentRefs(m.Content) {
+		ref, ok := refs[r.url]
+		if !ok {
+			continue
+		}
+		restored[ref] = r.url
+		b.WriteString(m.Content[last:r.start])
+		b.WriteString(ref)
+		last = r.end
+	}
+	b.WriteString(m.Content[last:])
+	m.Content = b.String()
+	m.uploads = restored
+}
+
+// localize rewrites the content of the MD from the remote note into the local file:
+// the attachments uploaded from local files are linked by the references of the files
+// again, and the downloaded attachments and the notes are linked by the relative
+// paths if enabled. The uploads are the references of the local files in the file at
+// the last synchronization.
+func (st *syncState) localize(m *MD, uploads map[string]string) {
+	st.restoreLocalFiles(m, uploads)
+	m.attachments, m.links = nil, nil
+	if st.attachments() {
+		st.localizeAttachments(m)
+	}
+	if st.links() {
+		st.localizeLinks(m)
+	}
+}
+
+// remoteContent returns the content of the MD to be sent to Kibela, which links to
+// the attachments and the notes by the URLs instead of the local paths. The local
+// files referenced are uploaded.
+func (ki *Kibela) remoteContent(ctx context.Context, st *syncState, m *MD) (string, error) {
+	var (
+		urls  map[int]string
+		links map[string]string
+	)
+	if num, err := m.ID.Number(); err == nil {
+		if ns := st.get(num); ns != nil {
+			urls, links = ns.AttachmentURLs, ns.NoteLinks
+		}
+	}
+	content := st.remoteLinks(m, st.remoteAttachments(m, urls), links)
+	return st.remoteLocalFiles(m, content, func(fpath, _ string) (string, error) {
+		return ki.uploadFile(ctx, st, fpath)
+	})
+}
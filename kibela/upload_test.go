@@ -0,0 +1,86 @@
+package kibela
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoteLocalFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "kibelasync-upload-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "sync")
+	for _, f := range []string{"sync/diagram.png", "sync/img/my diagram.png", "sync/other.md", "sync/.kibelasync/state.json", "secret.env"} {
+		fpath := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "secret.env"), filepath.Join(dir, "link.png")); err != nil {
+		t.Fatal(err)
+	}
+	paths := map[string]string{
+		filepath.Join(dir, "diagram.png"):           "/attachments/1",
+		filepath.Join(dir, "img", "my diagram.png"): "/attachments/2",
+	}
+	st := &syncState{dir: dir, team: "example"}
+
+	testCases := []struct {
+		name    string
+		content string
+		expect  string
+	}{{
+		name:    "image",
+		content: "![](./diagram.png)\n",
+		expect:  "![](/attachments/1)\n",
+	}, {
+		name:    "escaped and title",
+		content: `![a](img/my%20diagram.png "title") <img src='diagram.png'>` + "\n",
+		expect:  `![a](/attachments/2 "title") <img src='/attachments/1'>` + "\n",
+	}, {
+		name:    "angle brackets",
+		content: "[b](<img/my diagram.png>)\n",
+		expect:  "[b](/attachments/2)\n",
+	}, {
+		name:    "not local files",
+		content: "[note](other.md) ![x](missing.png) ![y](/attachments/3) [z](https://example.com/a.png) [top](#top)\n",
+		expect:  "[note](other.md) ![x](missing.png) ![y](/attachments/3) [z](https://example.com/a.png) [top](#top)\n",
+	}, {
+		name:    "outside of the sync directory",
+		content: "[a](../secret.env) [b](img/../../secret.env) ![c](link.png) [d](.kibelasync/state.json)\n",
+		expect:  "[a](../secret.env) [b](img/../../secret.env) ![c](link.png) [d](.kibelasync/state.json)\n",
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &MD{Content: tc.content, filepath: filepath.Join(dir, "1.md")}
+			got, err := st.remoteLocalFiles(m, m.Content, func(fpath, _ string) (string, error) {
+				p, ok := paths[fpath]
+				if !ok {
+					t.Errorf("%q should not be uploaded", fpath)
+				}
+				return p, nil
+			})
+			if err != nil {
+				t.Fatalf("error should be nil, but: %s", err)
+			}
+			if got != tc.expect {
+				t.Errorf("remote:\n  got:    %q\n  expect: %q", got, tc.expect)
+			}
+
+			// the references are restored from the remote content
+			uploads := m.uploads
+			remote := &MD{Content: got, filepath: m.filepath}
+			st.restoreLocalFiles(remote, uploads)
+			if remote.Content != tc.content {
+				t.Errorf("restored:\n  got:    %q\n  expect: %q", remote.Content, tc.content)
+			}
+		})
+	}
+}